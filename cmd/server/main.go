@@ -2,96 +2,311 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.io/khosbilegt/wallstream/internal/server/api"
 	"github.io/khosbilegt/wallstream/internal/server/api/handlers"
+	"github.io/khosbilegt/wallstream/internal/server/backup"
+	"github.io/khosbilegt/wallstream/internal/server/config"
 	"github.io/khosbilegt/wallstream/internal/server/db"
+	"github.io/khosbilegt/wallstream/internal/server/importer"
+	"github.io/khosbilegt/wallstream/internal/server/metrics"
+	"github.io/khosbilegt/wallstream/internal/server/mqttbridge"
+	"github.io/khosbilegt/wallstream/internal/server/pki"
 	"github.io/khosbilegt/wallstream/internal/server/repository"
 	"github.io/khosbilegt/wallstream/internal/server/service"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
-	// Get MongoDB URI from environment or use default
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017/wallstream"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		switch os.Args[1] {
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		case "gc":
+			runGC(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "users":
+			runUsers(os.Args[2:])
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\nusage: %s [serve | config print | gc [--dry-run] | migrate [--status] | backup -o <file|-> | restore <file|-> | users create-admin <username>] [flags]\n", os.Args[1], os.Args[0])
+			os.Exit(2)
+		}
 	}
+	serve(os.Args[1:])
+}
 
-	// Get server port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+func serve(args []string) {
+	cfg := loadConfig(flag.NewFlagSet("serve", flag.ExitOnError), args)
 
 	// Load templates
-	api.LoadTemplates()
+	api.LoadTemplates(cfg.Server.TemplatesDir)
 
-	// Connect to MongoDB
-	log.Println("Connecting to MongoDB...")
-	client, err := db.Connect(mongoURI)
-	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
-	}
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := client.Disconnect(ctx); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v", err)
-		}
-	}()
-
-	// Get database
-	database := client.Database("wallpaper-share")
+	client, collections := connectDatabase(cfg)
+	defer disconnectDatabase(client)
 
-	// Initialize collections
-	collections := db.NewCollections(database)
+	if cfg.Features.AutoMigrate {
+		if _, err := db.Migrate(context.Background(), collections); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
 
 	// Initialize repositories
 	usersRepo := repository.NewUsersRepository(collections.Users)
 	publisherRepo := repository.NewPublisherDeviceRepository(collections.PublisherDevices)
 	publishedWallpaperRepo := repository.NewPublishedWallpaperRepository(collections.PublishedWallpapers)
+	uploadSessionRepo := repository.NewUploadSessionRepository(collections.UploadSessions)
+	subscriptionRepo := repository.NewSubscriptionRepository(collections.Subscriptions)
+	playlistRepo := repository.NewPlaylistRepository(collections.Playlists)
+	webhookRepo := repository.NewWebhookRepository(collections.Webhooks)
+	webhookDeliveryRepo := repository.NewWebhookDeliveryRepository(collections.WebhookDeliveries)
+	deviceTokenRepo := repository.NewDeviceTokenRepository(collections.DeviceTokens)
+	deviceCertificateRepo := repository.NewDeviceCertificateRepository(collections.DeviceCertificates)
+	auditEventRepo := repository.NewAuditEventRepository(collections.AuditEvents)
 
 	// Initialize services
-	usersService := service.NewUsersService(usersRepo)
+	auditService := service.NewAuditService(auditEventRepo)
+	usersService := service.NewUsersService(usersRepo, auditService, cfg.Features.Registration, []string{cfg.Import.Username})
 
-	fileService := service.NewFileService("uploads")
-	publisherService := service.NewPublisherService(publisherRepo, publishedWallpaperRepo)
+	fileService := service.NewFileService(cfg.Storage.UploadDir)
+	resumableUploadService := service.NewResumableUploadService(cfg.Storage.UploadDir, fileService, uploadSessionRepo)
+	webhookService := service.NewWebhookService(webhookRepo, webhookDeliveryRepo, subscriptionRepo, cfg.Webhooks.AllowPrivate)
+	var deviceCA *pki.CA
+	if cfg.TLS.ClientCA.Enabled {
+		var err error
+		deviceCA, err = pki.LoadOrCreateCA(cfg.TLS.ClientCA.CertFile, cfg.TLS.ClientCA.KeyFile, time.Duration(cfg.TLS.ClientCA.Validity))
+		if err != nil {
+			log.Fatalf("Failed to load device CA: %v", err)
+		}
+	}
+	publisherService := service.NewPublisherService(publisherRepo, publishedWallpaperRepo, fileService, webhookService, deviceTokenRepo, deviceCertificateRepo, deviceCA, usersRepo, auditService)
+	storageGC := service.NewStorageGC(cfg.Storage.UploadDir, time.Duration(cfg.Storage.GCGracePeriod), publishedWallpaperRepo, uploadSessionRepo)
+	retentionService := service.NewRetentionService(publisherRepo, publishedWallpaperRepo, playlistRepo)
+	playlistService := service.NewPlaylistService(playlistRepo, publishedWallpaperRepo, publisherService)
+	adminService := service.NewAdminService(usersRepo, publisherRepo, publishedWallpaperRepo, fileService, usersService, auditService)
+	accountDeletionService := service.NewAccountDeletionService(usersRepo, publisherRepo, publishedWallpaperRepo, subscriptionRepo, playlistRepo, webhookRepo, webhookDeliveryRepo, deviceTokenRepo, deviceCertificateRepo, uploadSessionRepo, fileService, auditService)
+	exportService := service.NewExportService(usersRepo, publisherRepo, publishedWallpaperRepo, subscriptionRepo, playlistRepo, fileService, auditService)
+	catalogService := service.NewCatalogService(cfg.Storage.UploadDir, publisherRepo, publishedWallpaperRepo, subscriptionRepo, usersRepo, webhookService, auditService)
+
+	importStreams, err := importer.ParseStreams(cfg.Import.Streams)
+	if err != nil {
+		log.Fatalf("Invalid import streams: %v", err)
+	}
+	importService := service.NewImportService(cfg.Import.Username, importStreams, usersRepo, publisherRepo, publishedWallpaperRepo, publisherService)
 
 	// Initialize handlers
-	handlers := handlers.NewHandlers(handlers.NewUserHandlers(usersService), handlers.NewFileHandlers(fileService), handlers.NewPublisherHandlers(publisherService))
+	handlers := handlers.NewHandlers(handlers.NewUserHandlers(usersService), handlers.NewFileHandlers(fileService, resumableUploadService), handlers.NewPublisherHandlers(publisherService), handlers.NewCatalogHandlers(catalogService), handlers.NewPlaylistHandlers(playlistService), handlers.NewWebhookHandlers(webhookService), handlers.NewAuditHandlers(auditService), handlers.NewAdminHandlers(adminService), handlers.NewExportHandlers(exportService))
 
 	// Setup routes with Chi router
 	router := chi.NewRouter()
 	routes := api.NewRoutes(router, handlers)
 	routes.RegisterRoutes()
 
+	if cfg.Metrics.Enabled {
+		metrics.Register(metrics.NewStorageCollector(cfg.Storage.UploadDir))
+		if cfg.Metrics.Addr == "" {
+			// On the public port the metrics are for admins only
+			router.With(handlers.AuthMiddleware, handlers.RequireRole(repository.RoleAdmin)).Handle("/metrics", metrics.Handler())
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			go func() {
+				log.Printf("Metrics listening on %s", cfg.Metrics.Addr)
+				if err := http.ListenAndServe(cfg.Metrics.Addr, mux); err != nil {
+					log.Fatalf("Metrics server failed: %v", err)
+				}
+			}()
+		}
+	}
+
+	// Start background jobs, stopped when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	// Listeners are added before anything can publish
+	if cfg.MQTT.Broker != "" {
+		bridge := mqttbridge.New(mqttbridge.Config{
+			Broker:      cfg.MQTT.Broker,
+			Username:    cfg.MQTT.Username,
+			Password:    cfg.MQTT.Password,
+			ClientID:    mqttClientID(cfg.MQTT.ClientID),
+			TopicPrefix: cfg.MQTT.TopicPrefix,
+			PublicURL:   cfg.Server.PublicURL,
+			Commands:    cfg.MQTT.Commands,
+		}, usersRepo, publisherRepo, publishedWallpaperRepo, publisherService)
+		webhookService.AddListener(bridge.HandleEvent)
+		go bridge.Run(jobsCtx)
+	}
+	go service.RunPeriodically(jobsCtx, "storage-gc", time.Duration(cfg.Storage.GCInterval), func(ctx context.Context) error {
+		report, err := storageGC.Sweep(ctx, false)
+		if err != nil {
+			return err
+		}
+		log.Printf("Storage GC: scanned %d files, deleted %d (%d bytes), %d errors",
+			report.Scanned, len(report.Deleted), report.FreedBytes, len(report.Errors))
+		return nil
+	})
+	go service.RunPeriodically(jobsCtx, "retention", time.Duration(cfg.Jobs.RetentionInterval), func(ctx context.Context) error {
+		report, err := retentionService.Enforce(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Retention: checked %d devices, pruned %d wallpapers, released %d files, %d errors",
+			report.Devices, report.Pruned, report.ReleasedFiles, len(report.Errors))
+		return nil
+	})
+
+	go service.RunPeriodically(jobsCtx, "playlists", time.Duration(cfg.Jobs.PlaylistTick), func(ctx context.Context) error {
+		report, err := playlistService.RunDue(ctx)
+		if err != nil {
+			return err
+		}
+		if report.Due > 0 {
+			log.Printf("Playlists: advanced %d of %d due, %d postponed, %d disabled, %d claimed elsewhere, %d errors",
+				report.Advanced, report.Due, report.Postponed, report.Disabled, report.Claimed, len(report.Errors))
+		}
+		return nil
+	})
+	go service.RunPeriodically(jobsCtx, "schedule", time.Duration(cfg.Jobs.ScheduleTick), func(ctx context.Context) error {
+		report, err := publisherService.RunSchedule(ctx)
+		if err != nil {
+			return err
+		}
+		if report.Due > 0 {
+			log.Printf("Schedule: published %d and expired %d of %d due, %d errors", report.Published, report.Expired, report.Due, len(report.Errors))
+		}
+		return nil
+	})
+	go service.RunPeriodically(jobsCtx, "webhooks", time.Duration(cfg.Jobs.WebhookTick), func(ctx context.Context) error {
+		report, err := webhookService.DeliverDue(ctx)
+		if err != nil {
+			return err
+		}
+		if report.Due > 0 || report.Pruned > 0 {
+			log.Printf("Webhooks: delivered %d of %d due, %d retrying, %d failed, pruned %d, %d errors",
+				report.Delivered, report.Due, report.Retrying, report.Failed, report.Pruned, len(report.Errors))
+		}
+		return nil
+	})
+	go service.RunPeriodically(jobsCtx, "account-deletion", time.Duration(cfg.Jobs.AccountDeletionTick), func(ctx context.Context) error {
+		report, err := accountDeletionService.RunDue(ctx)
+		if err != nil {
+			return err
+		}
+		if report.Due > 0 {
+			log.Printf("Account deletion: deleted %d of %d accounts, released %d files, %d errors",
+				report.Deleted, report.Due, report.ReleasedFiles, len(report.Errors))
+			for _, e := range report.Errors {
+				log.Printf("Account deletion: %s", e)
+			}
+		}
+		return nil
+	})
+	if len(importStreams) > 0 {
+		runImport := func(ctx context.Context) error {
+			report, err := importService.Run(ctx)
+			if err != nil {
+				return err
+			}
+			log.Printf("Import: checked %d streams, published %d, %d unchanged, %d errors",
+				report.Streams, report.Published, report.Unchanged, len(report.Errors))
+			for _, e := range report.Errors {
+				log.Printf("Import: %s", e)
+			}
+			return nil
+		}
+		go func() {
+			// Sources change daily at most, so don't wait a whole interval for
+			// the first import
+			service.RunJob(jobsCtx, "import", runImport)
+			service.RunPeriodically(jobsCtx, "import", time.Duration(cfg.Import.Interval), runImport)
+		}()
+	}
+
 	// Create HTTP server
 	server := &http.Server{
-		Addr:    ":" + port,
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler: router,
 	}
 
+	var certReloader *pki.CertReloader
+	if cfg.TLS.Enabled() {
+		certReloader, err = pki.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		server.TLSConfig = &tls.Config{
+			GetCertificate: certReloader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+		if deviceCA != nil {
+			// Devices without a certificate still sign in with an API key
+			server.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			server.TLSConfig.ClientCAs = deviceCA.Pool()
+		}
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server starting on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Server starting on port %d", cfg.Server.Port)
+		var err error
+		if certReloader != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
 
+	// Reload the TLS certificate on SIGHUP, so a renewed one is served
+	// without a restart
+	if certReloader != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := certReloader.Reload(); err != nil {
+					log.Printf("Failed to reload TLS certificate, keeping the current one: %v", err)
+					continue
+				}
+				log.Println("Reloaded TLS certificate")
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Server shutting down...")
+	stopJobs()
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -103,3 +318,228 @@ func main() {
 
 	log.Println("Server stopped")
 }
+
+// runGC sweeps the upload directory once and prints the report
+func runGC(args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Report what would be deleted without deleting anything")
+	grace := flags.Duration("grace-period", 0, "Only delete unreferenced files older than this (default storage.gc_grace_period)")
+	cfg := loadConfig(flags, args)
+	if *grace == 0 {
+		*grace = time.Duration(cfg.Storage.GCGracePeriod)
+	}
+
+	client, collections := connectDatabase(cfg)
+	defer disconnectDatabase(client)
+
+	publishedWallpaperRepo := repository.NewPublishedWallpaperRepository(collections.PublishedWallpapers)
+	uploadSessionRepo := repository.NewUploadSessionRepository(collections.UploadSessions)
+	storageGC := service.NewStorageGC(cfg.Storage.UploadDir, *grace, publishedWallpaperRepo, uploadSessionRepo)
+
+	report, err := storageGC.Sweep(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatalf("Storage GC failed: %v", err)
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+}
+
+// runMigrate applies pending migrations, or lists them with --status. On a
+// database from before the unique indexes, the first migration deletes
+// duplicate records, keeping the newest of each.
+func runMigrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := flags.Bool("status", false, "List applied and pending migrations without applying any")
+	cfg := loadConfig(flags, args)
+
+	client, collections := connectDatabase(cfg)
+	defer disconnectDatabase(client)
+
+	var result interface{}
+	if *status {
+		applied, err := db.AppliedMigrations(context.Background(), collections)
+		if err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+		done := map[int]bool{}
+		for _, migration := range applied {
+			done[migration.Version] = true
+		}
+		pending := []map[string]interface{}{}
+		for _, migration := range db.Migrations {
+			if !done[migration.Version] {
+				pending = append(pending, map[string]interface{}{"version": migration.Version, "description": migration.Description})
+			}
+		}
+		result = map[string]interface{}{"applied": applied, "pending": pending}
+	} else {
+		applied, err := db.Migrate(context.Background(), collections)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		result = map[string]interface{}{"applied": applied}
+	}
+
+	output, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(output))
+}
+
+// runBackup writes every collection and stored file to a single archive
+func runBackup(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := flags.String("o", "", "Archive to write, or - for standard output")
+	cfg := loadConfig(flags, args)
+	if *output == "" {
+		log.Fatalf("usage: %s backup -o <file|->", os.Args[0])
+	}
+
+	client, collections := connectDatabase(cfg)
+	defer disconnectDatabase(client)
+
+	w := os.Stdout
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			log.Fatalf("Failed to create backup: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	manifest, err := backup.Backup(context.Background(), collections.All(), cfg.Storage.UploadDir, w)
+	if err == nil && w != os.Stdout {
+		err = w.Close()
+	}
+	if err != nil {
+		if w != os.Stdout {
+			os.Remove(*output)
+		}
+		log.Fatalf("Backup failed: %v", err)
+	}
+
+	summary, _ := json.MarshalIndent(manifest, "", "  ")
+	fmt.Fprintln(os.Stderr, string(summary))
+}
+
+// runRestore loads an archive written by backup into an empty instance
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	cfg := loadConfig(flags, args)
+	if flags.NArg() != 1 {
+		log.Fatalf("usage: %s restore <file|->", os.Args[0])
+	}
+
+	r := os.Stdin
+	if flags.Arg(0) != "-" {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to open backup: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	client, collections := connectDatabase(cfg)
+	defer disconnectDatabase(client)
+
+	manifest, err := backup.Restore(context.Background(), collections.All(), cfg.Storage.UploadDir, r)
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+
+	output, _ := json.MarshalIndent(manifest, "", "  ")
+	fmt.Println(string(output))
+}
+
+// runUsers manages accounts from the server's own command line. create-admin
+// makes an admin account and prints its API key, which is how a server gets
+// its first admin.
+func runUsers(args []string) {
+	if len(args) == 0 || args[0] != "create-admin" {
+		log.Fatalf("usage: %s users create-admin <username> [flags]", os.Args[0])
+	}
+	flags := flag.NewFlagSet("users create-admin", flag.ExitOnError)
+	cfg := loadConfig(flags, args[1:])
+	if flags.NArg() != 1 || strings.TrimSpace(flags.Arg(0)) == "" {
+		log.Fatalf("usage: %s users create-admin <username> [flags]", os.Args[0])
+	}
+
+	client, collections := connectDatabase(cfg)
+	defer disconnectDatabase(client)
+
+	usersRepo := repository.NewUsersRepository(collections.Users)
+	auditService := service.NewAuditService(repository.NewAuditEventRepository(collections.AuditEvents))
+	usersService := service.NewUsersService(usersRepo, auditService, cfg.Features.Registration, []string{cfg.Import.Username})
+
+	apiKey, err := usersService.CreateAdmin(context.Background(), flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to create admin: %v", err)
+	}
+
+	output, _ := json.MarshalIndent(map[string]string{"username": flags.Arg(0), "api_key": apiKey}, "", "  ")
+	fmt.Println(string(output))
+}
+
+// runConfig prints the effective config, with secrets redacted, in the
+// config file format
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		log.Fatalf("usage: %s config print [flags]", os.Args[0])
+	}
+	cfg := loadConfig(flag.NewFlagSet("config print", flag.ExitOnError), args[1:])
+
+	output, err := cfg.Redacted().YAML()
+	if err != nil {
+		log.Fatalf("Failed to print config: %v", err)
+	}
+	fmt.Print(string(output))
+}
+
+// loadConfig loads the config along with the subcommand's own flags and
+// applies the settings that live in package variables
+func loadConfig(flags *flag.FlagSet, args []string) *config.Config {
+	cfg, err := config.Load(flags, args)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	service.MaxUploadSize = cfg.Limits.MaxUploadSize
+	service.MaxImportSize = cfg.Limits.MaxImportSize
+	return cfg
+}
+
+func connectDatabase(cfg *config.Config) (*mongo.Client, *db.Collections) {
+	// Connect to MongoDB
+	log.Println("Connecting to MongoDB...")
+	client, err := db.Connect(cfg.Database.URI, metrics.CommandMonitor())
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+
+	// Get database
+	database := client.Database(cfg.Database.Name)
+
+	// Initialize collections
+	return client, db.NewCollections(database)
+}
+
+func disconnectDatabase(client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		log.Printf("Error disconnecting from MongoDB: %v", err)
+	}
+}
+
+// mqttClientID returns the configured client ID, or one derived from the
+// host name so that several servers don't take over each other's session
+func mqttClientID(clientID string) string {
+	if clientID != "" {
+		return clientID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = fmt.Sprintf("%d", os.Getpid())
+	}
+	return "wallstream-" + hostname
+}
@@ -3,14 +3,18 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 type Client struct {
@@ -29,6 +33,63 @@ func NewClient(baseURL, username, apiKey string) *Client {
 	}
 }
 
+// NewClientWithTLS is NewClient with a custom TLS configuration, for servers
+// with a private CA or that authenticate devices by client certificate. With
+// a client certificate, username and apiKey may be left empty.
+func NewClientWithTLS(baseURL, username, apiKey string, tlsConfig *tls.Config) *Client {
+	client := NewClient(baseURL, username, apiKey)
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.httpClient.Transport = transport
+	}
+	return client
+}
+
+// TLSOptions are PEM files to build a client TLS configuration from. Each is
+// optional: CAFile trusts a private CA in addition to the system roots, and
+// CertFile and KeyFile present a client certificate.
+type TLSOptions struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// LoadTLSConfig builds a TLS configuration from opts, or returns nil when
+// none of the files are set
+func LoadTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts.CAFile == "" && opts.CertFile == "" && opts.KeyFile == "" {
+		return nil, nil
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be given together")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		caPEM, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("%s: no PEM certificates", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
 func (c *Client) newRequest(
 	ctx context.Context,
 	method string,
@@ -41,12 +102,15 @@ func (c *Client) newRequest(
 		return nil, err
 	}
 
-	// Basic Auth header
-	auth := c.username + ":" + c.apiKey
-	req.Header.Set(
-		"Authorization",
-		"Basic "+base64.StdEncoding.EncodeToString([]byte(auth)),
-	)
+	// Basic Auth header. Without credentials the server authenticates the
+	// client certificate instead.
+	if c.username != "" || c.apiKey != "" {
+		auth := c.username + ":" + c.apiKey
+		req.Header.Set(
+			"Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(auth)),
+		)
+	}
 
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
@@ -104,6 +168,32 @@ func (c *Client) RegisterUser(ctx context.Context, username string) (*RegisterUs
 	return &result, nil
 }
 
+// RotateAPIKey replaces the API key. The client keeps using the old key, so
+// create a new client with the returned one.
+func (c *Client) RotateAPIKey(ctx context.Context) (*RegisterUserResponse, error) {
+	var result RegisterUserResponse
+	if err := c.doJSONRequest(ctx, http.MethodPost, "/api/users/api-key", nil, &result, "rotate api key"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type AccountDeletion struct {
+	Username            string `json:"username"`
+	DeletionRequestedAt int64  `json:"deletion_requested_at"`
+}
+
+// DeleteAccount queues the account for deletion. confirm must be its
+// username. The client's credentials stop working at once.
+func (c *Client) DeleteAccount(ctx context.Context, confirm string) (*AccountDeletion, error) {
+	var result AccountDeletion
+	input := map[string]string{"confirm": confirm}
+	if err := c.doJSONRequest(ctx, http.MethodDelete, "/api/users/me", input, &result, "delete account"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // File operations
 
 type UploadWallpaperResponse struct {
@@ -160,6 +250,65 @@ func (c *Client) UploadWallpaper(ctx context.Context, filePath string) (*UploadW
 	return &result, nil
 }
 
+// PushWallpaper uploads and publishes a wallpaper in one request. The file is
+// streamed from disk instead of being buffered in memory.
+func (c *Client) PushWallpaper(ctx context.Context, deviceID, filePath string, metadata *WallpaperMetadata, schedule *PublishSchedule) (*PublishedWallpaper, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		// The server streams the file part, so metadata has to come first
+		if err := metadata.writeFields(writer); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if err := schedule.writeFields(writer); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/wallpaper", deviceID), pr, writer.FormDataContentType())
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("push wallpaper failed: %s", errResp["error"])
+	}
+
+	var result PublishedWallpaper
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 // Publisher device operations
 
 type CreatePublisherDeviceRequest struct {
@@ -203,11 +352,24 @@ func (c *Client) CreatePublisherDevice(ctx context.Context, deviceID string) (*C
 }
 
 type PublisherDevice struct {
-	ID        string `json:"id"`
-	UserID    string `json:"user_id"`
-	DeviceID  string `json:"device_id"`
-	CreatedAt int64  `json:"created_at"`
-	UpdatedAt int64  `json:"updated_at"`
+	ID               string           `json:"id"`
+	UserID           string           `json:"user_id"`
+	DeviceID         string           `json:"device_id"`
+	CurrentHash      string           `json:"current_hash,omitempty"`
+	CurrentChangedAt int64            `json:"current_changed_at,omitempty"`
+	Retention        *RetentionPolicy `json:"retention,omitempty"`
+	Public           bool             `json:"public"`
+	Name             string           `json:"name,omitempty"`
+	Description      string           `json:"description,omitempty"`
+	Tags             []string         `json:"tags,omitempty"`
+	CreatedAt        int64            `json:"created_at"`
+	UpdatedAt        int64            `json:"updated_at"`
+}
+
+type RetentionPolicy struct {
+	KeepLast   int  `json:"keep_last"`
+	KeepDays   int  `json:"keep_days"`
+	KeepPinned bool `json:"keep_pinned"`
 }
 
 func (c *Client) GetPublisherDevices(ctx context.Context) ([]PublisherDevice, error) {
@@ -283,6 +445,39 @@ func (c *Client) DeletePublisherDeviceByDeviceID(ctx context.Context, deviceID s
 	return nil
 }
 
+// UpdateRetentionPolicy replaces a device's retention policy; a nil policy
+// removes it
+func (c *Client) UpdateRetentionPolicy(ctx context.Context, deviceID string, policy *RetentionPolicy) (*PublisherDevice, error) {
+	jsonData, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, fmt.Sprintf("/api/publisher/devices/%s/retention", deviceID), bytes.NewBuffer(jsonData), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("update retention failed: %s", errResp["error"])
+	}
+
+	var result PublisherDevice
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 type GetUploadURLResponse struct {
 	UploadURL string `json:"upload_url"`
 }
@@ -316,18 +511,32 @@ func (c *Client) GetUploadURL(ctx context.Context, deviceID string) (*GetUploadU
 // Wallpaper operations
 
 type PublishUploadedWallpaperRequest struct {
+	Filename string             `json:"filename"`
+	DeviceID string             `json:"device_id"`
+	Variants []VariantUpload    `json:"variants,omitempty"`
+	Metadata *WallpaperMetadata `json:"metadata,omitempty"`
+	*PublishSchedule
+}
+
+// VariantUpload names an uploaded file as one of a wallpaper's variants. Kind
+// is day, night, light, dark or time; time variants also need a Start (HH:MM).
+type VariantUpload struct {
+	Kind     string `json:"kind"`
+	Start    string `json:"start,omitempty"`
 	Filename string `json:"filename"`
-	DeviceID string `json:"device_id"`
 }
 
 type PublishUploadedWallpaperResponse struct {
 	Message string `json:"message"`
 }
 
-func (c *Client) PublishUploadedWallpaper(ctx context.Context, deviceID, filename string) (*PublishUploadedWallpaperResponse, error) {
+func (c *Client) PublishUploadedWallpaper(ctx context.Context, deviceID, filename string, variants []VariantUpload, metadata *WallpaperMetadata, schedule *PublishSchedule) (*PublishUploadedWallpaperResponse, error) {
 	reqBody := PublishUploadedWallpaperRequest{
-		Filename: filename,
-		DeviceID: deviceID,
+		Filename:        filename,
+		DeviceID:        deviceID,
+		Variants:        variants,
+		Metadata:        metadata,
+		PublishSchedule: schedule,
 	}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
@@ -360,17 +569,138 @@ func (c *Client) PublishUploadedWallpaper(ctx context.Context, deviceID, filenam
 }
 
 type PublishedWallpaper struct {
-	ID        string `json:"id"`
-	UserID    string `json:"user_id"`
-	DeviceID  string `json:"device_id"`
-	Hash      string `json:"hash"`
-	URL       string `json:"url"`
-	CreatedAt int64  `json:"created_at"`
-	UpdatedAt int64  `json:"updated_at"`
+	ID        string             `json:"id"`
+	UserID    string             `json:"user_id"`
+	DeviceID  string             `json:"device_id"`
+	Hash      string             `json:"hash"`
+	URL       string             `json:"url"`
+	Monitors  []MonitorImage     `json:"monitors,omitempty"`
+	Variants  []WallpaperVariant `json:"variants,omitempty"`
+	Palette   []string           `json:"palette,omitempty"`
+	Luminance float64            `json:"luminance"`
+	Pinned    bool               `json:"pinned"`
+
+	WallpaperMetadata
+
+	PublishSchedule
+	ScheduleStatus string `json:"schedule_status,omitempty"`
+	RevertHash     string `json:"revert_hash,omitempty"`
+
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
 }
 
-func (c *Client) GetPublishedWallpapers(ctx context.Context) ([]PublishedWallpaper, error) {
-	req, err := c.newRequest(ctx, http.MethodGet, "/api/publisher/wallpaper", nil, "")
+// PublishSchedule delays a wallpaper until PublishAt and, if ExpiresAt is set,
+// puts the previous wallpaper back at ExpiresAt. Both are unix timestamps.
+type PublishSchedule struct {
+	PublishAt int64 `json:"publish_at,omitempty"`
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+func (s *PublishSchedule) writeFields(writer *multipart.Writer) error {
+	if s == nil {
+		return nil
+	}
+	fields := [][2]string{
+		{"publish_at", strconv.FormatInt(s.PublishAt, 10)},
+		{"expires_at", strconv.FormatInt(s.ExpiresAt, 10)},
+	}
+	for _, field := range fields {
+		if field[1] == "0" {
+			continue
+		}
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type WallpaperVariant struct {
+	Kind  string `json:"kind"`
+	Start string `json:"start,omitempty"`
+	Hash  string `json:"hash"`
+	URL   string `json:"url"`
+}
+
+// WallpaperMetadata is optional descriptive information about a wallpaper
+type WallpaperMetadata struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	SourceURL   string   `json:"source_url,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	License     string   `json:"license,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// writeFields adds the metadata to a multipart publish as form fields
+func (m *WallpaperMetadata) writeFields(writer *multipart.Writer) error {
+	if m == nil {
+		return nil
+	}
+	fields := [][2]string{
+		{"title", m.Title},
+		{"description", m.Description},
+		{"source_url", m.SourceURL},
+		{"author", m.Author},
+		{"license", m.License},
+	}
+	for _, tag := range m.Tags {
+		fields = append(fields, [2]string{"tag", tag})
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WallpaperMetadataPatch edits metadata. Nil fields are left unchanged and
+// empty ones are cleared.
+type WallpaperMetadataPatch struct {
+	Title       *string   `json:"title,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	SourceURL   *string   `json:"source_url,omitempty"`
+	Author      *string   `json:"author,omitempty"`
+	License     *string   `json:"license,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+}
+
+type MonitorImage struct {
+	Index  int    `json:"index"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Hash   string `json:"hash"`
+	URL    string `json:"url"`
+}
+
+// ColorQuery restricts wallpaper listings to those with a palette color close
+// to Color (#rrggbb). A zero Tolerance uses the server default.
+type ColorQuery struct {
+	Color     string
+	Tolerance float64
+}
+
+func (q *ColorQuery) encode() string {
+	if q == nil || q.Color == "" {
+		return ""
+	}
+	values := url.Values{}
+	values.Set("color", q.Color)
+	if q.Tolerance > 0 {
+		values.Set("tolerance", fmt.Sprintf("%g", q.Tolerance))
+	}
+	return "?" + values.Encode()
+}
+
+func (c *Client) GetPublishedWallpapers(ctx context.Context, colorQuery *ColorQuery) ([]PublishedWallpaper, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/publisher/wallpaper"+colorQuery.encode(), nil, "")
 	if err != nil {
 		return nil, err
 	}
@@ -395,8 +725,8 @@ func (c *Client) GetPublishedWallpapers(ctx context.Context) ([]PublishedWallpap
 	return result, nil
 }
 
-func (c *Client) GetPublishedWallpapersByDeviceID(ctx context.Context, deviceID string) ([]PublishedWallpaper, error) {
-	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/wallpaper/%s", deviceID), nil, "")
+func (c *Client) GetPublishedWallpapersByDeviceID(ctx context.Context, deviceID string, colorQuery *ColorQuery) ([]PublishedWallpaper, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/wallpaper/%s", deviceID)+colorQuery.encode(), nil, "")
 	if err != nil {
 		return nil, err
 	}
@@ -442,6 +772,140 @@ func (c *Client) DeletePublishedWallpaperByHash(ctx context.Context, hash string
 	return nil
 }
 
+type WallpaperHistory struct {
+	DeviceID    string               `json:"device_id"`
+	CurrentHash string               `json:"current_hash"`
+	Total       int64                `json:"total"`
+	Offset      int64                `json:"offset"`
+	Limit       int64                `json:"limit"`
+	Wallpapers  []PublishedWallpaper `json:"wallpapers"`
+}
+
+func (c *Client) GetWallpaperHistory(ctx context.Context, deviceID string, offset, limit int64) (*WallpaperHistory, error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprintf("%d", offset))
+	if limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", limit))
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/devices/%s/history?%s", deviceID, values.Encode()), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("get wallpaper history failed: %s", errResp["error"])
+	}
+
+	var result WallpaperHistory
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type RollbackWallpaperRequest struct {
+	Hash string `json:"hash"`
+}
+
+func (c *Client) RollbackWallpaper(ctx context.Context, deviceID, hash string) (*PublishedWallpaper, error) {
+	jsonData, err := json.Marshal(RollbackWallpaperRequest{Hash: hash})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/rollback", deviceID), bytes.NewBuffer(jsonData), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("rollback wallpaper failed: %s", errResp["error"])
+	}
+
+	var result PublishedWallpaper
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// SetWallpaperPinned pins or unpins a wallpaper on a device
+func (c *Client) SetWallpaperPinned(ctx context.Context, deviceID, hash string, pinned bool) error {
+	method := http.MethodPut
+	if !pinned {
+		method = http.MethodDelete
+	}
+
+	req, err := c.newRequest(ctx, method, fmt.Sprintf("/api/publisher/devices/%s/pins/%s", deviceID, hash), nil, "")
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("pin wallpaper failed: %s", errResp["error"])
+	}
+
+	return nil
+}
+
+func (c *Client) UpdateWallpaperMetadata(ctx context.Context, hash string, patch *WallpaperMetadataPatch) (*PublishedWallpaper, error) {
+	jsonData, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch, fmt.Sprintf("/api/publisher/wallpaper/%s", hash), bytes.NewBuffer(jsonData), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("update wallpaper metadata failed: %s", errResp["error"])
+	}
+
+	var result PublishedWallpaper
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 func (c *Client) ServeWallpaper(ctx context.Context, deviceID string) ([]byte, error) {
 	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("/api/wallpaper/%s", deviceID), nil, "")
 	if err != nil {
@@ -467,3 +931,928 @@ func (c *Client) ServeWallpaper(ctx context.Context, deviceID string) ([]byte, e
 
 	return data, nil
 }
+
+// Multi-monitor operations
+
+// MonitorUpload places an uploaded file on one of the publisher's monitors
+type MonitorUpload struct {
+	Filename string `json:"filename"`
+	Index    int    `json:"index"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+type PublishWallpaperSetRequest struct {
+	Monitors []MonitorUpload    `json:"monitors"`
+	Metadata *WallpaperMetadata `json:"metadata,omitempty"`
+	*PublishSchedule
+}
+
+func (c *Client) PublishWallpaperSet(ctx context.Context, deviceID string, monitors []MonitorUpload, metadata *WallpaperMetadata, schedule *PublishSchedule) (*PublishedWallpaper, error) {
+	jsonData, err := json.Marshal(PublishWallpaperSetRequest{Monitors: monitors, Metadata: metadata, PublishSchedule: schedule})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/wallpaper-set", deviceID), bytes.NewBuffer(jsonData), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("publish wallpaper set failed: %s", errResp["error"])
+	}
+
+	var result PublishedWallpaper
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type MonitorAssignment struct {
+	Index       int    `json:"index"`
+	SourceIndex int    `json:"source_index"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Hash        string `json:"hash"`
+}
+
+type MonitorManifest struct {
+	DeviceID string              `json:"device_id"`
+	Hash     string              `json:"hash"`
+	Mirrored bool                `json:"mirrored"`
+	Monitors []MonitorAssignment `json:"monitors"`
+	Variants []VariantAssignment `json:"variants,omitempty"`
+}
+
+// VariantAssignment describes one of the current wallpaper's variants. Index
+// is what to download it by.
+type VariantAssignment struct {
+	Index int    `json:"index"`
+	Kind  string `json:"kind"`
+	Start string `json:"start,omitempty"`
+	Hash  string `json:"hash"`
+}
+
+// GetWallpaperManifest returns how the device's current wallpaper maps onto
+// monitorCount monitors; zero returns the publisher's own layout
+func (c *Client) GetWallpaperManifest(ctx context.Context, deviceID string, monitorCount int) (*MonitorManifest, error) {
+	path := fmt.Sprintf("/api/wallpaper/%s/manifest", deviceID)
+	if monitorCount > 0 {
+		path += fmt.Sprintf("?monitors=%d", monitorCount)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("get wallpaper manifest failed: %s", errResp["error"])
+	}
+
+	var result MonitorManifest
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ServeMonitorWallpaper downloads the current image for one of the
+// publisher's monitors, by its source index
+func (c *Client) ServeMonitorWallpaper(ctx context.Context, deviceID string, sourceIndex int) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("/api/wallpaper/%s/monitors/%d", deviceID, sourceIndex), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("serve monitor wallpaper failed: %s", errResp["error"])
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// ServeVariantWallpaper downloads one of the current wallpaper's variants, by
+// its index in the manifest
+func (c *Client) ServeVariantWallpaper(ctx context.Context, deviceID string, index int) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("/api/wallpaper/%s/variants/%d", deviceID, index), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("serve variant wallpaper failed: %s", errResp["error"])
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// StreamSettings control how a device appears in the public catalog
+type StreamSettings struct {
+	Public      bool     `json:"public"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+func (c *Client) UpdateStreamSettings(ctx context.Context, deviceID string, settings *StreamSettings) (*PublisherDevice, error) {
+	jsonData, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, fmt.Sprintf("/api/publisher/devices/%s/stream", deviceID), bytes.NewBuffer(jsonData), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("update stream settings failed: %s", errResp["error"])
+	}
+
+	var result PublisherDevice
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Catalog operations
+
+type StreamSummary struct {
+	DeviceID     string   `json:"device_id"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Owner        string   `json:"owner"`
+	Tags         []string `json:"tags,omitempty"`
+	Subscribers  int64    `json:"subscribers"`
+	CurrentHash  string   `json:"current_hash,omitempty"`
+	UpdatedAt    int64    `json:"updated_at"`
+	ThumbnailURL string   `json:"thumbnail_url,omitempty"`
+}
+
+type CatalogPage struct {
+	Total   int64           `json:"total"`
+	Offset  int64           `json:"offset"`
+	Limit   int64           `json:"limit"`
+	Streams []StreamSummary `json:"streams"`
+}
+
+// CatalogQuery searches the catalog. Sort is "popular" or "recent"; zero
+// values use the server defaults.
+type CatalogQuery struct {
+	Query string
+	Sort  string
+	// Color keeps only streams whose current wallpaper matches
+	Color  *ColorQuery
+	Offset int64
+	Limit  int64
+}
+
+func (c *Client) ListStreams(ctx context.Context, query *CatalogQuery) (*CatalogPage, error) {
+	values := url.Values{}
+	if query.Query != "" {
+		values.Set("q", query.Query)
+	}
+	if query.Sort != "" {
+		values.Set("sort", query.Sort)
+	}
+	if query.Color != nil && query.Color.Color != "" {
+		values.Set("color", query.Color.Color)
+		if query.Color.Tolerance > 0 {
+			values.Set("tolerance", fmt.Sprintf("%g", query.Color.Tolerance))
+		}
+	}
+	values.Set("offset", fmt.Sprintf("%d", query.Offset))
+	if query.Limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", query.Limit))
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/catalog/streams?"+values.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("list streams failed: %s", errResp["error"])
+	}
+
+	var result CatalogPage
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type Subscription struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	DeviceID  string `json:"device_id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (c *Client) GetSubscriptions(ctx context.Context) ([]Subscription, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/subscriptions", nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("get subscriptions failed: %s", errResp["error"])
+	}
+
+	var result []Subscription
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *Client) SetSubscribed(ctx context.Context, deviceID string, subscribed bool) error {
+	method := http.MethodPut
+	if !subscribed {
+		method = http.MethodDelete
+	}
+
+	req, err := c.newRequest(ctx, method, fmt.Sprintf("/api/subscriptions/%s", deviceID), nil, "")
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("update subscription failed: %s", errResp["error"])
+	}
+
+	return nil
+}
+
+// Playlist operations
+
+type Playlist struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"user_id"`
+	DeviceID  string   `json:"device_id"`
+	Name      string   `json:"name"`
+	Hashes    []string `json:"hashes"`
+	Shuffle   bool     `json:"shuffle"`
+	Interval  int64    `json:"interval_seconds,omitempty"`
+	Cron      string   `json:"cron,omitempty"`
+	Enabled   bool     `json:"enabled"`
+	Order     []string `json:"order"`
+	Position  int      `json:"position"`
+	NextRunAt int64    `json:"next_run_at,omitempty"`
+	LastRunAt int64    `json:"last_run_at,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// PlaylistInput creates or replaces a playlist. Set exactly one of Interval
+// (e.g. "1h") and Cron.
+type PlaylistInput struct {
+	Name     string   `json:"name"`
+	Hashes   []string `json:"hashes"`
+	Shuffle  bool     `json:"shuffle"`
+	Interval string   `json:"interval,omitempty"`
+	Cron     string   `json:"cron,omitempty"`
+	Enabled  *bool    `json:"enabled,omitempty"`
+}
+
+// doPlaylistRequest sends a playlist request and decodes the playlist in the
+// response, if out is given
+func (c *Client) doPlaylistRequest(ctx context.Context, method, path string, input *PlaylistInput, out interface{}, action string) error {
+	var body io.Reader
+	contentType := ""
+	if input != nil {
+		jsonData, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewBuffer(jsonData), "application/json"
+	}
+
+	req, err := c.newRequest(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("%s failed: %s", action, errResp["error"])
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) CreatePlaylist(ctx context.Context, deviceID string, input *PlaylistInput) (*Playlist, error) {
+	var result Playlist
+	if err := c.doPlaylistRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/playlists", deviceID), input, &result, "create playlist"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetPlaylists(ctx context.Context, deviceID string) ([]Playlist, error) {
+	var result []Playlist
+	if err := c.doPlaylistRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/devices/%s/playlists", deviceID), nil, &result, "get playlists"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) GetPlaylist(ctx context.Context, deviceID, playlistID string) (*Playlist, error) {
+	var result Playlist
+	if err := c.doPlaylistRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/devices/%s/playlists/%s", deviceID, playlistID), nil, &result, "get playlist"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) UpdatePlaylist(ctx context.Context, deviceID, playlistID string, input *PlaylistInput) (*Playlist, error) {
+	var result Playlist
+	if err := c.doPlaylistRequest(ctx, http.MethodPut, fmt.Sprintf("/api/publisher/devices/%s/playlists/%s", deviceID, playlistID), input, &result, "update playlist"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) DeletePlaylist(ctx context.Context, deviceID, playlistID string) error {
+	return c.doPlaylistRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/publisher/devices/%s/playlists/%s", deviceID, playlistID), nil, nil, "delete playlist")
+}
+
+func (c *Client) SkipPlaylist(ctx context.Context, deviceID, playlistID string) (*Playlist, error) {
+	var result Playlist
+	if err := c.doPlaylistRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/playlists/%s/next", deviceID, playlistID), nil, &result, "skip playlist"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Webhook operations
+
+type Webhook struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only returned when the webhook is created
+	Secret    string `json:"secret,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// WebhookInput creates or replaces a webhook
+type WebhookInput struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             string `json:"id"`
+	WebhookID      string `json:"webhook_id"`
+	Event          string `json:"event"`
+	Payload        string `json:"payload"`
+	RedeliveryOf   string `json:"redelivery_of,omitempty"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  int64  `json:"last_attempt_at,omitempty"`
+	ResponseStatus int    `json:"response_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+type WebhookDeliveryLog struct {
+	WebhookID  string            `json:"webhook_id"`
+	Total      int64             `json:"total"`
+	Offset     int64             `json:"offset"`
+	Limit      int64             `json:"limit"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// doJSONRequest sends input, if given, as a JSON body and decodes the
+// response into out, if given
+func (c *Client) doJSONRequest(ctx context.Context, method, path string, input interface{}, out interface{}, action string) error {
+	var body io.Reader
+	contentType := ""
+	if input != nil {
+		jsonData, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewBuffer(jsonData), "application/json"
+	}
+
+	req, err := c.newRequest(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("%s failed: %s", action, errResp["error"])
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) CreateWebhook(ctx context.Context, input *WebhookInput) (*Webhook, error) {
+	var result Webhook
+	if err := c.doJSONRequest(ctx, http.MethodPost, "/api/webhooks", input, &result, "create webhook"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	var result []Webhook
+	if err := c.doJSONRequest(ctx, http.MethodGet, "/api/webhooks", nil, &result, "get webhooks"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	var result Webhook
+	if err := c.doJSONRequest(ctx, http.MethodGet, fmt.Sprintf("/api/webhooks/%s", webhookID), nil, &result, "get webhook"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, webhookID string, input *WebhookInput) (*Webhook, error) {
+	var result Webhook
+	if err := c.doJSONRequest(ctx, http.MethodPut, fmt.Sprintf("/api/webhooks/%s", webhookID), input, &result, "update webhook"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
+	return c.doJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/webhooks/%s", webhookID), nil, nil, "delete webhook")
+}
+
+func (c *Client) GetWebhookDeliveries(ctx context.Context, webhookID string, offset, limit int64) (*WebhookDeliveryLog, error) {
+	var result WebhookDeliveryLog
+	values := url.Values{}
+	values.Set("offset", fmt.Sprintf("%d", offset))
+	if limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", limit))
+	}
+	path := fmt.Sprintf("/api/webhooks/%s/deliveries?%s", webhookID, values.Encode())
+	if err := c.doJSONRequest(ctx, http.MethodGet, path, nil, &result, "get webhook deliveries"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) RedeliverWebhookDelivery(ctx context.Context, webhookID, deliveryID string) (*WebhookDelivery, error) {
+	var result WebhookDelivery
+	path := fmt.Sprintf("/api/webhooks/%s/deliveries/%s/redeliver", webhookID, deliveryID)
+	if err := c.doJSONRequest(ctx, http.MethodPost, path, nil, &result, "redeliver webhook delivery"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Device token operations
+
+// DeviceToken lets automation publish to a single device
+type DeviceToken struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name,omitempty"`
+	// Token is only returned when the token is created
+	Token      string `json:"token,omitempty"`
+	Prefix     string `json:"prefix"`
+	LastUsedAt int64  `json:"last_used_at,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+func (c *Client) CreateDeviceToken(ctx context.Context, deviceID, name string) (*DeviceToken, error) {
+	var result DeviceToken
+	input := map[string]string{"name": name}
+	if err := c.doJSONRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/tokens", deviceID), input, &result, "create device token"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetDeviceTokens(ctx context.Context, deviceID string) ([]DeviceToken, error) {
+	var result []DeviceToken
+	if err := c.doJSONRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/devices/%s/tokens", deviceID), nil, &result, "get device tokens"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) RevokeDeviceToken(ctx context.Context, deviceID, tokenID string) error {
+	return c.doJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/publisher/devices/%s/tokens/%s", deviceID, tokenID), nil, nil, "revoke device token")
+}
+
+// Device certificate operations
+
+// DeviceCertificate lets a device authenticate with mutual TLS instead of an
+// API key
+type DeviceCertificate struct {
+	ID          string `json:"id"`
+	UserID      string `json:"user_id"`
+	DeviceID    string `json:"device_id"`
+	Name        string `json:"name,omitempty"`
+	Serial      string `json:"serial"`
+	Fingerprint string `json:"fingerprint"`
+	NotAfter    int64  `json:"not_after"`
+	// Certificate and CACertificate are PEM, only returned when the
+	// certificate is issued
+	Certificate   string `json:"certificate,omitempty"`
+	CACertificate string `json:"ca_certificate,omitempty"`
+	LastUsedAt    int64  `json:"last_used_at,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+// IssueDeviceCertificate has the server sign csrPEM, a PEM certificate
+// request for a key the device keeps
+func (c *Client) IssueDeviceCertificate(ctx context.Context, deviceID, name, csrPEM string) (*DeviceCertificate, error) {
+	var result DeviceCertificate
+	input := map[string]string{"name": name, "csr": csrPEM}
+	if err := c.doJSONRequest(ctx, http.MethodPost, fmt.Sprintf("/api/publisher/devices/%s/certificates", deviceID), input, &result, "issue device certificate"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetDeviceCertificates(ctx context.Context, deviceID string) ([]DeviceCertificate, error) {
+	var result []DeviceCertificate
+	if err := c.doJSONRequest(ctx, http.MethodGet, fmt.Sprintf("/api/publisher/devices/%s/certificates", deviceID), nil, &result, "get device certificates"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) RevokeDeviceCertificate(ctx context.Context, deviceID, certificateID string) error {
+	return c.doJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/publisher/devices/%s/certificates/%s", deviceID, certificateID), nil, nil, "revoke device certificate")
+}
+
+// Audit operations
+
+type AuditEvent struct {
+	ID            string            `json:"id"`
+	UserID        string            `json:"user_id"`
+	ActorID       string            `json:"actor_id,omitempty"`
+	ActorUsername string            `json:"actor_username,omitempty"`
+	KeyID         string            `json:"key_id,omitempty"`
+	Action        string            `json:"action"`
+	Target        string            `json:"target,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+	IP            string            `json:"ip,omitempty"`
+	RequestID     string            `json:"request_id,omitempty"`
+	CreatedAt     int64             `json:"created_at"`
+}
+
+type AuditLog struct {
+	Total  int64        `json:"total"`
+	Offset int64        `json:"offset"`
+	Limit  int64        `json:"limit"`
+	Events []AuditEvent `json:"events"`
+}
+
+// AuditQuery filters the audit log. Since and Until are unix timestamps; zero
+// values are left out.
+type AuditQuery struct {
+	Action string
+	Since  int64
+	Until  int64
+	Offset int64
+	Limit  int64
+}
+
+func (q *AuditQuery) encode() string {
+	values := url.Values{}
+	if q.Action != "" {
+		values.Set("action", q.Action)
+	}
+	if q.Since > 0 {
+		values.Set("since", fmt.Sprintf("%d", q.Since))
+	}
+	if q.Until > 0 {
+		values.Set("until", fmt.Sprintf("%d", q.Until))
+	}
+	values.Set("offset", fmt.Sprintf("%d", q.Offset))
+	if q.Limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", q.Limit))
+	}
+	return values.Encode()
+}
+
+func (c *Client) GetAuditEvents(ctx context.Context, query *AuditQuery) (*AuditLog, error) {
+	var result AuditLog
+	if err := c.doJSONRequest(ctx, http.MethodGet, "/api/audit?"+query.encode(), nil, &result, "get audit events"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Admin operations. Reading accounts needs the moderator role, changing them
+// the admin role.
+
+type User struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	Disabled   bool   `json:"disabled"`
+	DisabledAt int64  `json:"disabled_at,omitempty"`
+	// DeletionRequestedAt is set while the account is queued for deletion
+	DeletionRequestedAt int64 `json:"deletion_requested_at,omitempty"`
+	CreatedAt           int64 `json:"created_at"`
+	UpdatedAt           int64 `json:"updated_at"`
+}
+
+type UserList struct {
+	Total  int64  `json:"total"`
+	Offset int64  `json:"offset"`
+	Limit  int64  `json:"limit"`
+	Users  []User `json:"users"`
+}
+
+// UserQuery searches users. Query matches part of a username; a nil Disabled
+// matches both enabled and disabled accounts.
+type UserQuery struct {
+	Query    string
+	Role     string
+	Disabled *bool
+	Offset   int64
+	Limit    int64
+}
+
+func (q *UserQuery) encode() string {
+	values := url.Values{}
+	if q.Query != "" {
+		values.Set("q", q.Query)
+	}
+	if q.Role != "" {
+		values.Set("role", q.Role)
+	}
+	if q.Disabled != nil {
+		values.Set("disabled", fmt.Sprintf("%t", *q.Disabled))
+	}
+	values.Set("offset", fmt.Sprintf("%d", q.Offset))
+	if q.Limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", q.Limit))
+	}
+	return values.Encode()
+}
+
+type StorageUsage struct {
+	Username     string          `json:"username"`
+	Wallpapers   int             `json:"wallpapers"`
+	Files        int             `json:"files"`
+	Bytes        int64           `json:"bytes"`
+	Devices      []DeviceStorage `json:"devices"`
+	MissingFiles int             `json:"missing_files,omitempty"`
+}
+
+type DeviceStorage struct {
+	DeviceID   string `json:"device_id"`
+	Wallpapers int    `json:"wallpapers"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+}
+
+func (c *Client) AdminListUsers(ctx context.Context, query *UserQuery) (*UserList, error) {
+	var result UserList
+	if err := c.doJSONRequest(ctx, http.MethodGet, "/api/admin/users?"+query.encode(), nil, &result, "list users"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) AdminGetUser(ctx context.Context, username string) (*User, error) {
+	var result User
+	if err := c.doJSONRequest(ctx, http.MethodGet, fmt.Sprintf("/api/admin/users/%s", username), nil, &result, "get user"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) AdminGetUserDevices(ctx context.Context, username string) ([]PublisherDevice, error) {
+	var result []PublisherDevice
+	if err := c.doJSONRequest(ctx, http.MethodGet, fmt.Sprintf("/api/admin/users/%s/devices", username), nil, &result, "get user devices"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) AdminGetStorageUsage(ctx context.Context, username string) (*StorageUsage, error) {
+	var result StorageUsage
+	if err := c.doJSONRequest(ctx, http.MethodGet, fmt.Sprintf("/api/admin/users/%s/storage", username), nil, &result, "get storage usage"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) AdminSetUserDisabled(ctx context.Context, username string, disabled bool) (*User, error) {
+	method, action := http.MethodPut, "disable user"
+	if !disabled {
+		method, action = http.MethodDelete, "enable user"
+	}
+	var result User
+	if err := c.doJSONRequest(ctx, method, fmt.Sprintf("/api/admin/users/%s/disabled", username), nil, &result, action); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) AdminSetUserRole(ctx context.Context, username, role string) (*User, error) {
+	var result User
+	input := map[string]string{"role": role}
+	if err := c.doJSONRequest(ctx, http.MethodPut, fmt.Sprintf("/api/admin/users/%s/role", username), input, &result, "set user role"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AdminDeleteUser queues another account for deletion. confirm must be its
+// username.
+func (c *Client) AdminDeleteUser(ctx context.Context, username, confirm string) (*User, error) {
+	var result User
+	input := map[string]string{"confirm": confirm}
+	if err := c.doJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/admin/users/%s", username), input, &result, "delete user"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AdminRotateAPIKey forces a new API key on another user and returns it
+func (c *Client) AdminRotateAPIKey(ctx context.Context, username string) (*RegisterUserResponse, error) {
+	var result RegisterUserResponse
+	if err := c.doJSONRequest(ctx, http.MethodPost, fmt.Sprintf("/api/admin/users/%s/api-key", username), nil, &result, "rotate user api key"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Export operations
+
+// ExportAccount streams a zip archive of the account to w and returns its
+// size
+func (c *Client) ExportAccount(ctx context.Context, w io.Writer) (int64, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/users/me/export", nil, "")
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return 0, fmt.Errorf("export account failed: %s", errResp["error"])
+	}
+
+	return io.Copy(w, resp.Body)
+}
+
+type ArchiveImportReport struct {
+	Devices       int      `json:"devices"`
+	MergedDevices int      `json:"merged_devices"`
+	Wallpapers    int      `json:"wallpapers"`
+	Files         int      `json:"files"`
+	Playlists     int      `json:"playlists"`
+	Subscriptions int      `json:"subscriptions"`
+	Skipped       []string `json:"skipped"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// ImportAccount uploads an export archive to recreate it under this account
+func (c *Client) ImportAccount(ctx context.Context, filePath string) (*ArchiveImportReport, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/users/me/import", file, "application/zip")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("import account failed: %s", errResp["error"])
+	}
+
+	var result ArchiveImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	tusVersion = "1.0.0"
+
+	// DefaultChunkSize is how much of the file each PATCH request carries
+	DefaultChunkSize = 4 << 20
+	// DefaultMaxRetries is how many consecutive failures an upload tolerates
+	// before giving up
+	DefaultMaxRetries = 8
+)
+
+// errUploadGone means the server no longer knows the upload and it has to be
+// started over
+var errUploadGone = errors.New("upload no longer exists on the server")
+
+// ResumableUploader uploads files in chunks using the tus protocol. Progress
+// is persisted in the state directory, so an upload interrupted by a network failure
+// or a restart picks up where it left off.
+type ResumableUploader struct {
+	client     *Client
+	stateDir   string
+	ChunkSize  int64
+	MaxRetries int
+}
+
+func NewResumableUploader(client *Client, stateDir string) *ResumableUploader {
+	return &ResumableUploader{
+		client:     client,
+		stateDir:   filepath.Join(stateDir, "uploads"),
+		ChunkSize:  DefaultChunkSize,
+		MaxRetries: DefaultMaxRetries,
+	}
+}
+
+// uploadState is what's remembered about an in-progress upload
+type uploadState struct {
+	Location string `json:"location"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mod_time"`
+	Offset   int64  `json:"offset"`
+}
+
+// Upload sends filePath to the server, resuming a previous attempt for the
+// same unchanged file if there is one
+func (u *ResumableUploader) Upload(ctx context.Context, filePath string) (*UploadWallpaperResponse, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	statePath, err := u.statePath(filePath, info)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := u.loadState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := 0
+	for {
+		if state == nil {
+			location, err := u.create(ctx, filepath.Base(filePath), info.Size())
+			if err != nil {
+				return nil, err
+			}
+			state = &uploadState{
+				Location: location,
+				Path:     filePath,
+				Size:     info.Size(),
+				ModTime:  info.ModTime().Unix(),
+			}
+			if err := u.saveState(statePath, state); err != nil {
+				return nil, err
+			}
+		}
+
+		filename, err := u.resume(ctx, file, state, statePath)
+		if err == nil {
+			os.Remove(statePath)
+			return &UploadWallpaperResponse{Filename: filename}, nil
+		}
+		if errors.Is(err, errUploadGone) {
+			// Start a new upload, counting it as a failure so a server that
+			// keeps forgetting uploads can't loop forever
+			os.Remove(statePath)
+			state = nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			os.Remove(statePath)
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		failures++
+		if failures > u.MaxRetries {
+			return nil, fmt.Errorf("upload failed after %d attempts: %w", failures, err)
+		}
+
+		// Exponential backoff capped at a minute
+		backoff := min(time.Duration(1<<(failures-1))*time.Second, time.Minute)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// resume syncs the offset with the server and sends the remaining chunks,
+// returning the stored filename once the server has the whole file
+func (u *ResumableUploader) resume(ctx context.Context, file *os.File, state *uploadState, statePath string) (string, error) {
+	offset, filename, err := u.head(ctx, state.Location)
+	if err != nil {
+		return "", err
+	}
+
+	for filename == "" {
+		chunk := min(u.ChunkSize, state.Size-offset)
+		offset, filename, err = u.patch(ctx, state.Location, io.NewSectionReader(file, offset, chunk), offset, chunk)
+		if err != nil {
+			return "", err
+		}
+
+		state.Offset = offset
+		if err := u.saveState(statePath, state); err != nil {
+			return "", err
+		}
+	}
+	return filename, nil
+}
+
+func (u *ResumableUploader) create(ctx context.Context, name string, size int64) (string, error) {
+	req, err := u.client.newRequest(ctx, http.MethodPost, "/api/files/uploads", nil, "")
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(name)))
+
+	resp, err := u.client.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return "", fmt.Errorf("create upload failed: %s", errResp["error"])
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("create upload failed: server returned no location")
+	}
+	return location, nil
+}
+
+func (u *ResumableUploader) head(ctx context.Context, location string) (int64, string, error) {
+	req, err := u.client.newRequest(ctx, http.MethodHead, location, nil, "")
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+
+	resp, err := u.client.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return 0, "", errUploadGone
+	default:
+		return 0, "", fmt.Errorf("get upload offset failed: %s", resp.Status)
+	}
+
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("get upload offset failed: invalid Upload-Offset")
+	}
+	return offset, resp.Header.Get("Wallstream-Filename"), nil
+}
+
+func (u *ResumableUploader) patch(ctx context.Context, location string, chunk io.Reader, offset, length int64) (int64, string, error) {
+	req, err := u.client.newRequest(ctx, http.MethodPatch, location, chunk, "application/offset+octet-stream")
+	if err != nil {
+		return 0, "", err
+	}
+	req.ContentLength = length
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	resp, err := u.client.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+	case http.StatusNotFound, http.StatusGone:
+		return 0, "", errUploadGone
+	default:
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+			// The server rejected the file itself; retrying won't help
+			return 0, "", &permanentError{fmt.Errorf("upload chunk failed: %s", errResp["error"])}
+		}
+		return 0, "", fmt.Errorf("upload chunk failed: %s", errResp["error"])
+	}
+
+	newOffset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("upload chunk failed: invalid Upload-Offset")
+	}
+	return newOffset, resp.Header.Get("Wallstream-Filename"), nil
+}
+
+// statePath names the state file after the file's path, size and
+// modification time, so editing the file starts a fresh upload
+func (u *ResumableUploader) statePath(filePath string, info os.FileInfo) (string, error) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", abs, info.Size(), info.ModTime().UnixNano())))
+	return filepath.Join(u.stateDir, hex.EncodeToString(key[:16])+".json"), nil
+}
+
+func (u *ResumableUploader) loadState(path string) (*uploadState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state uploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		// A corrupt state file just means starting over
+		os.Remove(path)
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (u *ResumableUploader) saveState(path string, state *uploadState) error {
+	if err := os.MkdirAll(u.stateDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a crash never leaves a half-written state file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// permanentError marks failures that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
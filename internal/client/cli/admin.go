@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(adminUsersCmd)
+	adminUsersCmd.AddCommand(adminUsersListCmd)
+	adminUsersCmd.AddCommand(adminUsersGetCmd)
+	adminUsersCmd.AddCommand(adminUsersDevicesCmd)
+	adminUsersCmd.AddCommand(adminUsersStorageCmd)
+	adminUsersCmd.AddCommand(adminUsersDisableCmd)
+	adminUsersCmd.AddCommand(adminUsersEnableCmd)
+	adminUsersCmd.AddCommand(adminUsersSetRoleCmd)
+	adminUsersCmd.AddCommand(adminUsersRotateKeyCmd)
+	adminUsersCmd.AddCommand(adminUsersDeleteCmd)
+
+	adminUsersListCmd.Flags().String("query", "", "Only show users whose username contains this")
+	adminUsersListCmd.Flags().String("role", "", "Only show users with this role: user, moderator or admin")
+	adminUsersListCmd.Flags().Bool("disabled", false, "Only show disabled users")
+	adminUsersListCmd.Flags().Bool("enabled", false, "Only show enabled users")
+	adminUsersListCmd.Flags().Int64("offset", 0, "Number of users to skip")
+	adminUsersListCmd.Flags().Int64("limit", 0, "Maximum number of users to return (default: server default)")
+	adminUsersListCmd.MarkFlagsMutuallyExclusive("disabled", "enabled")
+
+	adminUsersDeleteCmd.Flags().String("confirm", "", "The username again, to confirm the deletion")
+	adminUsersDeleteCmd.MarkFlagRequired("confirm")
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Server administration commands",
+	Long: `Administer the server's accounts. Looking at accounts needs the moderator
+role; disabling or deleting them, changing roles and rotating keys needs the
+admin role. The first admin is made on the server with
+"wallstream-server users create-admin <username>", which prints its API key.`,
+}
+
+var adminUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Account administration commands",
+}
+
+var adminUsersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List and search users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		query := &api.UserQuery{}
+		query.Query, _ = cmd.Flags().GetString("query")
+		query.Role, _ = cmd.Flags().GetString("role")
+		query.Offset, _ = cmd.Flags().GetInt64("offset")
+		query.Limit, _ = cmd.Flags().GetInt64("limit")
+		if disabled, _ := cmd.Flags().GetBool("disabled"); disabled {
+			query.Disabled = &disabled
+		}
+		if enabled, _ := cmd.Flags().GetBool("enabled"); enabled {
+			disabled := false
+			query.Disabled = &disabled
+		}
+
+		users, err := client.AdminListUsers(context.Background(), query)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+
+		printJSONResult(cmd, users)
+		return nil
+	},
+}
+
+var adminUsersGetCmd = &cobra.Command{
+	Use:   "get <username>",
+	Short: "Show a user's account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		user, err := client.AdminGetUser(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		printJSONResult(cmd, user)
+		return nil
+	},
+}
+
+var adminUsersDevicesCmd = &cobra.Command{
+	Use:   "devices <username>",
+	Short: "List a user's devices",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		devices, err := client.AdminGetUserDevices(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get user devices: %w", err)
+		}
+
+		printJSONResult(cmd, devices)
+		return nil
+	},
+}
+
+var adminUsersStorageCmd = &cobra.Command{
+	Use:   "storage <username>",
+	Short: "Show how much storage a user's wallpapers take",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		usage, err := client.AdminGetStorageUsage(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get storage usage: %w", err)
+		}
+
+		printJSONResult(cmd, usage)
+		return nil
+	},
+}
+
+var adminUsersDisableCmd = &cobra.Command{
+	Use:   "disable <username>",
+	Short: "Disable an account",
+	Long:  "Disable an account. Its API key and device tokens stop working until it is enabled again.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setUserDisabled(cmd, args[0], true)
+	},
+}
+
+var adminUsersEnableCmd = &cobra.Command{
+	Use:   "enable <username>",
+	Short: "Enable a disabled account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setUserDisabled(cmd, args[0], false)
+	},
+}
+
+func setUserDisabled(cmd *cobra.Command, username string, disabled bool) error {
+	client, err := newAuthenticatedClient(cmd)
+	if err != nil {
+		return err
+	}
+
+	user, err := client.AdminSetUserDisabled(context.Background(), username, disabled)
+	if err != nil {
+		if disabled {
+			return fmt.Errorf("failed to disable user: %w", err)
+		}
+		return fmt.Errorf("failed to enable user: %w", err)
+	}
+
+	printJSONResult(cmd, user)
+	return nil
+}
+
+var adminUsersSetRoleCmd = &cobra.Command{
+	Use:   "set-role <username> <user|moderator|admin>",
+	Short: "Change a user's role",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		user, err := client.AdminSetUserRole(context.Background(), args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("failed to set user role: %w", err)
+		}
+
+		printJSONResult(cmd, user)
+		return nil
+	},
+}
+
+var adminUsersRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key <username>",
+	Short: "Force a new API key on a user",
+	Long:  "Replace a user's API key, such as when it has leaked. The old key stops working immediately; hand the new one to the user.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		result, err := client.AdminRotateAPIKey(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to rotate api key: %w", err)
+		}
+
+		printJSONResult(cmd, result)
+		return nil
+	},
+}
+
+var adminUsersDeleteCmd = &cobra.Command{
+	Use:   "delete <username> --confirm <username>",
+	Short: "Delete a user's account",
+	Long: `Delete an account along with everything it owns. The account is locked at once
+and removed in the background. This can't be undone.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		confirm, _ := cmd.Flags().GetString("confirm")
+		user, err := client.AdminDeleteUser(context.Background(), args[0], confirm)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		printJSONResult(cmd, user)
+		return nil
+	},
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().String("action", "", "Only show this action, e.g. device.deleted or api_key.rotated")
+	auditCmd.Flags().String("since", "", "Only show events after this time: a duration ago like 24h, or RFC 3339")
+	auditCmd.Flags().String("until", "", "Only show events before this time: a duration ago like 1h, or RFC 3339")
+	auditCmd.Flags().Int64("offset", 0, "Number of events to skip")
+	auditCmd.Flags().Int64("limit", 0, "Maximum number of events to return (default: server default)")
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show your audit log",
+	Long: `Show the security-relevant actions on your account, newest first: registration,
+API key rotation, device tokens, devices, publishes, deletions and subscriptions,
+with the key, IP address and request ID each was made with.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		query := &api.AuditQuery{}
+		query.Action, _ = cmd.Flags().GetString("action")
+		query.Offset, _ = cmd.Flags().GetInt64("offset")
+		query.Limit, _ = cmd.Flags().GetInt64("limit")
+		for name, dst := range map[string]*int64{"since": &query.Since, "until": &query.Until} {
+			raw, _ := cmd.Flags().GetString(name)
+			if raw == "" {
+				continue
+			}
+			t, err := parseAuditTime(raw)
+			if err != nil {
+				return fmt.Errorf("invalid --%s %q: expected a duration like 24h or an RFC 3339 time", name, raw)
+			}
+			*dst = t.Unix()
+		}
+
+		log, err := client.GetAuditEvents(context.Background(), query)
+		if err != nil {
+			return fmt.Errorf("failed to get audit events: %w", err)
+		}
+
+		printJSONResult(cmd, log)
+		return nil
+	},
+}
+
+// parseAuditTime reads a duration into the past or an RFC 3339 time
+func parseAuditTime(raw string) (time.Time, error) {
+	if d, err := time.ParseDuration(raw); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+func init() {
+	rootCmd.AddCommand(browseCmd)
+	rootCmd.AddCommand(searchCmd)
+
+	for _, cmd := range []*cobra.Command{browseCmd, searchCmd} {
+		cmd.Flags().String("sort", "", "Sort by popular or recent (default: popular)")
+		cmd.Flags().Int64("offset", 0, "Number of streams to skip")
+		cmd.Flags().Int64("limit", 0, "Maximum number of streams to return (default: server default)")
+		cmd.Flags().String("color", "", "Only show streams whose current wallpaper has a palette color near this #rrggbb color")
+		cmd.Flags().Float64("tolerance", 0, "Maximum RGB distance from --color (default: server default)")
+	}
+}
+
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Browse public streams",
+	Long:  "List the public streams in the catalog, most popular first unless --sort recent is given.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listStreams(cmd, "")
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>...",
+	Short: "Search public streams",
+	Long:  "Search public streams by name, description and tags, and by the titles, authors and tags of their wallpapers. Every word has to match.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listStreams(cmd, strings.Join(args, " "))
+	},
+}
+
+// listStreams prints a page of the catalog. The catalog is public, so no
+// credentials are required.
+func listStreams(cmd *cobra.Command, query string) error {
+	sort, _ := cmd.Flags().GetString("sort")
+	offset, _ := cmd.Flags().GetInt64("offset")
+	limit, _ := cmd.Flags().GetInt64("limit")
+	baseURL, _ := cmd.Flags().GetString("server")
+	username, _ := cmd.Flags().GetString("username")
+	apiKey, _ := cmd.Flags().GetString("api-key")
+
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	client := newClient(baseURL, username, apiKey)
+	ctx := context.Background()
+
+	page, err := client.ListStreams(ctx, &api.CatalogQuery{Query: query, Sort: sort, Color: colorQueryFromFlags(cmd), Offset: offset, Limit: limit})
+	if err != nil {
+		return fmt.Errorf("failed to list streams: %w", err)
+	}
+
+	output, _ := json.MarshalIndent(page, "", "  ")
+	cmd.Println(string(output))
+	return nil
+}
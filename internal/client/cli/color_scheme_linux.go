@@ -0,0 +1,12 @@
+//go:build linux
+
+package cli
+
+import (
+	"github.io/khosbilegt/wallstream/internal/client/platform"
+	"github.io/khosbilegt/wallstream/internal/client/platform/linux"
+)
+
+func desktopColorScheme() platform.ColorScheme {
+	return linux.NewColorScheme()
+}
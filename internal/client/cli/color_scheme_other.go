@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+
+package cli
+
+import "github.io/khosbilegt/wallstream/internal/client/platform"
+
+// desktopColorScheme returns nil where reading the color scheme isn't
+// implemented yet
+func desktopColorScheme() platform.ColorScheme {
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package cli
+
+import (
+	"github.io/khosbilegt/wallstream/internal/client/platform"
+	"github.io/khosbilegt/wallstream/internal/client/platform/windows"
+)
+
+func desktopColorScheme() platform.ColorScheme {
+	return windows.NewColorScheme()
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	devicesCmd.AddCommand(devicesCertsCmd)
+	devicesCertsCmd.AddCommand(devicesCertsIssueCmd)
+	devicesCertsCmd.AddCommand(devicesCertsListCmd)
+	devicesCertsCmd.AddCommand(devicesCertsRevokeCmd)
+
+	devicesCertsIssueCmd.Flags().String("name", "", "Name to remember the certificate by, e.g. living-room-pc")
+	devicesCertsIssueCmd.Flags().String("out", ".", "Directory to write the key and certificates to")
+}
+
+var devicesCertsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Device client certificate commands",
+	Long: `Manage client certificates for servers running with mutual TLS. A device with
+a certificate can publish to and fetch its own wallpaper with it instead of a
+username and API key; everything else still needs the API key:
+
+  wallstream --server https://wallstream.example --ca-cert ca.crt \
+    --client-cert living-room.crt --client-key living-room.key \
+    push living-room wallpaper.jpg`,
+}
+
+var devicesCertsIssueCmd = &cobra.Command{
+	Use:   "issue <device-id>",
+	Short: "Issue a client certificate for a device",
+	Long: `Issue a client certificate for a device. A private key is generated locally and
+only the certificate request is sent to the server. The key, the certificate
+and the server's CA are written to <out>/<device-id>.key, .crt and -ca.crt.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+		deviceID := args[0]
+		name, _ := cmd.Flags().GetString("name")
+		out, _ := cmd.Flags().GetString("out")
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: deviceID},
+		}, key)
+		if err != nil {
+			return fmt.Errorf("failed to create certificate request: %w", err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to encode key: %w", err)
+		}
+
+		certificate, err := client.IssueDeviceCertificate(context.Background(), deviceID, name,
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})))
+		if err != nil {
+			return fmt.Errorf("failed to issue device certificate: %w", err)
+		}
+
+		if err := os.MkdirAll(out, 0700); err != nil {
+			return err
+		}
+		files := []struct {
+			path string
+			data []byte
+			perm os.FileMode
+		}{
+			{filepath.Join(out, deviceID+".key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600},
+			{filepath.Join(out, deviceID+".crt"), []byte(certificate.Certificate), 0644},
+			{filepath.Join(out, deviceID+"-ca.crt"), []byte(certificate.CACertificate), 0644},
+		}
+		for _, f := range files {
+			if err := os.WriteFile(f.path, f.data, f.perm); err != nil {
+				return fmt.Errorf("failed to write %s: %w", f.path, err)
+			}
+			cmd.Printf("Wrote %s\n", f.path)
+		}
+
+		certificate.Certificate, certificate.CACertificate = "", ""
+		printJSONResult(cmd, certificate)
+		return nil
+	},
+}
+
+var devicesCertsListCmd = &cobra.Command{
+	Use:   "list <device-id>",
+	Short: "List a device's client certificates",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		certificates, err := client.GetDeviceCertificates(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to list device certificates: %w", err)
+		}
+
+		printJSONResult(cmd, certificates)
+		return nil
+	},
+}
+
+var devicesCertsRevokeCmd = &cobra.Command{
+	Use:   "revoke <device-id> <certificate-id>",
+	Short: "Revoke a client certificate",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		if err := client.RevokeDeviceCertificate(context.Background(), args[0], args[1]); err != nil {
+			return fmt.Errorf("failed to revoke device certificate: %w", err)
+		}
+
+		cmd.Printf("Certificate %s revoked successfully\n", args[1])
+		return nil
+	},
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	devicesCmd.AddCommand(devicesTokensCmd)
+	devicesTokensCmd.AddCommand(devicesTokensCreateCmd)
+	devicesTokensCmd.AddCommand(devicesTokensListCmd)
+	devicesTokensCmd.AddCommand(devicesTokensRevokeCmd)
+
+	devicesTokensCreateCmd.Flags().String("name", "", "Name to remember the token by, e.g. ci-dashboard")
+}
+
+var devicesTokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Inbound publish token commands",
+	Long: `Manage inbound tokens that can publish to one device and do nothing else, for
+automation that shouldn't hold your API key. Publish by POSTing the image, a
+multipart form with a file part, or JSON like {"url": "https://..."} to
+/api/inbound/wallpaper with an "Authorization: Bearer <token>" header, e.g.
+
+  curl -H "Authorization: Bearer $TOKEN" --data-binary @dashboard.png \
+    http://localhost:8080/api/inbound/wallpaper`,
+}
+
+var devicesTokensCreateCmd = &cobra.Command{
+	Use:   "create <device-id>",
+	Short: "Create an inbound token for a device",
+	Long:  "Create an inbound token for a device. The token is only shown in this command's output.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		name, _ := cmd.Flags().GetString("name")
+		token, err := client.CreateDeviceToken(context.Background(), args[0], name)
+		if err != nil {
+			return fmt.Errorf("failed to create device token: %w", err)
+		}
+
+		printJSONResult(cmd, token)
+		return nil
+	},
+}
+
+var devicesTokensListCmd = &cobra.Command{
+	Use:   "list <device-id>",
+	Short: "List a device's inbound tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		tokens, err := client.GetDeviceTokens(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to list device tokens: %w", err)
+		}
+
+		printJSONResult(cmd, tokens)
+		return nil
+	},
+}
+
+var devicesTokensRevokeCmd = &cobra.Command{
+	Use:   "revoke <device-id> <token-id>",
+	Short: "Revoke an inbound token",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		if err := client.RevokeDeviceToken(context.Background(), args[0], args[1]); err != nil {
+			return fmt.Errorf("failed to revoke device token: %w", err)
+		}
+
+		cmd.Printf("Token %s revoked successfully\n", args[1])
+		return nil
+	},
+}
@@ -16,6 +16,18 @@ func init() {
 	devicesCmd.AddCommand(devicesGetCmd)
 	devicesCmd.AddCommand(devicesDeleteCmd)
 	devicesCmd.AddCommand(devicesUploadURLCmd)
+	devicesCmd.AddCommand(devicesRetentionCmd)
+	devicesCmd.AddCommand(devicesStreamCmd)
+
+	devicesRetentionCmd.Flags().Int("keep-last", 0, "Keep the N most recent wallpapers (0: no limit)")
+	devicesRetentionCmd.Flags().Int("keep-days", 0, "Keep wallpapers published in the last D days (0: no limit)")
+	devicesRetentionCmd.Flags().Bool("keep-pinned", true, "Never prune pinned wallpapers")
+	devicesRetentionCmd.Flags().Bool("clear", false, "Remove the retention policy and keep everything")
+
+	devicesStreamCmd.Flags().Bool("public", false, "List the device in the public catalog")
+	devicesStreamCmd.Flags().String("name", "", "Stream name shown in the catalog (default: the device ID)")
+	devicesStreamCmd.Flags().String("description", "", "Stream description shown in the catalog")
+	devicesStreamCmd.Flags().StringArray("tag", nil, "Stream tag (repeatable)")
 }
 
 var devicesCmd = &cobra.Command{
@@ -38,11 +50,11 @@ var devicesCreateCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
 		result, err := client.CreatePublisherDevice(ctx, deviceID)
@@ -68,11 +80,11 @@ var devicesListCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
 		devices, err := client.GetPublisherDevices(ctx)
@@ -100,11 +112,11 @@ var devicesGetCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
 		device, err := client.GetPublisherDeviceByDeviceID(ctx, deviceID)
@@ -132,11 +144,11 @@ var devicesDeleteCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
 		if err := client.DeletePublisherDeviceByDeviceID(ctx, deviceID); err != nil {
@@ -162,11 +174,11 @@ var devicesUploadURLCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
 		result, err := client.GetUploadURL(ctx, deviceID)
@@ -179,3 +191,88 @@ var devicesUploadURLCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var devicesRetentionCmd = &cobra.Command{
+	Use:   "retention <device-id>",
+	Short: "Set a device's retention policy",
+	Long: `Set how much wallpaper history a device keeps. A wallpaper is kept if any
+rule keeps it, and the current wallpaper is never pruned.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		keepLast, _ := cmd.Flags().GetInt("keep-last")
+		keepDays, _ := cmd.Flags().GetInt("keep-days")
+		keepPinned, _ := cmd.Flags().GetBool("keep-pinned")
+		clear, _ := cmd.Flags().GetBool("clear")
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		var policy *api.RetentionPolicy
+		if !clear {
+			policy = &api.RetentionPolicy{KeepLast: keepLast, KeepDays: keepDays, KeepPinned: keepPinned}
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		device, err := client.UpdateRetentionPolicy(ctx, deviceID, policy)
+		if err != nil {
+			return fmt.Errorf("failed to update retention policy: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(device, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
+
+var devicesStreamCmd = &cobra.Command{
+	Use:   "stream <device-id>",
+	Short: "Set how a device appears in the public catalog",
+	Long: `Make a device a public stream that anyone can find with browse/search and
+subscribe to, or private again without --public. The name, description and tags
+are replaced by the ones given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		public, _ := cmd.Flags().GetBool("public")
+		name, _ := cmd.Flags().GetString("name")
+		description, _ := cmd.Flags().GetString("description")
+		tags, _ := cmd.Flags().GetStringArray("tag")
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		device, err := client.UpdateStreamSettings(ctx, deviceID, &api.StreamSettings{
+			Public:      public,
+			Name:        name,
+			Description: description,
+			Tags:        tags,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update stream settings: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(device, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+
+	exportCmd.Flags().StringP("output", "o", "wallstream-export.zip", "File to write the archive to, or - for stdout")
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Download an archive of your account",
+	Long: `Download a zip archive of your account: your user record, devices, publish
+history, playlists, subscriptions and the original image files. API keys, device
+tokens and webhooks are left out. Load it into another server with import.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "-" {
+			if _, err := client.ExportAccount(context.Background(), cmd.OutOrStdout()); err != nil {
+				return fmt.Errorf("failed to export account: %w", err)
+			}
+			return nil
+		}
+
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		size, err := client.ExportAccount(context.Background(), file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(output)
+			return fmt.Errorf("failed to export account: %w", err)
+		}
+
+		cmd.Printf("Exported %d bytes to %s\n", size, output)
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <archive.zip>",
+	Short: "Recreate an exported account on this server",
+	Long: `Upload an archive made by export to recreate its devices, wallpapers, playlists
+and subscriptions under your account. Devices you already have get the
+wallpapers they are missing; devices someone else owns here are skipped.
+Running it again only fills in what failed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		report, err := client.ImportAccount(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to import account: %w", err)
+		}
+
+		printJSONResult(cmd, report)
+		return nil
+	},
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client"
 	"github.io/khosbilegt/wallstream/internal/client/api"
 )
 
 func init() {
 	rootCmd.AddCommand(filesCmd)
 	filesCmd.AddCommand(filesUploadCmd)
+
+	filesUploadCmd.Flags().Bool("resumable", true, "Upload in chunks and resume after interruptions")
+	filesUploadCmd.Flags().Int64("chunk-size", api.DefaultChunkSize, "Chunk size in bytes for resumable uploads")
 }
 
 var filesCmd = &cobra.Command{
@@ -23,8 +27,10 @@ var filesCmd = &cobra.Command{
 var filesUploadCmd = &cobra.Command{
 	Use:   "upload <file-path>",
 	Short: "Upload a wallpaper file",
-	Long:  "Upload a wallpaper file to the server.",
-	Args:  cobra.ExactArgs(1),
+	Long: `Upload a wallpaper file to the server. Uploads are resumable by default:
+if the connection drops or the command is interrupted, running it again for
+the same file continues from where it stopped.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filePath := args[0]
 		baseURL, _ := cmd.Flags().GetString("server")
@@ -34,14 +40,31 @@ var filesUploadCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		resumable, _ := cmd.Flags().GetBool("resumable")
+		chunkSize, _ := cmd.Flags().GetInt64("chunk-size")
+
+		apiClient := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
-		result, err := client.UploadWallpaper(ctx, filePath)
+		var result *api.UploadWallpaperResponse
+		var err error
+		if resumable {
+			config, configErr := client.DefaultConfig()
+			if configErr != nil {
+				return fmt.Errorf("failed to load config: %w", configErr)
+			}
+			uploader := api.NewResumableUploader(apiClient, config.CacheDir)
+			if chunkSize > 0 {
+				uploader.ChunkSize = chunkSize
+			}
+			result, err = uploader.Upload(ctx, filePath)
+		} else {
+			result, err = apiClient.UploadWallpaper(ctx, filePath)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to upload file: %w", err)
 		}
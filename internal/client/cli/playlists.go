@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+func init() {
+	rootCmd.AddCommand(playlistsCmd)
+	playlistsCmd.AddCommand(playlistsCreateCmd)
+	playlistsCmd.AddCommand(playlistsListCmd)
+	playlistsCmd.AddCommand(playlistsGetCmd)
+	playlistsCmd.AddCommand(playlistsUpdateCmd)
+	playlistsCmd.AddCommand(playlistsDeleteCmd)
+	playlistsCmd.AddCommand(playlistsNextCmd)
+	playlistsCmd.AddCommand(playlistsEnableCmd)
+	playlistsCmd.AddCommand(playlistsDisableCmd)
+
+	for _, cmd := range []*cobra.Command{playlistsCreateCmd, playlistsUpdateCmd} {
+		cmd.Flags().String("name", "", "Playlist name")
+		cmd.Flags().StringArray("hash", nil, "Wallpaper hash, in order (repeatable)")
+		cmd.Flags().Bool("shuffle", false, "Shuffle the wallpapers on every pass")
+		cmd.Flags().Duration("interval", 0, "Switch wallpapers this often, e.g. 1h")
+		cmd.Flags().String("cron", "", "Switch wallpapers on this cron schedule, e.g. \"0 9 * * *\" or \"CRON_TZ=Europe/Berlin @daily\"")
+		cmd.Flags().Bool("disabled", false, "Save the playlist without running it")
+	}
+}
+
+var playlistsCmd = &cobra.Command{
+	Use:   "playlists",
+	Short: "Playlist management commands",
+	Long: `Manage server-side playlists that rotate a device's wallpaper through its
+published wallpapers on a schedule. Only one playlist per device runs at a time;
+enabling one disables the others.`,
+}
+
+// newAuthenticatedClient reads the global flags every authenticated command
+// needs
+func newAuthenticatedClient(cmd *cobra.Command) (*api.Client, error) {
+	baseURL, _ := cmd.Flags().GetString("server")
+	username, _ := cmd.Flags().GetString("username")
+	apiKey, _ := cmd.Flags().GetString("api-key")
+
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	if !hasCredentials(username, apiKey) {
+		return nil, fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+	}
+	return newClient(baseURL, username, apiKey), nil
+}
+
+func printJSONResult(cmd *cobra.Command, result interface{}) {
+	output, _ := json.MarshalIndent(result, "", "  ")
+	cmd.Println(string(output))
+}
+
+// applyPlaylistFlags copies the playlist flags that were set onto input
+func applyPlaylistFlags(cmd *cobra.Command, input *api.PlaylistInput) {
+	if cmd.Flags().Changed("name") {
+		input.Name, _ = cmd.Flags().GetString("name")
+	}
+	if cmd.Flags().Changed("hash") {
+		input.Hashes, _ = cmd.Flags().GetStringArray("hash")
+	}
+	if cmd.Flags().Changed("shuffle") {
+		input.Shuffle, _ = cmd.Flags().GetBool("shuffle")
+	}
+	if cmd.Flags().Changed("interval") {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		input.Interval, input.Cron = interval.String(), ""
+	}
+	if cmd.Flags().Changed("cron") {
+		input.Cron, _ = cmd.Flags().GetString("cron")
+		input.Interval = ""
+	}
+	if cmd.Flags().Changed("disabled") {
+		disabled, _ := cmd.Flags().GetBool("disabled")
+		enabled := !disabled
+		input.Enabled = &enabled
+	}
+}
+
+// playlistInputFrom turns an existing playlist back into the input that
+// would recreate it, so updates only change what was asked for
+func playlistInputFrom(playlist *api.Playlist) *api.PlaylistInput {
+	input := &api.PlaylistInput{
+		Name:    playlist.Name,
+		Hashes:  playlist.Hashes,
+		Shuffle: playlist.Shuffle,
+		Cron:    playlist.Cron,
+		Enabled: &playlist.Enabled,
+	}
+	if playlist.Interval > 0 {
+		input.Interval = (time.Duration(playlist.Interval) * time.Second).String()
+	}
+	return input
+}
+
+var playlistsCreateCmd = &cobra.Command{
+	Use:   "create <device-id> --hash HASH... (--interval D | --cron EXPR)",
+	Short: "Create a playlist",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		input := &api.PlaylistInput{}
+		applyPlaylistFlags(cmd, input)
+
+		playlist, err := client.CreatePlaylist(context.Background(), args[0], input)
+		if err != nil {
+			return fmt.Errorf("failed to create playlist: %w", err)
+		}
+
+		printJSONResult(cmd, playlist)
+		return nil
+	},
+}
+
+var playlistsListCmd = &cobra.Command{
+	Use:   "list <device-id>",
+	Short: "List a device's playlists",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		playlists, err := client.GetPlaylists(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to list playlists: %w", err)
+		}
+
+		printJSONResult(cmd, playlists)
+		return nil
+	},
+}
+
+var playlistsGetCmd = &cobra.Command{
+	Use:   "get <device-id> <playlist-id>",
+	Short: "Show a playlist",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		playlist, err := client.GetPlaylist(context.Background(), args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("failed to get playlist: %w", err)
+		}
+
+		printJSONResult(cmd, playlist)
+		return nil
+	},
+}
+
+var playlistsUpdateCmd = &cobra.Command{
+	Use:   "update <device-id> <playlist-id>",
+	Short: "Change a playlist",
+	Long:  "Change the given settings of a playlist, keeping the rest. The rotation starts over.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePlaylist(cmd, args[0], args[1], func(input *api.PlaylistInput) {
+			applyPlaylistFlags(cmd, input)
+		})
+	},
+}
+
+var playlistsEnableCmd = &cobra.Command{
+	Use:   "enable <device-id> <playlist-id>",
+	Short: "Start running a playlist",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePlaylist(cmd, args[0], args[1], func(input *api.PlaylistInput) {
+			enabled := true
+			input.Enabled = &enabled
+		})
+	},
+}
+
+var playlistsDisableCmd = &cobra.Command{
+	Use:   "disable <device-id> <playlist-id>",
+	Short: "Stop running a playlist",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePlaylist(cmd, args[0], args[1], func(input *api.PlaylistInput) {
+			enabled := false
+			input.Enabled = &enabled
+		})
+	},
+}
+
+func updatePlaylist(cmd *cobra.Command, deviceID, playlistID string, change func(input *api.PlaylistInput)) error {
+	client, err := newAuthenticatedClient(cmd)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	playlist, err := client.GetPlaylist(ctx, deviceID, playlistID)
+	if err != nil {
+		return fmt.Errorf("failed to get playlist: %w", err)
+	}
+
+	input := playlistInputFrom(playlist)
+	change(input)
+
+	playlist, err = client.UpdatePlaylist(ctx, deviceID, playlistID, input)
+	if err != nil {
+		return fmt.Errorf("failed to update playlist: %w", err)
+	}
+
+	printJSONResult(cmd, playlist)
+	return nil
+}
+
+var playlistsDeleteCmd = &cobra.Command{
+	Use:   "delete <device-id> <playlist-id>",
+	Short: "Delete a playlist",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		if err := client.DeletePlaylist(context.Background(), args[0], args[1]); err != nil {
+			return fmt.Errorf("failed to delete playlist: %w", err)
+		}
+
+		cmd.Printf("Playlist %s deleted successfully\n", args[1])
+		return nil
+	},
+}
+
+var playlistsNextCmd = &cobra.Command{
+	Use:   "next <device-id> <playlist-id>",
+	Short: "Switch to the playlist's next wallpaper now",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		playlist, err := client.SkipPlaylist(context.Background(), args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("failed to skip playlist: %w", err)
+		}
+
+		printJSONResult(cmd, playlist)
+		return nil
+	},
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+	addMetadataFlags(pushCmd)
+	addScheduleFlags(pushCmd)
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push <device-id> <file>",
+	Short: "Upload and publish a wallpaper",
+	Long:  "Upload a wallpaper file and publish it to a device in a single request.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		filePath := args[1]
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		schedule, err := scheduleFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		result, err := client.PushWallpaper(ctx, deviceID, filePath, metadataFromFlags(cmd), schedule)
+		if err != nil {
+			return fmt.Errorf("failed to push wallpaper: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(result, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
@@ -1,12 +1,18 @@
 package cli
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
 )
 
+// tlsConfig is built from the TLS flags before any command runs. It is nil
+// when none are given.
+var tlsConfig *tls.Config
+
 var rootCmd = &cobra.Command{
 	Use:   "wallstream",
 	Short: "Wallstream syncs wallpapers between people",
@@ -14,6 +20,18 @@ var rootCmd = &cobra.Command{
 It runs as a background service and works across Windows, macOS, and Linux.`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		caFile, _ := cmd.Flags().GetString("ca-cert")
+		certFile, _ := cmd.Flags().GetString("client-cert")
+		keyFile, _ := cmd.Flags().GetString("client-key")
+
+		var err error
+		tlsConfig, err = api.LoadTLSConfig(api.TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+		if err != nil {
+			return fmt.Errorf("failed to load TLS settings: %w", err)
+		}
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Default behavior when no subcommand is provided
 		return cmd.Help()
@@ -25,6 +43,23 @@ func init() {
 	rootCmd.PersistentFlags().String("server", "", "Server URL (default: http://localhost:8080)")
 	rootCmd.PersistentFlags().String("username", "", "Username for authentication")
 	rootCmd.PersistentFlags().String("api-key", "", "API key for authentication")
+	rootCmd.PersistentFlags().String("ca-cert", "", "PEM file of a CA to trust for the server's certificate")
+	rootCmd.PersistentFlags().String("client-cert", "", "Device certificate to authenticate with instead of an API key")
+	rootCmd.PersistentFlags().String("client-key", "", "Private key of the device certificate")
+}
+
+// newClient creates an API client that uses the TLS flags
+func newClient(baseURL, username, apiKey string) *api.Client {
+	return api.NewClientWithTLS(baseURL, username, apiKey, tlsConfig)
+}
+
+// hasCredentials reports whether a command can authenticate, either with a
+// username and API key or with a client certificate
+func hasCredentials(username, apiKey string) bool {
+	if tlsConfig != nil && len(tlsConfig.Certificates) > 0 {
+		return true
+	}
+	return username != "" && apiKey != ""
 }
 
 // Execute is the CLI entrypoint
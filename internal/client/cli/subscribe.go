@@ -1,18 +1,90 @@
 package cli
 
-import "github.com/spf13/cobra"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
 
 func init() {
 	rootCmd.AddCommand(subscribeCmd)
+	rootCmd.AddCommand(unsubscribeCmd)
+	rootCmd.AddCommand(subscriptionsCmd)
 }
 
 var subscribeCmd = &cobra.Command{
-	Use:   "subscribe <username>",
-	Short: "Subscribe to a user's wallpaper",
+	Use:   "subscribe <device-id>",
+	Short: "Subscribe to a public stream",
+	Long:  "Subscribe to a public stream found with browse or search.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setSubscribed(cmd, args[0], true)
+	},
+}
+
+var unsubscribeCmd = &cobra.Command{
+	Use:   "unsubscribe <device-id>",
+	Short: "Unsubscribe from a stream",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		username := args[0]
-		cmd.Printf("Subscribing to %s...\n", username)
+		return setSubscribed(cmd, args[0], false)
+	},
+}
+
+var subscriptionsCmd = &cobra.Command{
+	Use:   "subscriptions",
+	Short: "List your subscriptions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		subscriptions, err := client.GetSubscriptions(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list subscriptions: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(subscriptions, "", "  ")
+		cmd.Println(string(output))
 		return nil
 	},
 }
+
+func setSubscribed(cmd *cobra.Command, deviceID string, subscribed bool) error {
+	baseURL, _ := cmd.Flags().GetString("server")
+	username, _ := cmd.Flags().GetString("username")
+	apiKey, _ := cmd.Flags().GetString("api-key")
+
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	if !hasCredentials(username, apiKey) {
+		return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+	}
+
+	client := newClient(baseURL, username, apiKey)
+	ctx := context.Background()
+
+	if err := client.SetSubscribed(ctx, deviceID, subscribed); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	if subscribed {
+		cmd.Printf("Subscribed to %s\n", deviceID)
+	} else {
+		cmd.Printf("Unsubscribed from %s\n", deviceID)
+	}
+	return nil
+}
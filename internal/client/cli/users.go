@@ -6,12 +6,16 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-	"github.io/khosbilegt/wallstream/internal/client/api"
 )
 
 func init() {
 	rootCmd.AddCommand(usersCmd)
 	usersCmd.AddCommand(usersRegisterCmd)
+	usersCmd.AddCommand(usersRotateKeyCmd)
+	usersCmd.AddCommand(usersDeleteCmd)
+
+	usersDeleteCmd.Flags().String("confirm", "", "Your username, to confirm the deletion")
+	usersDeleteCmd.MarkFlagRequired("confirm")
 }
 
 var usersCmd = &cobra.Command{
@@ -32,7 +36,7 @@ var usersRegisterCmd = &cobra.Command{
 			baseURL = "http://localhost:8080"
 		}
 
-		client := api.NewClient(baseURL, "", "")
+		client := newClient(baseURL, "", "")
 		ctx := context.Background()
 
 		result, err := client.RegisterUser(ctx, username)
@@ -46,3 +50,49 @@ var usersRegisterCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var usersRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Replace your API key",
+	Long:  "Issue a new API key for your account. The current key stops working immediately.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		result, err := client.RotateAPIKey(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to rotate api key: %w", err)
+		}
+
+		printJSONResult(cmd, result)
+		cmd.Printf("\nSave your new API key: %s\n", result.APIKey)
+		return nil
+	},
+}
+
+var usersDeleteCmd = &cobra.Command{
+	Use:   "delete --confirm <username>",
+	Short: "Delete your account",
+	Long: `Delete your account along with its devices, wallpapers, files, subscriptions,
+playlists, webhooks and tokens. Your API key stops working at once and the rest
+is removed in the background. This can't be undone.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		confirm, _ := cmd.Flags().GetString("confirm")
+		result, err := client.DeleteAccount(context.Background(), confirm)
+		if err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+
+		printJSONResult(cmd, result)
+		return nil
+	},
+}
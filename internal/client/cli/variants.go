@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
+	"github.io/khosbilegt/wallstream/internal/client/platform"
+	"github.io/khosbilegt/wallstream/internal/client/variant"
+)
+
+// parseVariantSpec parses kind=filename, where kind is a variant kind or the
+// HH:MM a time variant starts at
+func parseVariantSpec(spec string) (api.VariantUpload, error) {
+	kind, filename, ok := strings.Cut(spec, "=")
+	if !ok || filename == "" {
+		return api.VariantUpload{}, fmt.Errorf("invalid variant %q: expected kind=filename", spec)
+	}
+
+	switch kind {
+	case variant.Day, variant.Night, variant.Light, variant.Dark:
+		return api.VariantUpload{Kind: kind, Filename: filename}, nil
+	}
+	if _, err := time.Parse("15:04", kind); err != nil {
+		return api.VariantUpload{}, fmt.Errorf("invalid variant kind %q: expected day, night, light, dark or HH:MM", kind)
+	}
+	return api.VariantUpload{Kind: variant.Time, Start: kind, Filename: filename}, nil
+}
+
+// serveVariant downloads the variant named by choice, or picks one when choice
+// is auto. Wallpapers without a matching variant fall back to the main image.
+//
+// Variants are downloaded by index, so if the wallpaper changes between
+// reading the manifest and the download, the bytes are another wallpaper's.
+// Those fail the hash check and the choice is made again.
+func serveVariant(cmd *cobra.Command, client *api.Client, deviceID, choice string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := serveVariantOnce(cmd, client, deviceID, choice)
+		if !errors.Is(err, errVariantChanged) || attempt > 0 {
+			return data, err
+		}
+	}
+}
+
+var errVariantChanged = errors.New("the wallpaper changed while downloading its variant")
+
+func serveVariantOnce(cmd *cobra.Command, client *api.Client, deviceID, choice string) ([]byte, error) {
+	ctx := context.Background()
+
+	manifest, err := client.GetWallpaperManifest(ctx, deviceID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Variants) == 0 {
+		return client.ServeWallpaper(ctx, deviceID)
+	}
+
+	var selected api.VariantAssignment
+	var ok bool
+	if choice == "auto" {
+		env, err := variantEnvironment(cmd)
+		if err != nil {
+			return nil, err
+		}
+		selected, ok = variant.Select(manifest.Variants, env)
+	} else {
+		for _, v := range manifest.Variants {
+			if v.Kind == choice || (v.Kind == variant.Time && v.Start == choice) {
+				selected, ok = v, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("the current wallpaper has no %s variant", choice)
+		}
+	}
+
+	if !ok {
+		return client.ServeWallpaper(ctx, deviceID)
+	}
+	data, err := client.ServeVariantWallpaper(ctx, deviceID, selected.Index)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != selected.Hash {
+		return nil, errVariantChanged
+	}
+	return data, nil
+}
+
+// variantEnvironment gathers the local time, the configured location and the
+// color scheme preference for picking a variant
+func variantEnvironment(cmd *cobra.Command) (variant.Environment, error) {
+	env := variant.Environment{Now: time.Now()}
+
+	if cmd.Flags().Changed("latitude") || cmd.Flags().Changed("longitude") {
+		latitude, _ := cmd.Flags().GetFloat64("latitude")
+		longitude, _ := cmd.Flags().GetFloat64("longitude")
+		if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return env, fmt.Errorf("invalid --latitude/--longitude %g,%g", latitude, longitude)
+		}
+		env.Location = &variant.Location{Latitude: latitude, Longitude: longitude}
+	}
+
+	scheme, _ := cmd.Flags().GetString("color-scheme")
+	switch scheme {
+	case "light", "dark":
+		dark := scheme == "dark"
+		env.Dark = &dark
+	case "auto":
+		colorScheme := desktopColorScheme()
+		if colorScheme == nil {
+			break
+		}
+		dark, err := colorScheme.PrefersDark()
+		if errors.Is(err, platform.ErrNotSupported) {
+			break
+		}
+		if err != nil {
+			return env, fmt.Errorf("failed to read the desktop color scheme: %w", err)
+		}
+		env.Dark = &dark
+	case "none":
+	default:
+		return env, fmt.Errorf("invalid --color-scheme %q: expected auto, light, dark or none", scheme)
+	}
+
+	return env, nil
+}
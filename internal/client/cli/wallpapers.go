@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.io/khosbilegt/wallstream/internal/client/api"
@@ -17,6 +21,168 @@ func init() {
 	wallpapersCmd.AddCommand(wallpapersGetByDeviceCmd)
 	wallpapersCmd.AddCommand(wallpapersDeleteCmd)
 	wallpapersCmd.AddCommand(wallpapersServeCmd)
+	wallpapersCmd.AddCommand(wallpapersPaletteCmd)
+	wallpapersCmd.AddCommand(wallpapersHistoryCmd)
+	wallpapersCmd.AddCommand(wallpapersRollbackCmd)
+	wallpapersCmd.AddCommand(wallpapersPinCmd)
+	wallpapersCmd.AddCommand(wallpapersUnpinCmd)
+	wallpapersCmd.AddCommand(wallpapersPublishSetCmd)
+	wallpapersCmd.AddCommand(wallpapersManifestCmd)
+	wallpapersCmd.AddCommand(wallpapersEditCmd)
+
+	for _, cmd := range []*cobra.Command{wallpapersPublishCmd, wallpapersPublishSetCmd, wallpapersEditCmd} {
+		addMetadataFlags(cmd)
+	}
+	for _, cmd := range []*cobra.Command{wallpapersPublishCmd, wallpapersPublishSetCmd} {
+		addScheduleFlags(cmd)
+	}
+
+	wallpapersPublishSetCmd.Flags().StringArray("monitor", nil, "Monitor image as index:filename:WIDTHxHEIGHT+X+Y (repeatable)")
+	wallpapersManifestCmd.Flags().Int("monitors", 0, "Number of monitors to lay the wallpaper out for (default: the publisher's layout)")
+	wallpapersServeCmd.Flags().Int("monitor", -1, "Download the image for this publisher monitor index instead")
+	wallpapersServeCmd.Flags().String("variant", "auto", "Variant to download: auto, none (the main image), day, night, light, dark or a time variant's HH:MM")
+	wallpapersServeCmd.Flags().Float64("latitude", 0, "Latitude for picking day or night variants by the sun (default: day is 07:00-19:00)")
+	wallpapersServeCmd.Flags().Float64("longitude", 0, "Longitude for picking day or night variants by the sun")
+	wallpapersServeCmd.Flags().String("color-scheme", "auto", "Color scheme for picking light or dark variants: auto (the desktop's), light, dark or none")
+	wallpapersPublishCmd.Flags().StringArray("variant", nil, "Variant as kind=filename, where kind is day, night, light, dark or HH:MM for a time of day (repeatable)")
+
+	wallpapersHistoryCmd.Flags().Int64("offset", 0, "Number of wallpapers to skip")
+	wallpapersHistoryCmd.Flags().Int64("limit", 0, "Maximum number of wallpapers to return (default: server default)")
+
+	for _, cmd := range []*cobra.Command{wallpapersListCmd, wallpapersGetByDeviceCmd} {
+		cmd.Flags().String("color", "", "Only show wallpapers with a palette color near this #rrggbb color")
+		cmd.Flags().Float64("tolerance", 0, "Maximum RGB distance from --color (default: server default)")
+	}
+}
+
+// colorQueryFromFlags builds a color query from --color/--tolerance, or nil
+// when no color was given
+func colorQueryFromFlags(cmd *cobra.Command) *api.ColorQuery {
+	color, _ := cmd.Flags().GetString("color")
+	if color == "" {
+		return nil
+	}
+	tolerance, _ := cmd.Flags().GetFloat64("tolerance")
+	return &api.ColorQuery{Color: color, Tolerance: tolerance}
+}
+
+func addMetadataFlags(cmd *cobra.Command) {
+	cmd.Flags().String("title", "", "Wallpaper title")
+	cmd.Flags().String("description", "", "Wallpaper description")
+	cmd.Flags().String("source-url", "", "Where the wallpaper came from")
+	cmd.Flags().String("author", "", "Who made the wallpaper")
+	cmd.Flags().String("license", "", "License identifier, e.g. CC-BY-4.0")
+	cmd.Flags().StringArray("tag", nil, "Tag (repeatable)")
+}
+
+// metadataFromFlags builds metadata from the metadata flags, or nil when none
+// were given
+func metadataFromFlags(cmd *cobra.Command) *api.WallpaperMetadata {
+	patch := metadataPatchFromFlags(cmd)
+	if patch == nil {
+		return nil
+	}
+
+	metadata := &api.WallpaperMetadata{}
+	metadata.Title, _ = cmd.Flags().GetString("title")
+	metadata.Description, _ = cmd.Flags().GetString("description")
+	metadata.SourceURL, _ = cmd.Flags().GetString("source-url")
+	metadata.Author, _ = cmd.Flags().GetString("author")
+	metadata.License, _ = cmd.Flags().GetString("license")
+	metadata.Tags, _ = cmd.Flags().GetStringArray("tag")
+	return metadata
+}
+
+// metadataPatchFromFlags builds a patch out of the metadata flags that were
+// explicitly set, or nil when none were
+func metadataPatchFromFlags(cmd *cobra.Command) *api.WallpaperMetadataPatch {
+	var patch api.WallpaperMetadataPatch
+	changed := false
+	for flag, field := range map[string]**string{
+		"title":       &patch.Title,
+		"description": &patch.Description,
+		"source-url":  &patch.SourceURL,
+		"author":      &patch.Author,
+		"license":     &patch.License,
+	} {
+		if cmd.Flags().Changed(flag) {
+			value, _ := cmd.Flags().GetString(flag)
+			*field = &value
+			changed = true
+		}
+	}
+	if cmd.Flags().Changed("tag") {
+		tags, _ := cmd.Flags().GetStringArray("tag")
+		patch.Tags = &tags
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return &patch
+}
+
+func addScheduleFlags(cmd *cobra.Command) {
+	cmd.Flags().String("at", "", "Go live at this time instead of now, e.g. \"2026-01-05 09:00\" or RFC 3339")
+	cmd.Flags().String("until", "", "Put the previous wallpaper back at this time")
+	cmd.Flags().String("tz", "", "Time zone for --at and --until, e.g. Europe/Berlin (default: local time)")
+}
+
+// scheduleTimeLayouts are the formats --at and --until accept. Those without
+// an offset are read in --tz.
+var scheduleTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// scheduleFromFlags builds a schedule from --at/--until, or nil when neither
+// was given
+func scheduleFromFlags(cmd *cobra.Command) (*api.PublishSchedule, error) {
+	at, _ := cmd.Flags().GetString("at")
+	until, _ := cmd.Flags().GetString("until")
+	if at == "" && until == "" {
+		return nil, nil
+	}
+
+	location := time.Local
+	if tz, _ := cmd.Flags().GetString("tz"); tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("invalid --tz: %w", err)
+		}
+	}
+
+	schedule := &api.PublishSchedule{}
+	for _, flag := range []struct {
+		name  string
+		value string
+		field *int64
+	}{
+		{"at", at, &schedule.PublishAt},
+		{"until", until, &schedule.ExpiresAt},
+	} {
+		if flag.value == "" {
+			continue
+		}
+		t, err := parseScheduleTime(flag.value, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", flag.name, err)
+		}
+		*flag.field = t.Unix()
+	}
+	return schedule, nil
+}
+
+func parseScheduleTime(value string, location *time.Location) (time.Time, error) {
+	for _, layout := range scheduleTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time like \"2006-01-02 15:04\"", value)
 }
 
 var wallpapersCmd = &cobra.Command{
@@ -28,8 +194,11 @@ var wallpapersCmd = &cobra.Command{
 var wallpapersPublishCmd = &cobra.Command{
 	Use:   "publish <device-id> <filename>",
 	Short: "Publish an uploaded wallpaper",
-	Long:  "Publish a previously uploaded wallpaper to a device.",
-	Args:  cobra.ExactArgs(2),
+	Long: `Publish a previously uploaded wallpaper to a device. With --at it goes live
+later instead, and with --until the previous wallpaper comes back at that time.
+Uploaded files given with --variant are offered to subscribers as day/night,
+light/dark or time-of-day alternatives.`,
+	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		deviceID := args[0]
 		filename := args[1]
@@ -40,14 +209,29 @@ var wallpapersPublishCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		schedule, err := scheduleFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		specs, _ := cmd.Flags().GetStringArray("variant")
+		variants := make([]api.VariantUpload, 0, len(specs))
+		for _, spec := range specs {
+			v, err := parseVariantSpec(spec)
+			if err != nil {
+				return err
+			}
+			variants = append(variants, v)
+		}
+
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
-		result, err := client.PublishUploadedWallpaper(ctx, deviceID, filename)
+		result, err := client.PublishUploadedWallpaper(ctx, deviceID, filename, variants, metadataFromFlags(cmd), schedule)
 		if err != nil {
 			return fmt.Errorf("failed to publish wallpaper: %w", err)
 		}
@@ -70,14 +254,14 @@ var wallpapersListCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
-		wallpapers, err := client.GetPublishedWallpapers(ctx)
+		wallpapers, err := client.GetPublishedWallpapers(ctx, colorQueryFromFlags(cmd))
 		if err != nil {
 			return fmt.Errorf("failed to list wallpapers: %w", err)
 		}
@@ -102,14 +286,14 @@ var wallpapersGetByDeviceCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
-		wallpapers, err := client.GetPublishedWallpapersByDeviceID(ctx, deviceID)
+		wallpapers, err := client.GetPublishedWallpapersByDeviceID(ctx, deviceID, colorQueryFromFlags(cmd))
 		if err != nil {
 			return fmt.Errorf("failed to get wallpapers: %w", err)
 		}
@@ -134,11 +318,11 @@ var wallpapersDeleteCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
 		if err := client.DeletePublishedWallpaperByHash(ctx, hash); err != nil {
@@ -150,11 +334,52 @@ var wallpapersDeleteCmd = &cobra.Command{
 	},
 }
 
+var wallpapersEditCmd = &cobra.Command{
+	Use:   "edit <hash>",
+	Short: "Edit a published wallpaper's metadata",
+	Long: `Change the title, description, source, author, license or tags of a
+published wallpaper. Only the flags given are changed; pass an empty value to
+clear a field, e.g. --license "" or --tag "".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hash := args[0]
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		patch := metadataPatchFromFlags(cmd)
+		if patch == nil {
+			return fmt.Errorf("nothing to change: give at least one metadata flag")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		result, err := client.UpdateWallpaperMetadata(ctx, hash, patch)
+		if err != nil {
+			return fmt.Errorf("failed to edit wallpaper: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(result, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
+
 var wallpapersServeCmd = &cobra.Command{
 	Use:   "serve <device-id> [output-file]",
 	Short: "Download/serve a wallpaper",
-	Long:  "Download the latest wallpaper for a device. If output-file is provided, saves to file; otherwise prints to stdout.",
-	Args:  cobra.RangeArgs(1, 2),
+	Long: `Download the latest wallpaper for a device. If output-file is provided, saves to file; otherwise prints to stdout.
+When the wallpaper has variants, the one matching the local time, the sun at
+--latitude/--longitude or the desktop's color scheme is downloaded instead.`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		deviceID := args[0]
 		baseURL, _ := cmd.Flags().GetString("server")
@@ -164,14 +389,26 @@ var wallpapersServeCmd = &cobra.Command{
 		if baseURL == "" {
 			baseURL = "http://localhost:8080"
 		}
-		if username == "" || apiKey == "" {
-			return fmt.Errorf("username and api-key are required for authenticated commands")
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
 		}
 
-		client := api.NewClient(baseURL, username, apiKey)
+		client := newClient(baseURL, username, apiKey)
 		ctx := context.Background()
 
-		data, err := client.ServeWallpaper(ctx, deviceID)
+		monitor, _ := cmd.Flags().GetInt("monitor")
+		variantFlag, _ := cmd.Flags().GetString("variant")
+
+		var data []byte
+		var err error
+		switch {
+		case monitor >= 0:
+			data, err = client.ServeMonitorWallpaper(ctx, deviceID, monitor)
+		case variantFlag != "none":
+			data, err = serveVariant(cmd, client, deviceID, variantFlag)
+		default:
+			data, err = client.ServeWallpaper(ctx, deviceID)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to serve wallpaper: %w", err)
 		}
@@ -191,3 +428,292 @@ var wallpapersServeCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var wallpapersPaletteCmd = &cobra.Command{
+	Use:   "palette <device-id>",
+	Short: "Show the color palette of a device's wallpaper",
+	Long:  "Print the dominant colors of the current wallpaper for a device, one #rrggbb per line with a color swatch.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		current, err := currentWallpaper(ctx, client, deviceID)
+		if err != nil {
+			return err
+		}
+
+		for _, hex := range current.Palette {
+			var r, g, b uint8
+			if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b); err != nil {
+				cmd.Println(hex)
+				continue
+			}
+			// 24-bit ANSI background swatch followed by the hex value
+			cmd.Printf("\x1b[48;2;%d;%d;%dm    \x1b[0m %s\n", r, g, b, hex)
+		}
+		cmd.Printf("luminance: %.3f\n", current.Luminance)
+		return nil
+	},
+}
+
+// currentWallpaper pages through a device's history, newest first, until it
+// finds the current wallpaper, which after a rollback can be an old one
+func currentWallpaper(ctx context.Context, client *api.Client, deviceID string) (*api.PublishedWallpaper, error) {
+	var offset int64
+	for {
+		history, err := client.GetWallpaperHistory(ctx, deviceID, offset, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get wallpapers: %w", err)
+		}
+		if history.CurrentHash == "" {
+			return nil, fmt.Errorf("device %s has no current wallpaper", deviceID)
+		}
+		for i := range history.Wallpapers {
+			if history.Wallpapers[i].Hash == history.CurrentHash {
+				return &history.Wallpapers[i], nil
+			}
+		}
+		offset += int64(len(history.Wallpapers))
+		if len(history.Wallpapers) == 0 || offset >= history.Total {
+			return nil, fmt.Errorf("current wallpaper %s of device %s is not in its history", history.CurrentHash, deviceID)
+		}
+	}
+}
+
+var wallpapersHistoryCmd = &cobra.Command{
+	Use:   "history <device-id>",
+	Short: "Show a device's wallpaper history",
+	Long:  "List the wallpapers published to a device, newest first, along with which one is current.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		offset, _ := cmd.Flags().GetInt64("offset")
+		limit, _ := cmd.Flags().GetInt64("limit")
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		history, err := client.GetWallpaperHistory(ctx, deviceID, offset, limit)
+		if err != nil {
+			return fmt.Errorf("failed to get wallpaper history: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(history, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
+
+var wallpapersRollbackCmd = &cobra.Command{
+	Use:   "rollback <device-id> <hash>",
+	Short: "Make an older wallpaper current again",
+	Long:  "Point a device back at a wallpaper it previously published, identified by its hash.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		hash := args[1]
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		if _, err := client.RollbackWallpaper(ctx, deviceID, hash); err != nil {
+			return fmt.Errorf("failed to roll back wallpaper: %w", err)
+		}
+
+		cmd.Printf("Device %s now serves wallpaper %s\n", deviceID, hash)
+		return nil
+	},
+}
+
+var wallpapersPinCmd = &cobra.Command{
+	Use:   "pin <device-id> <hash>",
+	Short: "Pin a wallpaper",
+	Long:  "Pin a wallpaper so retention policies with keep-pinned never prune it.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setWallpaperPinned(cmd, args[0], args[1], true)
+	},
+}
+
+var wallpapersUnpinCmd = &cobra.Command{
+	Use:   "unpin <device-id> <hash>",
+	Short: "Unpin a wallpaper",
+	Long:  "Unpin a wallpaper so it is subject to the device's retention policy again.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setWallpaperPinned(cmd, args[0], args[1], false)
+	},
+}
+
+func setWallpaperPinned(cmd *cobra.Command, deviceID, hash string, pinned bool) error {
+	baseURL, _ := cmd.Flags().GetString("server")
+	username, _ := cmd.Flags().GetString("username")
+	apiKey, _ := cmd.Flags().GetString("api-key")
+
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	if !hasCredentials(username, apiKey) {
+		return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+	}
+
+	client := newClient(baseURL, username, apiKey)
+	ctx := context.Background()
+
+	if err := client.SetWallpaperPinned(ctx, deviceID, hash, pinned); err != nil {
+		return fmt.Errorf("failed to update pin: %w", err)
+	}
+
+	if pinned {
+		cmd.Printf("Wallpaper %s pinned\n", hash)
+	} else {
+		cmd.Printf("Wallpaper %s unpinned\n", hash)
+	}
+	return nil
+}
+
+// monitorGeometry matches X11-style geometry such as 2560x1440+0+0 or
+// 1920x1080-1920+0
+var monitorGeometry = regexp.MustCompile(`^(\d+)x(\d+)([+-]\d+)([+-]\d+)$`)
+
+// parseMonitorSpec parses index:filename:WIDTHxHEIGHT+X+Y
+func parseMonitorSpec(spec string) (api.MonitorUpload, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		return api.MonitorUpload{}, fmt.Errorf("invalid monitor %q: expected index:filename:WIDTHxHEIGHT+X+Y", spec)
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return api.MonitorUpload{}, fmt.Errorf("invalid monitor index %q", parts[0])
+	}
+
+	m := monitorGeometry.FindStringSubmatch(parts[2])
+	if m == nil {
+		return api.MonitorUpload{}, fmt.Errorf("invalid monitor geometry %q: expected WIDTHxHEIGHT+X+Y", parts[2])
+	}
+	width, _ := strconv.Atoi(m[1])
+	height, _ := strconv.Atoi(m[2])
+	x, _ := strconv.Atoi(m[3])
+	y, _ := strconv.Atoi(m[4])
+
+	return api.MonitorUpload{Filename: parts[1], Index: index, Width: width, Height: height, X: x, Y: y}, nil
+}
+
+var wallpapersPublishSetCmd = &cobra.Command{
+	Use:   "publish-set <device-id> --monitor index:filename:WIDTHxHEIGHT+X+Y...",
+	Short: "Publish one uploaded wallpaper per monitor",
+	Long: `Publish previously uploaded files as a multi-monitor wallpaper set. Give one
+--monitor flag per monitor, e.g. --monitor 0:abc.jpg:2560x1440+0+0. Monitor 0
+(or the lowest index) is the primary monitor.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		specs, _ := cmd.Flags().GetStringArray("monitor")
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+		if len(specs) == 0 {
+			return fmt.Errorf("at least one --monitor is required")
+		}
+
+		schedule, err := scheduleFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		monitors := make([]api.MonitorUpload, 0, len(specs))
+		for _, spec := range specs {
+			monitor, err := parseMonitorSpec(spec)
+			if err != nil {
+				return err
+			}
+			monitors = append(monitors, monitor)
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		result, err := client.PublishWallpaperSet(ctx, deviceID, monitors, metadataFromFlags(cmd), schedule)
+		if err != nil {
+			return fmt.Errorf("failed to publish wallpaper set: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(result, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
+
+var wallpapersManifestCmd = &cobra.Command{
+	Use:   "manifest <device-id>",
+	Short: "Show which image goes on which monitor",
+	Long:  "Show how a device's current wallpaper is laid out across monitors, optionally adapted to a different monitor count.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceID := args[0]
+		monitors, _ := cmd.Flags().GetInt("monitors")
+		baseURL, _ := cmd.Flags().GetString("server")
+		username, _ := cmd.Flags().GetString("username")
+		apiKey, _ := cmd.Flags().GetString("api-key")
+
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		if !hasCredentials(username, apiKey) {
+			return fmt.Errorf("username and api-key, or a client certificate, are required for authenticated commands")
+		}
+
+		client := newClient(baseURL, username, apiKey)
+		ctx := context.Background()
+
+		manifest, err := client.GetWallpaperManifest(ctx, deviceID, monitors)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest: %w", err)
+		}
+
+		output, _ := json.MarshalIndent(manifest, "", "  ")
+		cmd.Println(string(output))
+		return nil
+	},
+}
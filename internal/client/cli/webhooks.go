@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+func init() {
+	rootCmd.AddCommand(webhooksCmd)
+	webhooksCmd.AddCommand(webhooksCreateCmd)
+	webhooksCmd.AddCommand(webhooksListCmd)
+	webhooksCmd.AddCommand(webhooksGetCmd)
+	webhooksCmd.AddCommand(webhooksUpdateCmd)
+	webhooksCmd.AddCommand(webhooksDeleteCmd)
+	webhooksCmd.AddCommand(webhooksDeliveriesCmd)
+	webhooksCmd.AddCommand(webhooksRedeliverCmd)
+
+	for _, cmd := range []*cobra.Command{webhooksCreateCmd, webhooksUpdateCmd} {
+		cmd.Flags().String("url", "", "URL the events are POSTed to")
+		cmd.Flags().StringArray("event", nil, "Event to send: wallpaper.published, wallpaper.changed, wallpaper.deleted or subscription.requested (repeatable)")
+		cmd.Flags().Bool("disabled", false, "Save the webhook without sending events")
+	}
+
+	webhooksDeliveriesCmd.Flags().Int64("offset", 0, "Number of deliveries to skip")
+	webhooksDeliveriesCmd.Flags().Int64("limit", 0, "Maximum number of deliveries to return (default: server default)")
+}
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Webhook management commands",
+	Long: `Manage webhooks that receive a signed POST when your wallpapers are published,
+changed or deleted, when someone subscribes to your stream, or when a public
+stream you follow changes. Each request carries an X-Wallstream-Signature header,
+sha256=HMAC-SHA256(secret, timestamp + "." + body) with the timestamp from the
+X-Wallstream-Timestamp header.`,
+}
+
+// applyWebhookFlags copies the webhook flags that were set onto input
+func applyWebhookFlags(cmd *cobra.Command, input *api.WebhookInput) {
+	if cmd.Flags().Changed("url") {
+		input.URL, _ = cmd.Flags().GetString("url")
+	}
+	if cmd.Flags().Changed("event") {
+		input.Events, _ = cmd.Flags().GetStringArray("event")
+	}
+	if cmd.Flags().Changed("disabled") {
+		disabled, _ := cmd.Flags().GetBool("disabled")
+		enabled := !disabled
+		input.Enabled = &enabled
+	}
+}
+
+var webhooksCreateCmd = &cobra.Command{
+	Use:   "create --url URL --event EVENT...",
+	Short: "Register a webhook",
+	Long:  "Register a webhook. The signing secret is only shown in this command's output.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		input := &api.WebhookInput{}
+		applyWebhookFlags(cmd, input)
+
+		webhook, err := client.CreateWebhook(context.Background(), input)
+		if err != nil {
+			return fmt.Errorf("failed to create webhook: %w", err)
+		}
+
+		printJSONResult(cmd, webhook)
+		return nil
+	},
+}
+
+var webhooksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your webhooks",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		webhooks, err := client.GetWebhooks(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to list webhooks: %w", err)
+		}
+
+		printJSONResult(cmd, webhooks)
+		return nil
+	},
+}
+
+var webhooksGetCmd = &cobra.Command{
+	Use:   "get <webhook-id>",
+	Short: "Show a webhook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		webhook, err := client.GetWebhook(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get webhook: %w", err)
+		}
+
+		printJSONResult(cmd, webhook)
+		return nil
+	},
+}
+
+var webhooksUpdateCmd = &cobra.Command{
+	Use:   "update <webhook-id>",
+	Short: "Change a webhook",
+	Long:  "Change the given settings of a webhook, keeping the rest. The secret stays the same.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+
+		webhook, err := client.GetWebhook(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to get webhook: %w", err)
+		}
+
+		input := &api.WebhookInput{URL: webhook.URL, Events: webhook.Events, Enabled: &webhook.Enabled}
+		applyWebhookFlags(cmd, input)
+
+		webhook, err = client.UpdateWebhook(ctx, args[0], input)
+		if err != nil {
+			return fmt.Errorf("failed to update webhook: %w", err)
+		}
+
+		printJSONResult(cmd, webhook)
+		return nil
+	},
+}
+
+var webhooksDeleteCmd = &cobra.Command{
+	Use:   "delete <webhook-id>",
+	Short: "Delete a webhook and its delivery log",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		if err := client.DeleteWebhook(context.Background(), args[0]); err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+
+		cmd.Printf("Webhook %s deleted successfully\n", args[0])
+		return nil
+	},
+}
+
+var webhooksDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries <webhook-id>",
+	Short: "Show a webhook's recent deliveries, newest first",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		offset, _ := cmd.Flags().GetInt64("offset")
+		limit, _ := cmd.Flags().GetInt64("limit")
+
+		deliveries, err := client.GetWebhookDeliveries(context.Background(), args[0], offset, limit)
+		if err != nil {
+			return fmt.Errorf("failed to get webhook deliveries: %w", err)
+		}
+
+		printJSONResult(cmd, deliveries)
+		return nil
+	},
+}
+
+var webhooksRedeliverCmd = &cobra.Command{
+	Use:   "redeliver <webhook-id> <delivery-id>",
+	Short: "Send an earlier delivery again",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAuthenticatedClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		delivery, err := client.RedeliverWebhookDelivery(context.Background(), args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+		}
+
+		printJSONResult(cmd, delivery)
+		return nil
+	},
+}
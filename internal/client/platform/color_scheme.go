@@ -0,0 +1,8 @@
+package platform
+
+type ColorScheme interface {
+	// PrefersDark reports whether the desktop asks applications for a dark
+	// color scheme.
+	// If unsupported, return ErrNotSupported.
+	PrefersDark() (bool, error)
+}
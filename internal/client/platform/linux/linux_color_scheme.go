@@ -0,0 +1,55 @@
+//go:build linux
+
+package linux
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.io/khosbilegt/wallstream/internal/client/platform"
+)
+
+type ColorScheme struct{}
+
+// NewColorScheme creates a reader for the GNOME color scheme setting, which
+// other desktops following the freedesktop appearance settings mirror.
+func NewColorScheme() platform.ColorScheme {
+	return &ColorScheme{}
+}
+
+// PrefersDark reports whether org.gnome.desktop.interface color-scheme is
+// prefer-dark. Older GNOME versions without it are judged by their GTK theme.
+func (c *ColorScheme) PrefersDark() (bool, error) {
+	scheme, err := gsettings("color-scheme")
+	if err != nil {
+		return false, err
+	}
+	switch scheme {
+	case "prefer-dark":
+		return true, nil
+	case "prefer-light":
+		return false, nil
+	}
+
+	theme, err := gsettings("gtk-theme")
+	if err != nil {
+		return false, err
+	}
+	return strings.HasSuffix(strings.ToLower(theme), "-dark"), nil
+}
+
+// gsettings reads a key of org.gnome.desktop.interface, "" if it doesn't exist
+func gsettings(key string) (string, error) {
+	path, err := exec.LookPath("gsettings")
+	if err != nil {
+		return "", platform.ErrNotSupported
+	}
+
+	output, err := exec.Command(path, "get", "org.gnome.desktop.interface", key).Output()
+	if err != nil {
+		// The schema or key is missing on this desktop
+		return "", nil
+	}
+
+	return strings.Trim(strings.TrimSpace(string(output)), "'"), nil
+}
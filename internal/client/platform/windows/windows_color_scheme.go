@@ -0,0 +1,44 @@
+//go:build windows
+
+package windows
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows/registry"
+
+	"github.io/khosbilegt/wallstream/internal/client/platform"
+)
+
+type ColorScheme struct{}
+
+// NewColorScheme creates a reader for the Windows app theme setting.
+func NewColorScheme() platform.ColorScheme {
+	return &ColorScheme{}
+}
+
+// PrefersDark reports whether apps are set to the dark theme.
+func (c *ColorScheme) PrefersDark() (bool, error) {
+	key, err := registry.OpenKey(
+		registry.CURRENT_USER,
+		`Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`,
+		registry.QUERY_VALUE,
+	)
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, platform.ErrNotSupported
+	}
+	if err != nil {
+		return false, err
+	}
+	defer key.Close()
+
+	light, _, err := key.GetIntegerValue("AppsUseLightTheme")
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, platform.ErrNotSupported
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return light == 0, nil
+}
@@ -0,0 +1,72 @@
+package variant
+
+import (
+	"math"
+	"time"
+)
+
+// Location is a point on earth in degrees, north and east positive
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+	// sunAltitude is the sun's center at sunrise and sunset, accounting for
+	// refraction and the sun's radius
+	sunAltitude = -0.833
+	// earthTilt is the obliquity of the ecliptic
+	earthTilt = 23.4397
+)
+
+// SunTimes returns the sunrise and sunset of the solar day closest to t. In a
+// polar night both are zero and polarDay is false; under the midnight sun both
+// are zero and polarDay is true.
+//
+// This is the sunrise equation as used by NOAA, good to about a minute away
+// from the poles.
+func SunTimes(t time.Time, location Location) (sunrise, sunset time.Time, polarDay bool) {
+	julianDate := float64(t.Unix())/86400 + julianUnixEpoch
+
+	// Mean solar noon of the day closest to t
+	n := math.Round(julianDate - julian2000 - 0.0009 + location.Longitude/360)
+	meanNoon := n + 0.0009 - location.Longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*sin(anomaly) + 0.02*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + meanNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*longitude)
+
+	declination := math.Asin(sin(longitude) * sin(earthTilt))
+	latitude := location.Latitude * math.Pi / 180
+	cosHourAngle := (sin(sunAltitude) - math.Sin(latitude)*math.Sin(declination)) / (math.Cos(latitude) * math.Cos(declination))
+	switch {
+	case cosHourAngle > 1:
+		return time.Time{}, time.Time{}, false
+	case cosHourAngle < -1:
+		return time.Time{}, time.Time{}, true
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return julianTime(transit - hourAngle/360), julianTime(transit + hourAngle/360), false
+}
+
+// IsDay reports whether the sun is up at location at t
+func IsDay(t time.Time, location Location) bool {
+	sunrise, sunset, polarDay := SunTimes(t, location)
+	if sunrise.IsZero() {
+		return polarDay
+	}
+	return !t.Before(sunrise) && t.Before(sunset)
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func julianTime(julianDate float64) time.Time {
+	seconds := (julianDate - julianUnixEpoch) * 86400
+	return time.Unix(int64(math.Round(seconds)), 0)
+}
@@ -0,0 +1,115 @@
+package variant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSunTimes(t *testing.T) {
+	london := Location{Latitude: 51.4779, Longitude: -0.0015}
+	sydney := Location{Latitude: -33.8688, Longitude: 151.2093}
+	newYork := Location{Latitude: 40.7128, Longitude: -74.0060}
+	tromso := Location{Latitude: 69.6492, Longitude: 18.9553}
+
+	// Published almanac times, which are rounded to the minute
+	const tolerance = 3 * time.Minute
+	tests := []struct {
+		name        string
+		location    Location
+		at          string
+		wantSunrise string
+		wantSunset  string
+		wantPolar   bool
+	}{
+		{
+			name:        "london summer solstice",
+			location:    london,
+			at:          "2024-06-21T12:00:00Z",
+			wantSunrise: "2024-06-21T03:43:00Z",
+			wantSunset:  "2024-06-21T20:21:00Z",
+		},
+		{
+			name:        "sydney winter solstice",
+			location:    sydney,
+			at:          "2024-06-21T02:00:00Z",
+			wantSunrise: "2024-06-20T21:00:00Z",
+			wantSunset:  "2024-06-21T06:53:00Z",
+		},
+		{
+			name:        "new york winter solstice",
+			location:    newYork,
+			at:          "2024-12-21T17:00:00Z",
+			wantSunrise: "2024-12-21T12:17:00Z",
+			wantSunset:  "2024-12-21T21:32:00Z",
+		},
+		{
+			name:      "midnight sun",
+			location:  tromso,
+			at:        "2024-06-21T12:00:00Z",
+			wantPolar: true,
+		},
+		{
+			name:     "polar night",
+			location: tromso,
+			at:       "2024-12-21T12:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sunrise, sunset, polarDay := SunTimes(mustTime(t, tt.at), tt.location)
+			if polarDay != tt.wantPolar {
+				t.Errorf("polarDay = %v, want %v", polarDay, tt.wantPolar)
+			}
+			if tt.wantSunrise == "" {
+				if !sunrise.IsZero() || !sunset.IsZero() {
+					t.Errorf("SunTimes = %v, %v, want zero times", sunrise, sunset)
+				}
+				return
+			}
+			for _, check := range []struct {
+				name      string
+				got, want time.Time
+			}{
+				{"sunrise", sunrise, mustTime(t, tt.wantSunrise)},
+				{"sunset", sunset, mustTime(t, tt.wantSunset)},
+			} {
+				if diff := check.got.Sub(check.want).Abs(); diff > tolerance {
+					t.Errorf("%s = %v, want %v", check.name, check.got.UTC(), check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsDay(t *testing.T) {
+	london := Location{Latitude: 51.4779, Longitude: -0.0015}
+	tromso := Location{Latitude: 69.6492, Longitude: 18.9553}
+
+	tests := []struct {
+		at       string
+		location Location
+		want     bool
+	}{
+		{"2024-06-21T03:30:00Z", london, false},
+		{"2024-06-21T04:00:00Z", london, true},
+		{"2024-06-21T20:00:00Z", london, true},
+		{"2024-06-21T20:40:00Z", london, false},
+		{"2024-06-21T00:00:00Z", tromso, true},
+		{"2024-12-21T12:00:00Z", tromso, false},
+	}
+	for _, tt := range tests {
+		if got := IsDay(mustTime(t, tt.at), tt.location); got != tt.want {
+			t.Errorf("IsDay(%s, %+v) = %v, want %v", tt.at, tt.location, got, tt.want)
+		}
+	}
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
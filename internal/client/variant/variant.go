@@ -0,0 +1,113 @@
+// Package variant picks which of a wallpaper's variants a subscriber shows
+package variant
+
+import (
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+const (
+	Day   = "day"
+	Night = "night"
+	Light = "light"
+	Dark  = "dark"
+	Time  = "time"
+)
+
+// Without a location, day is assumed to last from dayStart to dayEnd local
+// time
+const (
+	dayStart = 7 * time.Hour
+	dayEnd   = 19 * time.Hour
+)
+
+// Environment is what the subscriber knows about its surroundings
+type Environment struct {
+	// Now is the current time in the subscriber's time zone
+	Now time.Time
+	// Location enables day and night by the actual sun position. Nil falls
+	// back to fixed hours.
+	Location *Location
+	// Dark is the desktop's color scheme preference, nil when unknown
+	Dark *bool
+}
+
+// Select returns the variant to show, or false to show the main image. An
+// explicit color scheme preference wins, then time variants, then day and
+// night.
+func Select(variants []api.VariantAssignment, env Environment) (api.VariantAssignment, bool) {
+	byKind := map[string]api.VariantAssignment{}
+	var times []api.VariantAssignment
+	for _, v := range variants {
+		if v.Kind == Time {
+			times = append(times, v)
+		} else {
+			byKind[v.Kind] = v
+		}
+	}
+
+	if env.Dark != nil {
+		kind := Light
+		if *env.Dark {
+			kind = Dark
+		}
+		if v, ok := byKind[kind]; ok {
+			return v, true
+		}
+	}
+
+	if v, ok := selectTime(times, env.Now); ok {
+		return v, true
+	}
+
+	_, hasDay := byKind[Day]
+	_, hasNight := byKind[Night]
+	if hasDay || hasNight {
+		kind := Night
+		if isDay(env) {
+			kind = Day
+		}
+		v, ok := byKind[kind]
+		return v, ok
+	}
+	return api.VariantAssignment{}, false
+}
+
+// selectTime picks the time variant that started last before now. Before the
+// first start of the day, the last one from the day before is still showing.
+func selectTime(times []api.VariantAssignment, now time.Time) (api.VariantAssignment, bool) {
+	var latest, current api.VariantAssignment
+	var latestStart, currentStart time.Duration = -1, -1
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+	for _, v := range times {
+		start, err := time.Parse("15:04", v.Start)
+		if err != nil {
+			continue
+		}
+		offset := time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+		if offset > latestStart {
+			latest, latestStart = v, offset
+		}
+		if offset <= sinceMidnight && offset > currentStart {
+			current, currentStart = v, offset
+		}
+	}
+
+	switch {
+	case currentStart >= 0:
+		return current, true
+	case latestStart >= 0:
+		return latest, true
+	}
+	return api.VariantAssignment{}, false
+}
+
+func isDay(env Environment) bool {
+	if env.Location != nil {
+		return IsDay(env.Now, *env.Location)
+	}
+	sinceMidnight := time.Duration(env.Now.Hour())*time.Hour + time.Duration(env.Now.Minute())*time.Minute
+	return sinceMidnight >= dayStart && sinceMidnight < dayEnd
+}
@@ -0,0 +1,85 @@
+package variant
+
+import (
+	"testing"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/client/api"
+)
+
+func TestSelectTime(t *testing.T) {
+	morning := api.VariantAssignment{Index: 0, Kind: Time, Start: "06:00", Hash: "morning"}
+	evening := api.VariantAssignment{Index: 1, Kind: Time, Start: "18:30", Hash: "evening"}
+	late := api.VariantAssignment{Index: 2, Kind: Time, Start: "23:00", Hash: "late"}
+	broken := api.VariantAssignment{Index: 3, Kind: Time, Start: "6pm", Hash: "broken"}
+
+	tests := []struct {
+		name    string
+		times   []api.VariantAssignment
+		now     string
+		want    string
+		wantErr bool
+	}{
+		{name: "at a start", times: []api.VariantAssignment{morning, evening}, now: "06:00", want: "morning"},
+		{name: "between starts", times: []api.VariantAssignment{morning, evening}, now: "12:15", want: "morning"},
+		{name: "after the last start", times: []api.VariantAssignment{morning, evening}, now: "21:00", want: "evening"},
+		{name: "order doesn't matter", times: []api.VariantAssignment{late, evening, morning}, now: "19:00", want: "evening"},
+		{name: "before the first start wraps to yesterday's last", times: []api.VariantAssignment{evening, morning, late}, now: "05:59", want: "late"},
+		{name: "wraps with a single variant", times: []api.VariantAssignment{evening}, now: "00:00", want: "evening"},
+		{name: "unparseable starts are ignored", times: []api.VariantAssignment{broken, morning}, now: "20:00", want: "morning"},
+		{name: "only unparseable starts", times: []api.VariantAssignment{broken}, now: "20:00", wantErr: true},
+		{name: "no variants", now: "20:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock, err := time.Parse("15:04", tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Date(2024, 3, 1, clock.Hour(), clock.Minute(), 0, 0, time.Local)
+
+			got, ok := selectTime(tt.times, now)
+			if ok == tt.wantErr {
+				t.Fatalf("selectTime at %s found %v, want %v", tt.now, ok, !tt.wantErr)
+			}
+			if got.Hash != tt.want {
+				t.Errorf("selectTime at %s = %q, want %q", tt.now, got.Hash, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	dark, light := true, false
+	variants := []api.VariantAssignment{
+		{Index: 0, Kind: Day, Hash: "day"},
+		{Index: 1, Kind: Night, Hash: "night"},
+		{Index: 2, Kind: Dark, Hash: "dark"},
+	}
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	midnight := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		variants []api.VariantAssignment
+		env      Environment
+		want     string
+	}{
+		{name: "color scheme wins", variants: variants, env: Environment{Now: noon, Dark: &dark}, want: "dark"},
+		{name: "missing scheme variant falls through", variants: variants, env: Environment{Now: noon, Dark: &light}, want: "day"},
+		{name: "day by fixed hours", variants: variants, env: Environment{Now: noon}, want: "day"},
+		{name: "night by fixed hours", variants: variants, env: Environment{Now: midnight}, want: "night"},
+		{name: "only a day variant at night", variants: variants[:1], env: Environment{Now: midnight}, want: ""},
+		{name: "no variants", env: Environment{Now: noon}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Select(tt.variants, tt.env)
+			if ok != (tt.want != "") || got.Hash != tt.want {
+				t.Errorf("Select = %q (%v), want %q", got.Hash, ok, tt.want)
+			}
+		})
+	}
+}
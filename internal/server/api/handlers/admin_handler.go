@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+// AdminHandlers serve /api/admin. Routes must be behind AuthMiddleware and
+// RequireRole.
+type AdminHandlers struct {
+	adminService *service.AdminService
+}
+
+func NewAdminHandlers(adminService *service.AdminService) *AdminHandlers {
+	return &AdminHandlers{adminService: adminService}
+}
+
+// List users ordered by username. Supports ?q= to search usernames, ?role=,
+// ?disabled=true|false and ?offset=&limit=.
+func (h *AdminHandlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	offset, limit, err := paginationFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	var disabled *bool
+	if raw := query.Get("disabled"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid disabled " + strconv.Quote(raw),
+			})
+			return
+		}
+		disabled = &v
+	}
+
+	users, err := h.adminService.ListUsers(r.Context(), query.Get("q"), query.Get("role"), disabled, offset, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, users)
+}
+
+func (h *AdminHandlers) GetUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	user, err := h.adminService.GetUser(r.Context(), chi.URLParam(r, "username"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (h *AdminHandlers) GetUserDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	publisherDevices, err := h.adminService.GetUserDevices(r.Context(), chi.URLParam(r, "username"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, publisherDevices)
+}
+
+func (h *AdminHandlers) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	usage, err := h.adminService.GetStorageUsage(r.Context(), chi.URLParam(r, "username"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, usage)
+}
+
+// Disable an account with PUT, enable it again with DELETE
+func (h *AdminHandlers) SetUserDisabled(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	user, err := h.adminService.SetDisabled(r.Context(), chi.URLParam(r, "username"), r.Method == http.MethodPut)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (h *AdminHandlers) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	user, err := h.adminService.SetRole(r.Context(), chi.URLParam(r, "username"), req.Role)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+// Queue another account for deletion. The body must be
+// {"confirm": "<username>"}.
+func (h *AdminHandlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	var req struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	user, err := h.adminService.DeleteUser(r.Context(), chi.URLParam(r, "username"), req.Confirm)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+// Force a new API key on an account. The new key is returned to hand over to
+// its owner.
+func (h *AdminHandlers) RotateUserAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+	apiKey, err := h.adminService.RotateAPIKey(r.Context(), username)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"username": username, "api_key": apiKey})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+type AuditHandlers struct {
+	auditService *service.AuditService
+}
+
+func NewAuditHandlers(auditService *service.AuditService) *AuditHandlers {
+	return &AuditHandlers{auditService: auditService}
+}
+
+// List the caller's audit events, newest first. Supports ?action= and
+// ?since=/?until= as unix timestamps, along with ?offset=&limit=.
+func (h *AuditHandlers) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	offset, limit, err := paginationFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.AuditEventFilter{Action: query.Get("action")}
+	for name, dst := range map[string]*int64{"since": &filter.Since, "until": &filter.Until} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid " + name + " " + strconv.Quote(raw),
+			})
+			return
+		}
+		*dst = v
+	}
+
+	events, err := h.auditService.GetEvents(r.Context(), userID, filter, offset, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+type CatalogHandlers struct {
+	catalogService *service.CatalogService
+}
+
+func NewCatalogHandlers(catalogService *service.CatalogService) *CatalogHandlers {
+	return &CatalogHandlers{catalogService: catalogService}
+}
+
+// List public streams. Supports ?q= search, ?sort=popular|recent,
+// ?color=#rrggbb&tolerance= to match the current wallpaper's palette and the
+// usual ?offset=/?limit= pagination.
+func (h *CatalogHandlers) ListStreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	offset, limit, err := paginationFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	colorFilter, err := colorFilterFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	page, err := h.catalogService.ListStreams(r.Context(), &service.CatalogQuery{
+		Query:  r.URL.Query().Get("q"),
+		Sort:   r.URL.Query().Get("sort"),
+		Color:  colorFilter,
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *CatalogHandlers) ServeStreamThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	thumbnailPath, err := h.catalogService.GetStreamThumbnail(r.Context(), deviceID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	http.ServeFile(w, r, thumbnailPath)
+}
+
+// Serve a thumbnail of the current wallpaper of one of the user's devices or
+// a public stream
+func (h *CatalogHandlers) ServeDeviceThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	thumbnailPath, err := h.catalogService.GetDeviceThumbnail(r.Context(), userID, chi.URLParam(r, "deviceID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	http.ServeFile(w, r, thumbnailPath)
+}
+
+func (h *CatalogHandlers) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	subscriptions, err := h.catalogService.GetSubscriptions(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, subscriptions)
+}
+
+// Subscribe to a public stream with PUT, unsubscribe with DELETE
+func (h *CatalogHandlers) SetSubscribed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := h.catalogService.Unsubscribe(r.Context(), userID, deviceID); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Unsubscribed successfully",
+		})
+		return
+	}
+
+	subscription, err := h.catalogService.Subscribe(r.Context(), userID, deviceID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, subscription)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+// Issue a client certificate for a device. The body is
+// {"csr": "<PEM certificate request>", "name": "..."}; the response carries
+// the certificate and the CA that issued it.
+func (h *PublisherHandlers) IssueDeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+		CSR  string `json:"csr"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInboundJSONSize)).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	certificate, err := h.publisherService.IssueDeviceCertificate(r.Context(), userID, chi.URLParam(r, "deviceID"), req.Name, req.CSR)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, certificate)
+}
+
+func (h *PublisherHandlers) GetDeviceCertificates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	certificates, err := h.publisherService.GetDeviceCertificates(r.Context(), userID, chi.URLParam(r, "deviceID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, certificates)
+}
+
+func (h *PublisherHandlers) RevokeDeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	certificateID := chi.URLParam(r, "certificateID")
+	if err := h.publisherService.RevokeDeviceCertificate(r.Context(), userID, chi.URLParam(r, "deviceID"), certificateID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Certificate revoked successfully",
+	})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+// maxInboundJSONSize bounds a JSON inbound publish, which only names an image
+// URL
+const maxInboundJSONSize = 64 << 10
+
+// Issue an inbound token for a device. The response carries the token, which
+// isn't shown again.
+func (h *PublisherHandlers) CreateDeviceToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	token, err := h.publisherService.CreateDeviceToken(r.Context(), userID, chi.URLParam(r, "deviceID"), req.Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, token)
+}
+
+func (h *PublisherHandlers) GetDeviceTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	tokens, err := h.publisherService.GetDeviceTokens(r.Context(), userID, chi.URLParam(r, "deviceID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (h *PublisherHandlers) RevokeDeviceToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	tokenID := chi.URLParam(r, "tokenID")
+	if err := h.publisherService.RevokeDeviceToken(r.Context(), userID, chi.URLParam(r, "deviceID"), tokenID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Token revoked successfully",
+	})
+}
+
+// Publish to a device with one of its inbound tokens, sent as
+// "Authorization: Bearer <token>". The body is either the image itself, a
+// multipart form like the one PublishWallpaperUpload takes, or JSON naming
+// an image URL to download along with optional metadata and schedule.
+func (h *PublisherHandlers) InboundPublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || value == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wallstream"`)
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "device token required",
+		})
+		return
+	}
+
+	token, err := h.publisherService.AuthenticateDeviceToken(r.Context(), strings.TrimSpace(value))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		publishMultipart(w, r, func(file io.Reader, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error) {
+			return h.publisherService.PublishWithDeviceToken(r.Context(), token, file, metadata, schedule)
+		})
+
+	case "application/json":
+		var req struct {
+			URL      string                       `json:"url"`
+			Metadata repository.WallpaperMetadata `json:"metadata"`
+			repository.PublishSchedule
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInboundJSONSize)).Decode(&req); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid JSON body",
+			})
+			return
+		}
+
+		publishedWallpaper, err := h.publisherService.PublishURLWithDeviceToken(r.Context(), token, req.URL, req.Metadata, req.PublishSchedule)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, publishedWallpaper)
+
+	default:
+		body := http.MaxBytesReader(w, r.Body, service.MaxUploadSize+1)
+		publishedWallpaper, err := h.publisherService.PublishWithDeviceToken(r.Context(), token, body, repository.WallpaperMetadata{}, repository.PublishSchedule{})
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, publishedWallpaper)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+type ExportHandlers struct {
+	exportService *service.ExportService
+}
+
+func NewExportHandlers(exportService *service.ExportService) *ExportHandlers {
+	return &ExportHandlers{exportService: exportService}
+}
+
+// Stream a zip archive of the caller's account, devices, publish history,
+// playlists, subscriptions and image files
+func (h *ExportHandlers) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	export, err := h.exportService.Export(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("wallstream-%s-%s.zip", export.User.Username, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	// Too late for an error response once the archive has started, so a
+	// failure cuts it short and the client sees a truncated zip
+	if err := h.exportService.WriteArchive(r.Context(), export, w); err != nil {
+		log.Printf("Export of user %s failed: %v", userID, err)
+	}
+}
+
+// Recreate an export archive, sent as the request body, under the caller's
+// account
+func (h *ExportHandlers) ImportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxImportSize)
+	report, err := h.exportService.ImportArchive(r.Context(), userID, r.Body)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, report)
+}
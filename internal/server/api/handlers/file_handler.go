@@ -1,18 +1,27 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"github.io/khosbilegt/wallstream/internal/server/service"
 	"github.io/khosbilegt/wallstream/internal/server/utils"
 )
 
+// tusVersion is the tus protocol version the resumable upload endpoints speak
+const tusVersion = "1.0.0"
+
 type FileHandlers struct {
-	fileService *service.FileService
+	fileService            *service.FileService
+	resumableUploadService *service.ResumableUploadService
 }
 
-func NewFileHandlers(fileService *service.FileService) *FileHandlers {
-	return &FileHandlers{fileService: fileService}
+func NewFileHandlers(fileService *service.FileService, resumableUploadService *service.ResumableUploadService) *FileHandlers {
+	return &FileHandlers{fileService: fileService, resumableUploadService: resumableUploadService}
 }
 
 // Upload wallpaper to the server
@@ -37,3 +46,173 @@ func (h *FileHandlers) UploadWallpaper(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusOK, map[string]string{"filename": filename})
 
 }
+
+// Advertise tus capabilities
+func (h *FileHandlers) ResumableUploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(service.MaxUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusMiddleware rejects requests for a tus version we don't speak
+func (h *FileHandlers) TusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			utils.WriteJSON(w, http.StatusPreconditionFailed, map[string]string{
+				"error": "unsupported tus version",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start a resumable upload (tus creation extension)
+func (h *FileHandlers) CreateResumableUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid Upload-Length header",
+		})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	uploadSession, err := h.resumableUploadService.CreateUpload(r.Context(), userID, length, metadata)
+	if err != nil {
+		if length > service.MaxUploadSize {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/files/uploads/"+uploadSession.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Report how much of a resumable upload the server has
+func (h *FileHandlers) HeadResumableUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	uploadSession, err := h.resumableUploadService.GetUpload(r.Context(), userID, chi.URLParam(r, "uploadID"))
+	if err != nil {
+		// HEAD responses carry no body, only the status
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(uploadSession.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(uploadSession.Length, 10))
+	if uploadSession.Filename != "" {
+		w.Header().Set("Wallstream-Filename", uploadSession.Filename)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Describe a resumable upload, including the stored filename once complete
+func (h *FileHandlers) GetResumableUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	uploadSession, err := h.resumableUploadService.GetUpload(r.Context(), userID, chi.URLParam(r, "uploadID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, uploadSession)
+}
+
+// Append bytes to a resumable upload at Upload-Offset
+func (h *FileHandlers) PatchResumableUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, map[string]string{
+			"error": "content type must be application/offset+octet-stream",
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid Upload-Offset header",
+		})
+		return
+	}
+
+	uploadSession, err := h.resumableUploadService.AppendUpload(r.Context(), userID, chi.URLParam(r, "uploadID"), offset, r.Body)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(uploadSession.Offset, 10))
+	if uploadSession.Filename != "" {
+		w.Header().Set("Wallstream-Filename", uploadSession.Filename)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated
+// pairs of a key and an optional base64 value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata header")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %s", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
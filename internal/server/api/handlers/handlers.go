@@ -3,24 +3,61 @@ package handlers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
 )
 
 type Handlers struct {
 	UserHandlers      *UserHandlers
 	FileHandlers      *FileHandlers
 	PublisherHandlers *PublisherHandlers
+	CatalogHandlers   *CatalogHandlers
+	PlaylistHandlers  *PlaylistHandlers
+	WebhookHandlers   *WebhookHandlers
+	AuditHandlers     *AuditHandlers
+	AdminHandlers     *AdminHandlers
+	ExportHandlers    *ExportHandlers
 }
 
-func NewHandlers(userHandlers *UserHandlers, fileHandlers *FileHandlers, publisherHandlers *PublisherHandlers) *Handlers {
-	return &Handlers{UserHandlers: userHandlers, FileHandlers: fileHandlers, PublisherHandlers: publisherHandlers}
+func NewHandlers(userHandlers *UserHandlers, fileHandlers *FileHandlers, publisherHandlers *PublisherHandlers, catalogHandlers *CatalogHandlers, playlistHandlers *PlaylistHandlers, webhookHandlers *WebhookHandlers, auditHandlers *AuditHandlers, adminHandlers *AdminHandlers, exportHandlers *ExportHandlers) *Handlers {
+	return &Handlers{UserHandlers: userHandlers, FileHandlers: fileHandlers, PublisherHandlers: publisherHandlers, CatalogHandlers: catalogHandlers, PlaylistHandlers: playlistHandlers, WebhookHandlers: webhookHandlers, AuditHandlers: auditHandlers, AdminHandlers: adminHandlers, ExportHandlers: exportHandlers}
 }
 
-// AuthMiddleware validates HTTP Basic Auth with username + API key
+// RequestInfoMiddleware attaches the client IP and request ID to the context
+// for audit events. It must run after middleware.RealIP and
+// middleware.RequestID.
+func (h *Handlers) RequestInfoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ctx := service.WithRequestInfo(r.Context(), service.RequestInfo{
+			IP:        ip,
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AuthMiddleware validates HTTP Basic Auth with username + API key, or a
+// device client certificate when the request carries no Authorization header
 func (h *Handlers) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			h.certificateAuth(w, r, next)
+			return
+		}
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Basic ") {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 			http.Error(w, "authorization required", http.StatusUnauthorized)
@@ -48,12 +85,120 @@ func (h *Handlers) AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "invalid username or API key", http.StatusUnauthorized)
 			return
 		}
+		if user.Locked() {
+			http.Error(w, "account disabled", http.StatusForbidden)
+			return
+		}
 
 		// Add user info to request context
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 		ctx = context.WithValue(ctx, "username", user.Username)
+		ctx = context.WithValue(ctx, "role", user.RoleOrDefault())
+		info := service.RequestInfoFrom(ctx)
+		info.ActorID, info.ActorUsername, info.KeyID = user.ID, user.Username, service.APIKeyID(apiKey)
+		ctx = service.WithRequestInfo(ctx, info)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// certificateAuth authenticates a request by the client certificate the TLS
+// handshake verified. The request acts as the device's owner, but only with
+// the user role: a certificate lives on a device and never carries admin
+// rights.
+func (h *Handlers) certificateAuth(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	ctx := r.Context()
+	certificate, user, err := h.PublisherHandlers.publisherService.AuthenticateDeviceCertificate(ctx, r.TLS.PeerCertificates[0])
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrForbidden):
+			http.Error(w, "account disabled", http.StatusForbidden)
+		case errors.Is(err, service.ErrUnauthorized):
+			http.Error(w, "unknown or revoked client certificate", http.StatusUnauthorized)
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx = context.WithValue(ctx, "user_id", user.ID)
+	ctx = context.WithValue(ctx, "username", user.Username)
+	ctx = context.WithValue(ctx, "role", repository.RoleUser)
+	ctx = context.WithValue(ctx, "device_id", certificate.DeviceID)
+	info := service.RequestInfoFrom(ctx)
+	info.ActorID, info.ActorUsername, info.KeyID = user.ID, user.Username, service.DeviceCertificateKeyID(certificate.ID)
+	ctx = service.WithRequestInfo(ctx, info)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireRole only lets through users whose role grants at least min. It
+// must run after AuthMiddleware.
+func (h *Handlers) RequireRole(min string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := utils.GetStringFromContext(r.Context(), "role")
+			if !service.RoleAtLeast(role, min) {
+				utils.WriteJSON(w, http.StatusForbidden, map[string]string{
+					"error": "requires the " + min + " role",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAccount refuses requests authenticated as a single device, such as
+// with a device certificate, on routes that act on the whole account. It
+// must run after AuthMiddleware.
+func (h *Handlers) RequireAccount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := utils.GetStringFromContext(r.Context(), "device_id"); ok {
+			utils.WriteJSON(w, http.StatusForbidden, map[string]string{
+				"error": "device credentials can only publish to and serve their own device",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RestrictToDevice lets requests authenticated as a single device through
+// only to routes whose deviceID is that device. Account credentials pass. It
+// must run after AuthMiddleware.
+func (h *Handlers) RestrictToDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deviceID, ok := utils.GetStringFromContext(r.Context(), "device_id"); ok && chi.URLParam(r, "deviceID") != deviceID {
+			utils.WriteJSON(w, http.StatusForbidden, map[string]string{
+				"error": "device credentials can only publish to and serve their own device",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeServiceError maps service sentinel errors to an HTTP status
+func writeServiceError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidInput):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrConflict):
+		status = http.StatusConflict
+	}
+	utils.WriteJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDeviceCredentialScope(t *testing.T) {
+	h := &Handlers{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	router := chi.NewRouter()
+	router.With(h.RestrictToDevice).Get("/api/wallpaper/{deviceID}", ok)
+	router.With(h.RequireAccount).Get("/api/webhooks", ok)
+
+	tests := []struct {
+		name     string
+		deviceID string
+		path     string
+		want     int
+	}{
+		{name: "account on a device route", path: "/api/wallpaper/kitchen", want: http.StatusNoContent},
+		{name: "account on an account route", path: "/api/webhooks", want: http.StatusNoContent},
+		{name: "device on its own route", deviceID: "kitchen", path: "/api/wallpaper/kitchen", want: http.StatusNoContent},
+		{name: "device on another device", deviceID: "kitchen", path: "/api/wallpaper/office", want: http.StatusForbidden},
+		{name: "device on an account route", deviceID: "kitchen", path: "/api/webhooks", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), "user_id", "user-1")
+			if tt.deviceID != "" {
+				ctx = context.WithValue(ctx, "device_id", tt.deviceID)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil).WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
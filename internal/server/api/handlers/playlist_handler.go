@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+type PlaylistHandlers struct {
+	playlistService *service.PlaylistService
+}
+
+func NewPlaylistHandlers(playlistService *service.PlaylistService) *PlaylistHandlers {
+	return &PlaylistHandlers{playlistService: playlistService}
+}
+
+// playlistRequest reads the user and device every playlist route needs,
+// writing the error response itself when one is missing
+func playlistRequest(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return "", "", false
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return "", "", false
+	}
+	return userID, deviceID, true
+}
+
+func (h *PlaylistHandlers) CreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, deviceID, ok := playlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input service.PlaylistInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	playlist, err := h.playlistService.CreatePlaylist(r.Context(), userID, deviceID, &input)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, playlist)
+}
+
+func (h *PlaylistHandlers) GetPlaylists(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, deviceID, ok := playlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	playlists, err := h.playlistService.GetPlaylists(r.Context(), userID, deviceID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, playlists)
+}
+
+func (h *PlaylistHandlers) GetPlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, deviceID, ok := playlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	playlist, err := h.playlistService.GetPlaylist(r.Context(), userID, deviceID, chi.URLParam(r, "playlistID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, playlist)
+}
+
+func (h *PlaylistHandlers) UpdatePlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, deviceID, ok := playlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input service.PlaylistInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	playlist, err := h.playlistService.UpdatePlaylist(r.Context(), userID, deviceID, chi.URLParam(r, "playlistID"), &input)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, playlist)
+}
+
+func (h *PlaylistHandlers) DeletePlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, deviceID, ok := playlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.playlistService.DeletePlaylist(r.Context(), userID, deviceID, chi.URLParam(r, "playlistID")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Playlist deleted successfully",
+	})
+}
+
+// Advance a playlist to its next wallpaper now
+func (h *PlaylistHandlers) SkipPlaylist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, deviceID, ok := playlistRequest(w, r)
+	if !ok {
+		return
+	}
+
+	playlist, err := h.playlistService.SkipPlaylist(r.Context(), userID, deviceID, chi.URLParam(r, "playlistID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, playlist)
+}
@@ -2,13 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
 	"github.io/khosbilegt/wallstream/internal/server/service"
 	"github.io/khosbilegt/wallstream/internal/server/utils"
 )
 
+const (
+	// defaultColorTolerance is used when ?color= is given without ?tolerance=
+	defaultColorTolerance = 60
+
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type PublisherHandlers struct {
 	publisherService *service.PublisherService
 }
@@ -55,6 +70,13 @@ func (h *PublisherHandlers) CreatePublisherDevice(w http.ResponseWriter, r *http
 	}
 
 	err = h.publisherService.CreatePublisherDevice(r.Context(), userID, req.DeviceID)
+	if errors.Is(err, service.ErrConflict) {
+		// Taken by a concurrent request since the check above
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "device ID already in use",
+		})
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -91,8 +113,7 @@ func (h *PublisherHandlers) GetPublisherDeviceByDeviceID(w http.ResponseWriter,
 		return
 	}
 
-	// Get the device ID from the request context
-	deviceID := r.Context().Value("device_id").(string)
+	deviceID := chi.URLParam(r, "deviceID")
 
 	publisherDevice, err := h.publisherService.GetPublisherDeviceByDeviceID(r.Context(), deviceID)
 	if err != nil {
@@ -113,14 +134,19 @@ func (h *PublisherHandlers) DeletePublisherDeviceByDeviceID(w http.ResponseWrite
 		return
 	}
 
-	// Get the device ID from the request context
-	deviceID := r.Context().Value("device_id").(string)
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
 
-	err := h.publisherService.DeletePublisherDeviceByDeviceID(r.Context(), deviceID)
+	err := h.publisherService.DeletePublisherDeviceByDeviceID(r.Context(), userID, deviceID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		writeServiceError(w, err)
 		return
 	}
 }
@@ -136,8 +162,7 @@ func (h *PublisherHandlers) GetUploadURL(w http.ResponseWriter, r *http.Request)
 	// Get the user ID from the request context
 	userID := r.Context().Value("user_id").(string)
 
-	// Get the device ID from the request context
-	deviceID := r.Context().Value("device_id").(string)
+	deviceID := chi.URLParam(r, "deviceID")
 
 	uploadURL, err := h.publisherService.GenerateUploadURL(r.Context(), userID, deviceID)
 	if err != nil {
@@ -166,8 +191,11 @@ func (h *PublisherHandlers) PublishUploadedWallpaper(w http.ResponseWriter, r *h
 	}
 
 	var req struct {
-		Filename string `json:"filename"`
-		DeviceID string `json:"device_id"`
+		Filename string                       `json:"filename"`
+		DeviceID string                       `json:"device_id"`
+		Variants []service.VariantUpload      `json:"variants"`
+		Metadata repository.WallpaperMetadata `json:"metadata"`
+		repository.PublishSchedule
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -183,10 +211,11 @@ func (h *PublisherHandlers) PublishUploadedWallpaper(w http.ResponseWriter, r *h
 		userID,
 		req.DeviceID,
 		req.Filename,
+		req.Variants,
+		req.Metadata,
+		req.PublishSchedule,
 	); err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		writeServiceError(w, err)
 		return
 	}
 
@@ -196,6 +225,40 @@ func (h *PublisherHandlers) PublishUploadedWallpaper(w http.ResponseWriter, r *h
 	})
 }
 
+// Upload and publish a wallpaper in a single multipart request. The file part
+// is streamed straight to disk rather than parsed into memory first, so
+// metadata fields (title, description, source_url, author, license and
+// repeated tag) and schedule fields (publish_at and expires_at) have to come
+// before it.
+func (h *PublisherHandlers) PublishWallpaperUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	publishMultipart(w, r, func(file io.Reader, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error) {
+		return h.publisherService.PublishWallpaperFile(r.Context(), userID, deviceID, file, metadata, schedule)
+	})
+}
+
 func (h *PublisherHandlers) GetPublishedWallpapers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
@@ -207,6 +270,14 @@ func (h *PublisherHandlers) GetPublishedWallpapers(w http.ResponseWriter, r *htt
 	// Get the user ID from the request context
 	userID := r.Context().Value("user_id").(string)
 
+	colorFilter, err := colorFilterFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	publishedWallpapers, err := h.publisherService.GetPublishedWallpapersByUserID(r.Context(), userID)
 	if err != nil {
 		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
@@ -215,7 +286,7 @@ func (h *PublisherHandlers) GetPublishedWallpapers(w http.ResponseWriter, r *htt
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, publishedWallpapers)
+	utils.WriteJSON(w, http.StatusOK, service.FilterPublishedWallpapersByColor(publishedWallpapers, colorFilter))
 }
 
 func (h *PublisherHandlers) GetPublishedWallpapersByDeviceID(w http.ResponseWriter, r *http.Request) {
@@ -242,6 +313,14 @@ func (h *PublisherHandlers) GetPublishedWallpapersByDeviceID(w http.ResponseWrit
 		return
 	}
 
+	colorFilter, err := colorFilterFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	publishedWallpapers, err := h.publisherService.
 		GetPublishedWallpapersByDeviceID(r.Context(), userID, deviceID)
 	if err != nil {
@@ -251,7 +330,7 @@ func (h *PublisherHandlers) GetPublishedWallpapersByDeviceID(w http.ResponseWrit
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, publishedWallpapers)
+	utils.WriteJSON(w, http.StatusOK, service.FilterPublishedWallpapersByColor(publishedWallpapers, colorFilter))
 }
 
 func (h *PublisherHandlers) ServeWallpaper(w http.ResponseWriter, r *http.Request) {
@@ -273,22 +352,262 @@ func (h *PublisherHandlers) ServeWallpaper(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	publishedWallpapers, err := h.publisherService.GetPublishedWallpapersByDeviceID(r.Context(), userID, deviceID)
+	publishedWallpaper, err := h.publisherService.GetCurrentWallpaper(r.Context(), userID, deviceID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
+		writeServiceError(w, err)
+		return
+	}
+
+	http.ServeFile(w, r, h.publisherService.FilePath(publishedWallpaper.URL))
+}
+
+func (h *PublisherHandlers) GetWallpaperHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	offset, limit, err := paginationFromQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	if len(publishedWallpapers) == 0 {
-		utils.WriteJSON(w, http.StatusNotFound, map[string]string{
-			"error": "no published wallpapers found",
+	history, err := h.publisherService.GetWallpaperHistory(r.Context(), userID, deviceID, offset, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, history)
+}
+
+// Make a previously published wallpaper the device's current one
+func (h *PublisherHandlers) RollbackWallpaper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	var req struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hash == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	publishedWallpaper, err := h.publisherService.RollbackWallpaper(r.Context(), userID, deviceID, req.Hash)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, publishedWallpaper)
+}
+
+// Publish previously uploaded images as one wallpaper per monitor
+func (h *PublisherHandlers) PublishWallpaperSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	var req struct {
+		Monitors []service.MonitorUpload      `json:"monitors"`
+		Metadata repository.WallpaperMetadata `json:"metadata"`
+		repository.PublishSchedule
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	publishedWallpaper, err := h.publisherService.PublishWallpaperSet(r.Context(), userID, deviceID, req.Monitors, req.Metadata, req.PublishSchedule)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, publishedWallpaper)
+}
+
+// Describe which image goes on which monitor. ?monitors=N adapts the layout to
+// a subscriber with N monitors.
+func (h *PublisherHandlers) GetWallpaperManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
 		})
 		return
 	}
 
-	http.ServeFile(w, r, publishedWallpapers[0].URL)
+	monitorCount := 0
+	if raw := r.URL.Query().Get("monitors"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("invalid monitors %q", raw),
+			})
+			return
+		}
+		monitorCount = v
+	}
+
+	publishedWallpaper, err := h.publisherService.GetCurrentWallpaper(r.Context(), userID, deviceID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, service.BuildMonitorManifest(publishedWallpaper, monitorCount))
+}
+
+// Serve the current wallpaper's image for one of the publisher's monitors
+func (h *PublisherHandlers) ServeMonitorWallpaper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if deviceID == "" || err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID or invalid monitor index",
+		})
+		return
+	}
+
+	filePath, err := h.publisherService.GetCurrentMonitorImage(r.Context(), userID, deviceID, index)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	http.ServeFile(w, r, filePath)
+}
+
+// Download one of the current wallpaper's variants, by its index in the
+// manifest
+func (h *PublisherHandlers) ServeVariantWallpaper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if deviceID == "" || err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID or invalid variant index",
+		})
+		return
+	}
+
+	filePath, err := h.publisherService.GetCurrentVariantImage(r.Context(), userID, deviceID, index)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	http.ServeFile(w, r, filePath)
 }
 
 // Delete published wallpaper by hash
@@ -313,9 +632,307 @@ func (h *PublisherHandlers) DeletePublishedWallpaperByHash(w http.ResponseWriter
 
 	err := h.publisherService.DeletePublishedWallpaperByHash(r.Context(), userID, hash)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
+		writeServiceError(w, err)
+		return
+	}
+}
+
+// Edit a published wallpaper's metadata. Only the fields present in the body
+// change; an empty value clears a field.
+func (h *PublisherHandlers) UpdateWallpaperMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	hash := chi.URLParam(r, "hash")
+	if hash == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing hash",
+		})
+		return
+	}
+
+	var patch service.WallpaperMetadataPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	publishedWallpaper, err := h.publisherService.UpdateWallpaperMetadata(r.Context(), userID, hash, &patch)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, publishedWallpaper)
+}
+
+func (h *PublisherHandlers) UpdateRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	// A JSON null clears the policy
+	var policy *repository.RetentionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	publisherDevice, err := h.publisherService.UpdateRetentionPolicy(r.Context(), userID, deviceID, policy)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, publisherDevice)
+}
+
+// Make a device a public stream listed in the catalog, or private again
+func (h *PublisherHandlers) UpdateStreamSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	if deviceID == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID",
+		})
+		return
+	}
+
+	var settings service.StreamSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	publisherDevice, err := h.publisherService.UpdateStreamSettings(r.Context(), userID, deviceID, &settings)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, publisherDevice)
+}
+
+// Pin (PUT) or unpin (DELETE) a wallpaper on a device
+func (h *PublisherHandlers) SetWallpaperPinned(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	hash := chi.URLParam(r, "hash")
+	if deviceID == "" || hash == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "missing deviceID or hash",
+		})
+		return
+	}
+
+	pinned := r.Method == http.MethodPut
+	if err := h.publisherService.SetWallpaperPinned(r.Context(), userID, deviceID, hash, pinned); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"hash": hash, "pinned": pinned})
+}
+
+// publishMultipart reads the metadata fields in front of the file part of a
+// multipart publish, hands the file to publish and writes the response
+func publishMultipart(w http.ResponseWriter, r *http.Request, publish func(file io.Reader, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error)) {
+	// Leave headroom for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxUploadSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
 			"error": err.Error(),
 		})
 		return
 	}
+
+	var metadata repository.WallpaperMetadata
+	var schedule repository.PublishSchedule
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "missing file part",
+			})
+			return
+		}
+		if part.FormName() != "file" {
+			err := readMetadataPart(part, &metadata, &schedule)
+			part.Close()
+			if err != nil {
+				utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+				return
+			}
+			continue
+		}
+
+		publishedWallpaper, err := publish(part, metadata, schedule)
+		part.Close()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, publishedWallpaper)
+		return
+	}
+}
+
+// maxMetadataFieldSize bounds a single metadata form field in a multipart
+// publish
+const maxMetadataFieldSize = 8 << 10
+
+// readMetadataPart reads a multipart form field into the matching metadata or
+// schedule field. Unknown fields are ignored.
+func readMetadataPart(part *multipart.Part, metadata *repository.WallpaperMetadata, schedule *repository.PublishSchedule) error {
+	data, err := io.ReadAll(io.LimitReader(part, maxMetadataFieldSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMetadataFieldSize {
+		return fmt.Errorf("field %s is too large", part.FormName())
+	}
+
+	value := string(data)
+	switch part.FormName() {
+	case "title":
+		metadata.Title = value
+	case "description":
+		metadata.Description = value
+	case "source_url":
+		metadata.SourceURL = value
+	case "author":
+		metadata.Author = value
+	case "license":
+		metadata.License = value
+	case "tag":
+		metadata.Tags = append(metadata.Tags, value)
+	case "publish_at", "expires_at":
+		timestamp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", part.FormName(), value)
+		}
+		if part.FormName() == "publish_at" {
+			schedule.PublishAt = timestamp
+		} else {
+			schedule.ExpiresAt = timestamp
+		}
+	}
+	return nil
+}
+
+// paginationFromQuery parses ?offset=&limit=, applying defaults and capping
+// limit at maxPageSize
+func paginationFromQuery(r *http.Request) (int64, int64, error) {
+	query := r.URL.Query()
+	offset, limit := int64(0), int64(defaultPageSize)
+
+	if raw := query.Get("offset"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", raw)
+		}
+		offset = v
+	}
+	if raw := query.Get("limit"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", raw)
+		}
+		limit = min(v, maxPageSize)
+	}
+
+	return offset, limit, nil
+}
+
+// colorFilterFromQuery parses ?color=#rrggbb&tolerance=N, returning nil when
+// no color was requested
+func colorFilterFromQuery(r *http.Request) (*service.ColorFilter, error) {
+	query := r.URL.Query()
+	if query.Get("color") == "" {
+		return nil, nil
+	}
+
+	c, err := utils.ParseHexColor(query.Get("color"))
+	if err != nil {
+		return nil, err
+	}
+
+	tolerance := float64(defaultColorTolerance)
+	if raw := query.Get("tolerance"); raw != "" {
+		tolerance, err = strconv.ParseFloat(raw, 64)
+		if err != nil || tolerance < 0 || math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+			return nil, fmt.Errorf("invalid tolerance %q", raw)
+		}
+	}
+
+	return &service.ColorFilter{Color: c, Tolerance: tolerance}, nil
 }
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"image/color"
+	"net/http/httptest"
+	"testing"
+
+	"github.io/khosbilegt/wallstream/internal/server/service"
+)
+
+func TestColorFilterFromQuery(t *testing.T) {
+	orange := color.RGBA{R: 255, G: 128, A: 255}
+	tests := []struct {
+		query   string
+		want    *service.ColorFilter
+		wantErr bool
+	}{
+		{query: "", want: nil},
+		{query: "tolerance=10", want: nil},
+		{query: "color=%23ff8000", want: &service.ColorFilter{Color: orange, Tolerance: defaultColorTolerance}},
+		{query: "color=ff8000&tolerance=12.5", want: &service.ColorFilter{Color: orange, Tolerance: 12.5}},
+		{query: "color=ff8000&tolerance=0", want: &service.ColorFilter{Color: orange, Tolerance: 0}},
+		{query: "color=orange", wantErr: true},
+		{query: "color=%23fff", wantErr: true},
+		{query: "color=ff8000&tolerance=-1", wantErr: true},
+		{query: "color=ff8000&tolerance=wide", wantErr: true},
+		{query: "color=ff8000&tolerance=NaN", wantErr: true},
+		{query: "color=ff8000&tolerance=Inf", wantErr: true},
+		{query: "color=ff8000&tolerance=1e400", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := colorFilterFromQuery(httptest.NewRequest("GET", "/api/catalog/streams?"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("?%s: error = %v, want error %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("?%s: filter = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
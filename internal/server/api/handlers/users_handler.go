@@ -1,8 +1,8 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.io/khosbilegt/wallstream/internal/server/service"
@@ -36,7 +36,11 @@ func (h *UserHandlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiKey, err := h.usersService.CreateUser(context.Background(), req.Username)
+	apiKey, err := h.usersService.CreateUser(r.Context(), req.Username)
+	if errors.Is(err, service.ErrForbidden) || errors.Is(err, service.ErrConflict) {
+		writeServiceError(w, err)
+		return
+	}
 	if err != nil {
 		utils.WriteJSON(w, http.StatusInternalServerError, map[string]string{
 			"error": err.Error(),
@@ -47,6 +51,74 @@ func (h *UserHandlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusOK, map[string]string{"username": req.Username, "api_key": apiKey})
 }
 
+// Replace the caller's API key. The key used for this request stops working.
+func (h *UserHandlers) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+	username, _ := utils.GetStringFromContext(r.Context(), "username")
+
+	apiKey, err := h.usersService.RotateAPIKey(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"username": username, "api_key": apiKey})
+}
+
+// Queue the caller's account for deletion. The body must be
+// {"confirm": "<username>"}. The account is locked at once and removed along
+// with everything it owns by a background job.
+func (h *UserHandlers) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.WriteJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"error": "method not allowed",
+		})
+		return
+	}
+
+	userID, ok := utils.GetStringFromContext(r.Context(), "user_id")
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "missing or invalid user_id",
+		})
+		return
+	}
+
+	var req struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON body",
+		})
+		return
+	}
+
+	user, err := h.usersService.RequestDeletion(r.Context(), userID, req.Confirm)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"username":              user.Username,
+		"deletion_requested_at": user.DeletionRequestedAt,
+	})
+}
+
 // func (h *UserHandlers) WebIndex(w http.ResponseWriter, r *http.Request) {
 // 	data := struct {
 // 		Title string
@@ -4,6 +4,8 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.io/khosbilegt/wallstream/internal/server/api/handlers"
+	"github.io/khosbilegt/wallstream/internal/server/metrics"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
 )
 
 type Routes struct {
@@ -17,34 +19,120 @@ func NewRoutes(r chi.Router, handlers *handlers.Handlers) *Routes {
 
 func (rts *Routes) RegisterRoutes() {
 	// Apply global middleware
+	rts.r.Use(metrics.Middleware)
 	rts.r.Use(middleware.RequestID)
 	rts.r.Use(middleware.RealIP)
 	rts.r.Use(middleware.Logger)
 	rts.r.Use(middleware.Recoverer)
+	rts.r.Use(rts.handlers.RequestInfoMiddleware)
 
 	// Public routes
 	rts.r.Group(func(r chi.Router) {
 		rts.r.Post("/api/users/register", rts.handlers.UserHandlers.CreateUser)
+		rts.r.Options("/api/files/uploads", rts.handlers.FileHandlers.ResumableUploadOptions)
+		rts.r.Get("/api/catalog/streams", rts.handlers.CatalogHandlers.ListStreams)
+		rts.r.Get("/api/catalog/streams/{deviceID}/thumbnail", rts.handlers.CatalogHandlers.ServeStreamThumbnail)
+		rts.r.Post("/api/inbound/wallpaper", rts.handlers.PublisherHandlers.InboundPublish)
 	})
 
-	// File routes
+	// File routes, also open to device certificates as publishing a
+	// wallpaper set or a large image starts with uploads
 	rts.r.Group(func(r chi.Router) {
 		r.Use(rts.handlers.AuthMiddleware)
 		r.Post("/api/files/upload", rts.handlers.FileHandlers.UploadWallpaper)
+		r.Get("/api/files/uploads/{uploadID}", rts.handlers.FileHandlers.GetResumableUpload)
+	})
+
+	// Resumable upload routes (tus protocol)
+	rts.r.Group(func(r chi.Router) {
+		r.Use(rts.handlers.AuthMiddleware)
+		r.Use(rts.handlers.FileHandlers.TusMiddleware)
+		r.Post("/api/files/uploads", rts.handlers.FileHandlers.CreateResumableUpload)
+		r.Head("/api/files/uploads/{uploadID}", rts.handlers.FileHandlers.HeadResumableUpload)
+		r.Patch("/api/files/uploads/{uploadID}", rts.handlers.FileHandlers.PatchResumableUpload)
+	})
+
+	// Device routes: publishing to and serving one device, which device
+	// certificates may do for their own device
+	rts.r.Group(func(r chi.Router) {
+		r.Use(rts.handlers.AuthMiddleware)
+		r.Use(rts.handlers.RestrictToDevice)
+		r.Get("/api/publisher/devices/{deviceID}/upload-url", rts.handlers.PublisherHandlers.GetUploadURL)
+		r.Post("/api/publisher/devices/{deviceID}/wallpaper", rts.handlers.PublisherHandlers.PublishWallpaperUpload)
+		r.Post("/api/publisher/devices/{deviceID}/wallpaper-set", rts.handlers.PublisherHandlers.PublishWallpaperSet)
+		r.Get("/api/wallpaper/{deviceID}", rts.handlers.PublisherHandlers.ServeWallpaper)
+		r.Get("/api/wallpaper/{deviceID}/thumbnail", rts.handlers.CatalogHandlers.ServeDeviceThumbnail)
+		r.Get("/api/wallpaper/{deviceID}/manifest", rts.handlers.PublisherHandlers.GetWallpaperManifest)
+		r.Get("/api/wallpaper/{deviceID}/monitors/{index}", rts.handlers.PublisherHandlers.ServeMonitorWallpaper)
+		r.Get("/api/wallpaper/{deviceID}/variants/{index}", rts.handlers.PublisherHandlers.ServeVariantWallpaper)
 	})
 
 	// Protected routes (API key authentication)
 	rts.r.Group(func(r chi.Router) {
 		r.Use(rts.handlers.AuthMiddleware)
+		r.Use(rts.handlers.RequireAccount)
+		r.Post("/api/users/api-key", rts.handlers.UserHandlers.RotateAPIKey)
+		r.Delete("/api/users/me", rts.handlers.UserHandlers.DeleteAccount)
+		r.Get("/api/users/me/export", rts.handlers.ExportHandlers.ExportAccount)
+		r.Post("/api/users/me/import", rts.handlers.ExportHandlers.ImportAccount)
+		r.Get("/api/audit", rts.handlers.AuditHandlers.GetAuditEvents)
 		r.Post("/api/publisher/devices", rts.handlers.PublisherHandlers.CreatePublisherDevice)
 		r.Get("/api/publisher/devices", rts.handlers.PublisherHandlers.GetPublisherDevices)
 		r.Get("/api/publisher/devices/{deviceID}", rts.handlers.PublisherHandlers.GetPublisherDeviceByDeviceID)
 		r.Delete("/api/publisher/devices/{deviceID}", rts.handlers.PublisherHandlers.DeletePublisherDeviceByDeviceID)
-		r.Get("/api/publisher/devices/{deviceID}/upload-url", rts.handlers.PublisherHandlers.GetUploadURL)
+		r.Get("/api/publisher/devices/{deviceID}/history", rts.handlers.PublisherHandlers.GetWallpaperHistory)
+		r.Post("/api/publisher/devices/{deviceID}/rollback", rts.handlers.PublisherHandlers.RollbackWallpaper)
+		r.Put("/api/publisher/devices/{deviceID}/retention", rts.handlers.PublisherHandlers.UpdateRetentionPolicy)
+		r.Post("/api/publisher/devices/{deviceID}/playlists", rts.handlers.PlaylistHandlers.CreatePlaylist)
+		r.Get("/api/publisher/devices/{deviceID}/playlists", rts.handlers.PlaylistHandlers.GetPlaylists)
+		r.Get("/api/publisher/devices/{deviceID}/playlists/{playlistID}", rts.handlers.PlaylistHandlers.GetPlaylist)
+		r.Put("/api/publisher/devices/{deviceID}/playlists/{playlistID}", rts.handlers.PlaylistHandlers.UpdatePlaylist)
+		r.Delete("/api/publisher/devices/{deviceID}/playlists/{playlistID}", rts.handlers.PlaylistHandlers.DeletePlaylist)
+		r.Post("/api/publisher/devices/{deviceID}/playlists/{playlistID}/next", rts.handlers.PlaylistHandlers.SkipPlaylist)
+		r.Put("/api/publisher/devices/{deviceID}/stream", rts.handlers.PublisherHandlers.UpdateStreamSettings)
+		r.Post("/api/publisher/devices/{deviceID}/tokens", rts.handlers.PublisherHandlers.CreateDeviceToken)
+		r.Get("/api/publisher/devices/{deviceID}/tokens", rts.handlers.PublisherHandlers.GetDeviceTokens)
+		r.Delete("/api/publisher/devices/{deviceID}/tokens/{tokenID}", rts.handlers.PublisherHandlers.RevokeDeviceToken)
+		r.Post("/api/publisher/devices/{deviceID}/certificates", rts.handlers.PublisherHandlers.IssueDeviceCertificate)
+		r.Get("/api/publisher/devices/{deviceID}/certificates", rts.handlers.PublisherHandlers.GetDeviceCertificates)
+		r.Delete("/api/publisher/devices/{deviceID}/certificates/{certificateID}", rts.handlers.PublisherHandlers.RevokeDeviceCertificate)
+		r.Put("/api/publisher/devices/{deviceID}/pins/{hash}", rts.handlers.PublisherHandlers.SetWallpaperPinned)
+		r.Delete("/api/publisher/devices/{deviceID}/pins/{hash}", rts.handlers.PublisherHandlers.SetWallpaperPinned)
 		r.Post("/api/publisher/wallpaper", rts.handlers.PublisherHandlers.PublishUploadedWallpaper)
 		r.Get("/api/publisher/wallpaper", rts.handlers.PublisherHandlers.GetPublishedWallpapers)
 		r.Get("/api/publisher/wallpaper/{deviceID}", rts.handlers.PublisherHandlers.GetPublishedWallpapersByDeviceID)
 		r.Delete("/api/publisher/wallpaper/{hash}", rts.handlers.PublisherHandlers.DeletePublishedWallpaperByHash)
-		r.Get("/api/wallpaper/{deviceID}", rts.handlers.PublisherHandlers.ServeWallpaper)
+		r.Patch("/api/publisher/wallpaper/{hash}", rts.handlers.PublisherHandlers.UpdateWallpaperMetadata)
+		r.Get("/api/subscriptions", rts.handlers.CatalogHandlers.GetSubscriptions)
+		r.Put("/api/subscriptions/{deviceID}", rts.handlers.CatalogHandlers.SetSubscribed)
+		r.Delete("/api/subscriptions/{deviceID}", rts.handlers.CatalogHandlers.SetSubscribed)
+		r.Post("/api/webhooks", rts.handlers.WebhookHandlers.CreateWebhook)
+		r.Get("/api/webhooks", rts.handlers.WebhookHandlers.GetWebhooks)
+		r.Get("/api/webhooks/{webhookID}", rts.handlers.WebhookHandlers.GetWebhook)
+		r.Put("/api/webhooks/{webhookID}", rts.handlers.WebhookHandlers.UpdateWebhook)
+		r.Delete("/api/webhooks/{webhookID}", rts.handlers.WebhookHandlers.DeleteWebhook)
+		r.Get("/api/webhooks/{webhookID}/deliveries", rts.handlers.WebhookHandlers.GetDeliveries)
+		r.Post("/api/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", rts.handlers.WebhookHandlers.Redeliver)
+	})
+
+	// Moderation routes: moderators can look at accounts, admins change them
+	rts.r.Group(func(r chi.Router) {
+		r.Use(rts.handlers.AuthMiddleware)
+		r.Use(rts.handlers.RequireRole(repository.RoleModerator))
+		r.Get("/api/admin/users", rts.handlers.AdminHandlers.ListUsers)
+		r.Get("/api/admin/users/{username}", rts.handlers.AdminHandlers.GetUser)
+		r.Get("/api/admin/users/{username}/devices", rts.handlers.AdminHandlers.GetUserDevices)
+		r.Get("/api/admin/users/{username}/storage", rts.handlers.AdminHandlers.GetStorageUsage)
+	})
+
+	// Admin routes
+	rts.r.Group(func(r chi.Router) {
+		r.Use(rts.handlers.AuthMiddleware)
+		r.Use(rts.handlers.RequireRole(repository.RoleAdmin))
+		r.Put("/api/admin/users/{username}/disabled", rts.handlers.AdminHandlers.SetUserDisabled)
+		r.Delete("/api/admin/users/{username}/disabled", rts.handlers.AdminHandlers.SetUserDisabled)
+		r.Put("/api/admin/users/{username}/role", rts.handlers.AdminHandlers.SetUserRole)
+		r.Post("/api/admin/users/{username}/api-key", rts.handlers.AdminHandlers.RotateUserAPIKey)
+		r.Delete("/api/admin/users/{username}", rts.handlers.AdminHandlers.DeleteUser)
 	})
 }
@@ -8,10 +8,10 @@ import (
 
 var templates *template.Template
 
-func LoadTemplates() {
+func LoadTemplates(dir string) {
 	var err error
-	templates, err = template.ParseGlob(filepath.Join("internal/server/templates", "*.html"))
-	log.Println("Loading templates from", filepath.Join("internal/server/templates", "*.html"))
+	templates, err = template.ParseGlob(filepath.Join(dir, "*.html"))
+	log.Println("Loading templates from", filepath.Join(dir, "*.html"))
 	if err != nil {
 		log.Fatalf("failed to load templates: %v", err)
 	}
@@ -0,0 +1,474 @@
+// Package backup writes the whole server, every collection and the upload
+// directory, to a single archive and restores it into an empty instance.
+//
+// An archive is a gzipped tar holding, in order:
+//
+//	manifest.json                 format, version and what the archive holds
+//	files/<name>                  the stored files, each with its SHA-256 in
+//	                              the WALLSTREAM.sha256 PAX record
+//	collections/<name>.jsonl      one document per line as canonical
+//	                              extended JSON
+//
+// Files come before the records so that a restore has verified every file
+// before any record can point at it.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	Format  = "wallstream-backup"
+	Version = 1
+
+	manifestName   = "manifest.json"
+	filesDir       = "files/"
+	collectionsDir = "collections/"
+	checksumRecord = "WALLSTREAM.sha256"
+	// insertBatch is how many documents a restore inserts at once
+	insertBatch = 500
+)
+
+// Manifest describes an archive
+type Manifest struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+	// Collections maps each collection to its number of documents
+	Collections map[string]int64 `json:"collections"`
+	Files       int              `json:"files"`
+	Bytes       int64            `json:"bytes"`
+}
+
+// Backup writes every collection and the files at the top of uploadDir to w.
+// The records are read first and the files after, so every file a record
+// references is in the archive unless it was deleted in between. Generated
+// thumbnails and in-flight uploads in subdirectories are left out.
+func Backup(ctx context.Context, collections []*mongo.Collection, uploadDir string, w io.Writer) (*Manifest, error) {
+	spoolDir, err := os.MkdirTemp("", "wallstream-backup-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(spoolDir)
+
+	manifest := &Manifest{
+		Format:      Format,
+		Version:     Version,
+		CreatedAt:   time.Now().Unix(),
+		Collections: map[string]int64{},
+	}
+	for _, col := range collections {
+		count, err := dumpCollection(ctx, col, filepath.Join(spoolDir, col.Name()+".jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %w", col.Name(), err)
+		}
+		manifest.Collections[col.Name()] = count
+	}
+
+	files, err := listFiles(uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		manifest.Files++
+		manifest.Bytes += file.Size()
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	if err := writeJSON(archive, manifestName, manifest); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := writeFile(archive, filepath.Join(uploadDir, file.Name())); err != nil {
+			return nil, fmt.Errorf("file %s: %w", file.Name(), err)
+		}
+	}
+	for _, col := range collections {
+		if err := writeSpooled(archive, collectionsDir+col.Name()+".jsonl", filepath.Join(spoolDir, col.Name()+".jsonl")); err != nil {
+			return nil, fmt.Errorf("collection %s: %w", col.Name(), err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// dumpCollection writes every document of col to path as extended JSON lines
+func dumpCollection(ctx context.Context, col *mongo.Collection, path string) (int64, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	buffered := bufio.NewWriter(out)
+
+	cursor, err := col.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return 0, err
+		}
+		buffered.Write(line)
+		buffered.WriteByte('\n')
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, err
+	}
+	return count, out.Close()
+}
+
+// listFiles returns the regular files at the top of dir
+func listFiles(dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []os.FileInfo{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+func writeJSON(archive *tar.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err = archive.Write(data)
+	return err
+}
+
+// writeFile adds a stored file along with its checksum. The file is hashed
+// before it is written because the header, which carries the checksum, comes
+// first.
+func writeFile(archive *tar.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := archive.WriteHeader(&tar.Header{
+		Name:       filesDir + filepath.Base(path),
+		Mode:       0644,
+		Size:       size,
+		ModTime:    info.ModTime(),
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{checksumRecord: hex.EncodeToString(hasher.Sum(nil))},
+	}); err != nil {
+		return err
+	}
+	_, err = io.CopyN(archive, file, size)
+	return err
+}
+
+func writeSpooled(archive *tar.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, file)
+	return err
+}
+
+// Restore loads an archive made by Backup into an instance with no documents
+// and no stored files. Every file is checked against its recorded checksum
+// and every collection against its recorded count. If anything fails, what
+// was restored is removed again so the instance is left empty.
+func Restore(ctx context.Context, collections []*mongo.Collection, uploadDir string, r io.Reader) (manifest *Manifest, err error) {
+	known := map[string]*mongo.Collection{}
+	for _, col := range collections {
+		known[col.Name()] = col
+	}
+	if err := checkEmpty(ctx, collections, uploadDir); err != nil {
+		return nil, err
+	}
+
+	restored := &restoration{}
+	defer func() {
+		if err != nil {
+			restored.undo(context.WithoutCancel(ctx))
+		}
+	}()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	archive := tar.NewReader(gz)
+
+	header, err := archive.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, fmt.Errorf("not a backup archive: %s must come first", manifestName)
+	}
+	manifest = &Manifest{}
+	if err := json.NewDecoder(archive).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestName, err)
+	}
+	if manifest.Format != Format || manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported archive format %s version %d", manifest.Format, manifest.Version)
+	}
+
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return nil, err
+	}
+	files := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(header.Name, filesDir):
+			if err := restored.file(uploadDir, header, archive); err != nil {
+				return nil, fmt.Errorf("%s: %w", header.Name, err)
+			}
+			files++
+		case strings.HasPrefix(header.Name, collectionsDir):
+			name := strings.TrimSuffix(strings.TrimPrefix(header.Name, collectionsDir), ".jsonl")
+			col, ok := known[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown collection %s", name)
+			}
+			count, err := restored.collection(ctx, col, archive)
+			if err != nil {
+				return nil, fmt.Errorf("collection %s: %w", name, err)
+			}
+			if count != manifest.Collections[name] {
+				return nil, fmt.Errorf("collection %s: restored %d documents, the manifest records %d", name, count, manifest.Collections[name])
+			}
+		default:
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+	}
+
+	if files != manifest.Files {
+		return nil, fmt.Errorf("restored %d files, the manifest records %d", files, manifest.Files)
+	}
+	for name, count := range manifest.Collections {
+		if count > 0 && !restored.has(name) {
+			return nil, fmt.Errorf("archive is missing collection %s", name)
+		}
+	}
+	return manifest, nil
+}
+
+// checkEmpty makes sure a restore can't mix with existing data
+func checkEmpty(ctx context.Context, collections []*mongo.Collection, uploadDir string) error {
+	for _, col := range collections {
+		count, err := col.EstimatedDocumentCount(ctx)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("collection %s is not empty; restore needs an empty instance", col.Name())
+		}
+	}
+	files, err := listFiles(uploadDir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("%s is not empty; restore needs an empty instance", uploadDir)
+	}
+	return nil
+}
+
+// restoration tracks what a restore has written so far
+type restoration struct {
+	files       []string
+	collections []*mongo.Collection
+}
+
+// file writes a stored file, keeping it only if it matches its checksum
+func (rs *restoration) file(uploadDir string, header *tar.Header, r io.Reader) error {
+	name := path.Base(header.Name)
+	if name == "." || name == "/" || name != strings.TrimPrefix(header.Name, filesDir) {
+		return fmt.Errorf("invalid file name")
+	}
+	expected := header.PAXRecords[checksumRecord]
+	if expected == "" {
+		return fmt.Errorf("no recorded checksum")
+	}
+
+	tmp, err := os.CreateTemp(uploadDir, ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), r); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch: recorded %s, got %s", expected, actual)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(uploadDir, name)
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	os.Chtimes(dst, header.ModTime, header.ModTime)
+	rs.files = append(rs.files, dst)
+	return nil
+}
+
+// collection inserts extended JSON lines into col
+func (rs *restoration) collection(ctx context.Context, col *mongo.Collection, r io.Reader) (int64, error) {
+	rs.collections = append(rs.collections, col)
+
+	reader := bufio.NewReader(r)
+	batch := []interface{}{}
+	var count int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := col.InsertMany(ctx, batch); err != nil {
+			return err
+		}
+		count += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && strings.TrimSpace(string(line)) != "" {
+			var doc bson.D
+			if err := bson.UnmarshalExtJSON(line, true, &doc); err != nil {
+				return count, fmt.Errorf("line %d: %w", count+int64(len(batch))+1, err)
+			}
+			batch = append(batch, doc)
+			if len(batch) >= insertBatch {
+				if err := flush(); err != nil {
+					return count, err
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, flush()
+}
+
+func (rs *restoration) has(name string) bool {
+	for _, col := range rs.collections {
+		if col.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// undo empties what the restore wrote to. The instance was empty before, so
+// everything in the collections it touched came from the archive.
+func (rs *restoration) undo(ctx context.Context) {
+	for _, col := range rs.collections {
+		col.DeleteMany(ctx, bson.M{})
+	}
+	for _, file := range rs.files {
+		os.Remove(file)
+	}
+}
@@ -0,0 +1,519 @@
+// Package config loads the server's settings. Each setting comes from, in
+// increasing precedence: its default, the YAML config file, its environment
+// variable and its command-line flag.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv names the environment variable that points at the config file
+// when --config isn't given
+const ConfigEnv = "WALLSTREAM_CONFIG"
+
+// redacted replaces secrets when the config is printed
+const redacted = "REDACTED"
+
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Limits   LimitsConfig   `yaml:"limits"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Features FeaturesConfig `yaml:"features"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	Import   ImportConfig   `yaml:"import"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	MQTT     MQTTConfig     `yaml:"mqtt"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+	// PublicURL is the base URL the server is reachable at, used in links
+	// sent to integrations
+	PublicURL    string `yaml:"public_url"`
+	TemplatesDir string `yaml:"templates_dir"`
+}
+
+type DatabaseConfig struct {
+	URI  string `yaml:"uri"`
+	Name string `yaml:"name"`
+}
+
+type StorageConfig struct {
+	UploadDir     string   `yaml:"upload_dir"`
+	GCInterval    Duration `yaml:"gc_interval"`
+	GCGracePeriod Duration `yaml:"gc_grace_period"`
+}
+
+// LimitsConfig caps request sizes, in bytes
+type LimitsConfig struct {
+	MaxUploadSize int64 `yaml:"max_upload_size"`
+	MaxImportSize int64 `yaml:"max_import_size"`
+}
+
+// TLSConfig enables HTTPS when both files are set. The certificate is
+// reloaded from disk on SIGHUP.
+type TLSConfig struct {
+	CertFile string         `yaml:"cert_file"`
+	KeyFile  string         `yaml:"key_file"`
+	ClientCA ClientCAConfig `yaml:"client_ca"`
+}
+
+// ClientCAConfig turns on mutual TLS: the server runs a small CA that issues
+// client certificates to paired devices, which then authenticate with them
+// instead of an API key. A certificate only reaches its own device's publish
+// and serve routes. The CA is generated on first start.
+type ClientCAConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Validity is how long issued device certificates last
+	Validity Duration `yaml:"validity"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+type FeaturesConfig struct {
+	// Registration lets anyone create an account. A closed server only gets
+	// the admins made with "users create-admin".
+	Registration bool `yaml:"registration"`
+	// AutoMigrate applies migrations at startup. Turn it off to run
+	// "migrate" as a separate deploy step instead.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type JobsConfig struct {
+	RetentionInterval   Duration `yaml:"retention_interval"`
+	PlaylistTick        Duration `yaml:"playlist_tick"`
+	ScheduleTick        Duration `yaml:"schedule_tick"`
+	WebhookTick         Duration `yaml:"webhook_tick"`
+	AccountDeletionTick Duration `yaml:"account_deletion_tick"`
+}
+
+// WebhooksConfig controls webhook delivery
+type WebhooksConfig struct {
+	// AllowPrivate lets webhooks deliver to loopback, private and link-local
+	// addresses. Any user can create a webhook, so only turn it on where
+	// every user may reach the server's network, such as a home server with
+	// receivers on the LAN.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+type ImportConfig struct {
+	// Streams lists official streams as device-id=source, where source is
+	// bing[:market], apod[:nasa-api-key] or feed:<url>. Empty disables
+	// importing.
+	Streams string `yaml:"streams"`
+	// Username is the system account that owns the official streams. It
+	// can't be registered, and an existing account by that name that the
+	// server didn't create is never used.
+	Username string   `yaml:"username"`
+	Interval Duration `yaml:"interval"`
+}
+
+// MQTTConfig mirrors wallpaper changes to a broker when Broker is set
+type MQTTConfig struct {
+	Broker   string `yaml:"broker"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// ClientID defaults to one derived from the host name
+	ClientID    string `yaml:"client_id"`
+	TopicPrefix string `yaml:"topic_prefix"`
+	// Commands accepts <prefix>/<user>/<device>/set commands; enable it on
+	// one server only. Each command carries a device token of its device in
+	// clear text, so broker ACLs are the only thing stopping other clients
+	// from reading the set topics and replaying or reusing those tokens.
+	Commands bool `yaml:"commands"`
+}
+
+// MetricsConfig serves Prometheus metrics at /metrics. On the main port they
+// need an admin's credentials; Addr gives a separate listen address instead,
+// such as a loopback one for a local scraper.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:         8080,
+			PublicURL:    "http://localhost:8080",
+			TemplatesDir: "internal/server/templates",
+		},
+		Database: DatabaseConfig{
+			URI:  "mongodb://localhost:27017/wallstream",
+			Name: "wallpaper-share",
+		},
+		Storage: StorageConfig{
+			UploadDir:     "uploads",
+			GCInterval:    Duration(time.Hour),
+			GCGracePeriod: Duration(24 * time.Hour),
+		},
+		Limits: LimitsConfig{
+			MaxUploadSize: 50 << 20,
+			MaxImportSize: 10 << 30,
+		},
+		TLS: TLSConfig{
+			ClientCA: ClientCAConfig{
+				CertFile: "tls/client-ca.crt",
+				KeyFile:  "tls/client-ca.key",
+				Validity: Duration(365 * 24 * time.Hour),
+			},
+		},
+		Features: FeaturesConfig{
+			Registration: true,
+			AutoMigrate:  true,
+		},
+		Jobs: JobsConfig{
+			RetentionInterval:   Duration(time.Hour),
+			PlaylistTick:        Duration(30 * time.Second),
+			ScheduleTick:        Duration(30 * time.Second),
+			WebhookTick:         Duration(5 * time.Second),
+			AccountDeletionTick: Duration(time.Minute),
+		},
+		Import: ImportConfig{
+			Username: "wallstream",
+			Interval: Duration(time.Hour),
+		},
+		MQTT: MQTTConfig{
+			TopicPrefix: "wallstream",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+	}
+}
+
+// setting ties one field to its environment variable and flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value flag.Value
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"PORT", "port", "Port to listen on", (*intValue)(&c.Server.Port)},
+		{"PUBLIC_URL", "public-url", "Base URL the server is reachable at", (*stringValue)(&c.Server.PublicURL)},
+		{"TEMPLATES_DIR", "templates-dir", "Directory of HTML templates", (*stringValue)(&c.Server.TemplatesDir)},
+		{"MONGODB_URI", "database-uri", "MongoDB connection string", (*stringValue)(&c.Database.URI)},
+		{"DATABASE_NAME", "database-name", "MongoDB database name", (*stringValue)(&c.Database.Name)},
+		{"UPLOAD_DIR", "upload-dir", "Directory stored files are kept in", (*stringValue)(&c.Storage.UploadDir)},
+		{"GC_INTERVAL", "gc-interval", "How often to sweep unreferenced files", &c.Storage.GCInterval},
+		{"GC_GRACE_PERIOD", "gc-grace-period", "Only sweep unreferenced files older than this", &c.Storage.GCGracePeriod},
+		{"MAX_UPLOAD_SIZE", "max-upload-size", "Largest wallpaper upload, in bytes", (*int64Value)(&c.Limits.MaxUploadSize)},
+		{"MAX_IMPORT_SIZE", "max-import-size", "Largest account import archive, in bytes", (*int64Value)(&c.Limits.MaxImportSize)},
+		{"TLS_CERT_FILE", "tls-cert-file", "Certificate to serve HTTPS with", (*stringValue)(&c.TLS.CertFile)},
+		{"TLS_KEY_FILE", "tls-key-file", "Private key of the HTTPS certificate", (*stringValue)(&c.TLS.KeyFile)},
+		{"MTLS", "mtls", "Issue client certificates to devices and accept them in place of API keys", (*boolValue)(&c.TLS.ClientCA.Enabled)},
+		{"TLS_CLIENT_CA_CERT_FILE", "tls-client-ca-cert-file", "Certificate of the device CA, created if missing", (*stringValue)(&c.TLS.ClientCA.CertFile)},
+		{"TLS_CLIENT_CA_KEY_FILE", "tls-client-ca-key-file", "Private key of the device CA, created if missing", (*stringValue)(&c.TLS.ClientCA.KeyFile)},
+		{"TLS_CLIENT_CERT_VALIDITY", "tls-client-cert-validity", "How long issued device certificates last", &c.TLS.ClientCA.Validity},
+		{"REGISTRATION", "registration", "Let anyone create an account", (*boolValue)(&c.Features.Registration)},
+		{"AUTO_MIGRATE", "auto-migrate", "Apply migrations at startup", (*boolValue)(&c.Features.AutoMigrate)},
+		{"RETENTION_INTERVAL", "retention-interval", "How often to enforce retention policies", &c.Jobs.RetentionInterval},
+		{"PLAYLIST_TICK", "playlist-tick", "How often to advance due playlists", &c.Jobs.PlaylistTick},
+		{"SCHEDULE_TICK", "schedule-tick", "How often to publish and expire scheduled wallpapers", &c.Jobs.ScheduleTick},
+		{"WEBHOOK_TICK", "webhook-tick", "How often to deliver due webhooks", &c.Jobs.WebhookTick},
+		{"ACCOUNT_DELETION_TICK", "account-deletion-tick", "How often to delete accounts queued for deletion", &c.Jobs.AccountDeletionTick},
+		{"WEBHOOK_ALLOW_PRIVATE", "webhook-allow-private", "Let webhooks deliver to private and loopback addresses", (*boolValue)(&c.Webhooks.AllowPrivate)},
+		{"IMPORT_STREAMS", "import-streams", "Official streams as device-id=source pairs", (*stringValue)(&c.Import.Streams)},
+		{"IMPORT_USERNAME", "import-username", "Account that owns the official streams", (*stringValue)(&c.Import.Username)},
+		{"IMPORT_INTERVAL", "import-interval", "How often to import official streams", &c.Import.Interval},
+		{"MQTT_BROKER", "mqtt-broker", "MQTT broker to mirror wallpaper changes to", (*stringValue)(&c.MQTT.Broker)},
+		{"MQTT_USERNAME", "mqtt-username", "MQTT username", (*stringValue)(&c.MQTT.Username)},
+		{"MQTT_PASSWORD", "mqtt-password", "MQTT password", (*stringValue)(&c.MQTT.Password)},
+		{"MQTT_CLIENT_ID", "mqtt-client-id", "MQTT client ID", (*stringValue)(&c.MQTT.ClientID)},
+		{"MQTT_TOPIC_PREFIX", "mqtt-topic-prefix", "Prefix of MQTT topics", (*stringValue)(&c.MQTT.TopicPrefix)},
+		{"MQTT_COMMANDS", "mqtt-commands", "Accept wallpaper commands over MQTT", (*boolValue)(&c.MQTT.Commands)},
+		{"METRICS", "metrics", "Serve Prometheus metrics at /metrics", (*boolValue)(&c.Metrics.Enabled)},
+		{"METRICS_ADDR", "metrics-addr", "Separate address to serve metrics on, e.g. 127.0.0.1:9090", (*stringValue)(&c.Metrics.Addr)},
+	}
+}
+
+// Load builds the config for a subcommand. The settings' flags are added to
+// flags, which is then parsed from args; a setting's flag default shows the
+// value it has before flags are applied.
+func Load(flags *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+
+	path := configPath(args)
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	flags.String("config", path, "YAML config file (default $"+ConfigEnv+")")
+	for _, s := range cfg.settings() {
+		flags.Var(s.value, s.flag, s.usage+" ($"+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configPath finds --config in args ahead of parsing them, since the file
+// has to be read before flags override it
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if value, ok := strings.CutPrefix(name, "config="); ok {
+			return value
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(ConfigEnv)
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	for _, s := range c.settings() {
+		raw, ok := os.LookupEnv(s.env)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := s.value.Set(raw); err != nil {
+			return fmt.Errorf("invalid %s=%q: %w", s.env, raw, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535")
+	if c.Server.PublicURL != "" {
+		u, err := url.Parse(c.Server.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "server.public_url must be an http or https URL")
+	}
+	check(c.Server.TemplatesDir != "", "server.templates_dir is required")
+
+	check(strings.HasPrefix(c.Database.URI, "mongodb://") || strings.HasPrefix(c.Database.URI, "mongodb+srv://"), "database.uri must be a mongodb:// or mongodb+srv:// URI")
+	check(c.Database.Name != "", "database.name is required")
+
+	check(c.Storage.UploadDir != "", "storage.upload_dir is required")
+	check(c.Limits.MaxUploadSize > 0, "limits.max_upload_size must be positive")
+	check(c.Limits.MaxImportSize > 0, "limits.max_import_size must be positive")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	for name, path := range map[string]string{"tls.cert_file": c.TLS.CertFile, "tls.key_file": c.TLS.KeyFile} {
+		if path != "" {
+			_, err := os.Stat(path)
+			check(err == nil, "%s: %v", name, err)
+		}
+	}
+	if c.TLS.ClientCA.Enabled {
+		check(c.TLS.Enabled(), "tls.client_ca requires tls.cert_file and tls.key_file")
+		check(c.TLS.ClientCA.CertFile != "" && c.TLS.ClientCA.KeyFile != "", "tls.client_ca.cert_file and tls.client_ca.key_file are required")
+		check(c.TLS.ClientCA.Validity > 0, "tls.client_ca.validity must be positive")
+	}
+
+	for name, d := range map[string]Duration{
+		"storage.gc_interval":        c.Storage.GCInterval,
+		"storage.gc_grace_period":    c.Storage.GCGracePeriod,
+		"jobs.retention_interval":    c.Jobs.RetentionInterval,
+		"jobs.playlist_tick":         c.Jobs.PlaylistTick,
+		"jobs.schedule_tick":         c.Jobs.ScheduleTick,
+		"jobs.webhook_tick":          c.Jobs.WebhookTick,
+		"jobs.account_deletion_tick": c.Jobs.AccountDeletionTick,
+		"import.interval":            c.Import.Interval,
+	} {
+		check(d > 0, "%s must be positive", name)
+	}
+	check(c.Import.Streams == "" || c.Import.Username != "", "import.username is required to import streams")
+
+	if c.MQTT.Broker != "" {
+		u, err := url.Parse(c.MQTT.Broker)
+		check(err == nil && u.Scheme != "" && u.Host != "", "mqtt.broker must be a URL such as tcp://localhost:1883")
+	}
+
+	if c.Metrics.Addr != "" {
+		_, _, err := net.SplitHostPort(c.Metrics.Addr)
+		check(err == nil, "metrics.addr must be host:port, such as 127.0.0.1:9090")
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Redacted returns a copy that is safe to print, with passwords and API keys
+// replaced
+func (c *Config) Redacted() *Config {
+	copied := *c
+	copied.Database.URI = redactURI(c.Database.URI)
+	copied.MQTT.Broker = redactURI(c.MQTT.Broker)
+	if c.MQTT.Password != "" {
+		copied.MQTT.Password = redacted
+	}
+	copied.Import.Streams = redactStreams(c.Import.Streams)
+	return &copied
+}
+
+// YAML renders the config in the config file format
+func (c *Config) YAML() ([]byte, error) {
+	var out strings.Builder
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(out.String()), nil
+}
+
+func redactURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// redactStreams hides the NASA API key of apod:<key> sources
+func redactStreams(raw string) string {
+	entries := strings.Split(raw, ",")
+	for i, entry := range entries {
+		deviceID, source, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if kind, key, ok := strings.Cut(strings.TrimSpace(source), ":"); ok && kind == "apod" && key != "" {
+			entries[i] = deviceID + "=apod:" + redacted
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// Duration is a time.Duration written as a string such as "90m" in the
+// config file
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(raw string) error {
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.Set(node.Value)
+}
+
+type stringValue string
+
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *intValue) Set(s string) error {
+	parsed, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(parsed)
+	return nil
+}
+
+type int64Value int64
+
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+func (v *int64Value) Set(s string) error {
+	parsed, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = int64Value(parsed)
+	return nil
+}
+
+type boolValue bool
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) Set(s string) error {
+	parsed, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(parsed)
+	return nil
+}
+
+// IsBoolFlag lets --flag stand for --flag=true
+func (v *boolValue) IsBoolFlag() bool { return true }
@@ -6,6 +6,14 @@ type Collections struct {
 	Users               *mongo.Collection
 	PublisherDevices    *mongo.Collection
 	PublishedWallpapers *mongo.Collection
+	UploadSessions      *mongo.Collection
+	Subscriptions       *mongo.Collection
+	Playlists           *mongo.Collection
+	Webhooks            *mongo.Collection
+	WebhookDeliveries   *mongo.Collection
+	DeviceTokens        *mongo.Collection
+	AuditEvents         *mongo.Collection
+	DeviceCertificates  *mongo.Collection
 }
 
 func NewCollections(db *mongo.Database) *Collections {
@@ -13,5 +21,30 @@ func NewCollections(db *mongo.Database) *Collections {
 		Users:               db.Collection("users"),
 		PublisherDevices:    db.Collection("publisher_devices"),
 		PublishedWallpapers: db.Collection("published_wallpapers"),
+		UploadSessions:      db.Collection("upload_sessions"),
+		Subscriptions:       db.Collection("subscriptions"),
+		Playlists:           db.Collection("playlists"),
+		Webhooks:            db.Collection("webhooks"),
+		WebhookDeliveries:   db.Collection("webhook_deliveries"),
+		DeviceTokens:        db.Collection("device_tokens"),
+		AuditEvents:         db.Collection("audit_events"),
+		DeviceCertificates:  db.Collection("device_certificates"),
+	}
+}
+
+// All returns every collection, in the order they are declared
+func (c *Collections) All() []*mongo.Collection {
+	return []*mongo.Collection{
+		c.Users,
+		c.PublisherDevices,
+		c.PublishedWallpapers,
+		c.UploadSessions,
+		c.Subscriptions,
+		c.Playlists,
+		c.Webhooks,
+		c.WebhookDeliveries,
+		c.DeviceTokens,
+		c.AuditEvents,
+		c.DeviceCertificates,
 	}
 }
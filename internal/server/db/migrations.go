@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationsCollection records which migrations have been applied
+const migrationsCollection = "schema_migrations"
+
+// Migration is one versioned change to the schema. Several servers may boot
+// at once, so Up must be safe to run more than once; creating an index that
+// already exists is a no-op.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, c *Collections) error
+}
+
+// AppliedMigration is the record of a migration that has run
+type AppliedMigration struct {
+	Version     int    `json:"version" bson:"_id"`
+	Description string `json:"description" bson:"description"`
+	AppliedAt   int64  `json:"applied_at" bson:"applied_at"`
+}
+
+// Migrations lists every migration in version order. New ones go at the end
+// with the next version; applied ones must not change.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "unique indexes",
+		Up: func(ctx context.Context, c *Collections) error {
+			// Databases from before these indexes can hold duplicates that
+			// would fail them. The newest record of each key is kept.
+			duplicates := []struct {
+				col  *mongo.Collection
+				keys []string
+			}{
+				{c.PublisherDevices, []string{"device_id"}},
+				{c.PublishedWallpapers, []string{"device_id", "hash"}},
+				{c.Subscriptions, []string{"user_id", "device_id"}},
+			}
+			for _, d := range duplicates {
+				if err := removeDuplicates(ctx, d.col, d.keys); err != nil {
+					return err
+				}
+			}
+
+			return createIndexes(ctx, map[*mongo.Collection][]mongo.IndexModel{
+				c.Users: {
+					uniqueIndex(bson.D{{Key: "id", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "username", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "api_key", Value: 1}}),
+				},
+				c.PublisherDevices: {
+					uniqueIndex(bson.D{{Key: "id", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "device_id", Value: 1}}),
+				},
+				c.PublishedWallpapers: {
+					uniqueIndex(bson.D{{Key: "id", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "device_id", Value: 1}, {Key: "hash", Value: 1}}),
+				},
+				c.UploadSessions: {uniqueIndex(bson.D{{Key: "id", Value: 1}})},
+				c.Subscriptions: {
+					uniqueIndex(bson.D{{Key: "id", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "user_id", Value: 1}, {Key: "device_id", Value: 1}}),
+				},
+				c.Playlists:         {uniqueIndex(bson.D{{Key: "id", Value: 1}})},
+				c.Webhooks:          {uniqueIndex(bson.D{{Key: "id", Value: 1}})},
+				c.WebhookDeliveries: {uniqueIndex(bson.D{{Key: "id", Value: 1}})},
+				c.DeviceTokens: {
+					uniqueIndex(bson.D{{Key: "id", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "token_hash", Value: 1}}),
+				},
+				c.AuditEvents: {uniqueIndex(bson.D{{Key: "id", Value: 1}})},
+			})
+		},
+	},
+	{
+		Version:     2,
+		Description: "lookup indexes",
+		Up: func(ctx context.Context, c *Collections) error {
+			return createIndexes(ctx, map[*mongo.Collection][]mongo.IndexModel{
+				c.Users: {
+					{Keys: bson.D{{Key: "deletion_requested_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+				},
+				c.PublisherDevices: {
+					{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				},
+				c.PublishedWallpapers: {
+					{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "hash", Value: 1}}},
+					{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "id", Value: -1}}},
+					{Keys: bson.D{{Key: "hash", Value: 1}}},
+					{Keys: bson.D{{Key: "url", Value: 1}}},
+					{Keys: bson.D{{Key: "monitors.url", Value: 1}}},
+					{Keys: bson.D{{Key: "variants.url", Value: 1}}},
+					{Keys: bson.D{{Key: "schedule_status", Value: 1}, {Key: "publish_at", Value: 1}}},
+					{Keys: bson.D{{Key: "schedule_status", Value: 1}, {Key: "expires_at", Value: 1}}},
+				},
+				c.UploadSessions: {
+					{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				},
+				c.Subscriptions: {
+					{Keys: bson.D{{Key: "device_id", Value: 1}}},
+				},
+				c.Playlists: {
+					{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "created_at", Value: 1}}},
+					{Keys: bson.D{{Key: "enabled", Value: 1}, {Key: "next_run_at", Value: 1}}},
+					{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				},
+				c.Webhooks: {
+					{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+				},
+				c.WebhookDeliveries: {
+					{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "id", Value: -1}}},
+					{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+					{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				},
+				c.DeviceTokens: {
+					{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "created_at", Value: 1}}},
+					{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				},
+				c.AuditEvents: {
+					{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "id", Value: -1}}},
+				},
+			})
+		},
+	},
+	{
+		Version:     3,
+		Description: "device certificates",
+		Up: func(ctx context.Context, c *Collections) error {
+			return createIndexes(ctx, map[*mongo.Collection][]mongo.IndexModel{
+				c.DeviceCertificates: {
+					uniqueIndex(bson.D{{Key: "id", Value: 1}}),
+					uniqueIndex(bson.D{{Key: "fingerprint", Value: 1}}),
+					{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "created_at", Value: 1}}},
+					{Keys: bson.D{{Key: "user_id", Value: 1}}},
+				},
+			})
+		},
+	},
+}
+
+// removeDuplicates deletes all but the newest record, by created_at, of each
+// combination of keys that occurs more than once
+func removeDuplicates(ctx context.Context, col *mongo.Collection, keys []string) error {
+	group := bson.M{}
+	for _, key := range keys {
+		group[key] = "$" + key
+	}
+	cursor, err := col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": group, "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("%s: %w", col.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var removed int64
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		result, err := col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+		if err != nil {
+			return fmt.Errorf("%s: %w", col.Name(), err)
+		}
+		removed += result.DeletedCount
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("%s: %w", col.Name(), err)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d duplicate records from %s, keeping the newest of each", removed, col.Name())
+	}
+	return nil
+}
+
+func uniqueIndex(keys bson.D) mongo.IndexModel {
+	return mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(true)}
+}
+
+func createIndexes(ctx context.Context, indexes map[*mongo.Collection][]mongo.IndexModel) error {
+	for col, models := range indexes {
+		if _, err := col.Indexes().CreateMany(ctx, models); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return fmt.Errorf("%s has duplicate records, remove them and try again: %w", col.Name(), err)
+			}
+			return fmt.Errorf("%s: %w", col.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Migrate applies the migrations that haven't run yet, in order, and returns
+// the ones it applied. It stops at the first failure; the migrations before
+// it stay recorded.
+func Migrate(ctx context.Context, c *Collections) ([]AppliedMigration, error) {
+	applied, err := AppliedMigrations(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	done := map[int]bool{}
+	for _, migration := range applied {
+		done[migration.Version] = true
+	}
+
+	col := c.Users.Database().Collection(migrationsCollection)
+	ran := []AppliedMigration{}
+	for _, migration := range Migrations {
+		if done[migration.Version] {
+			continue
+		}
+		log.Printf("Applying migration %d: %s", migration.Version, migration.Description)
+		if err := migration.Up(ctx, c); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+
+		record := AppliedMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().Unix(),
+		}
+		// Another server may have finished the same migration meanwhile
+		if _, err := col.UpdateOne(ctx,
+			bson.M{"_id": record.Version},
+			bson.M{"$setOnInsert": bson.M{"description": record.Description, "applied_at": record.AppliedAt}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return ran, err
+		}
+		ran = append(ran, record)
+	}
+	return ran, nil
+}
+
+// AppliedMigrations returns the migrations recorded as applied, oldest first
+func AppliedMigrations(ctx context.Context, c *Collections) ([]AppliedMigration, error) {
+	cursor, err := c.Users.Database().Collection(migrationsCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := []AppliedMigration{}
+	if err := cursor.All(ctx, &applied); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"time"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func Connect(uri string) (*mongo.Client, error) {
+// Connect connects to MongoDB. monitor, if not nil, observes every command.
+func Connect(uri string, monitor *event.CommandMonitor) (*mongo.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	return mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	opts := options.Client().ApplyURI(uri)
+	if monitor != nil {
+		opts.SetMonitor(monitor)
+	}
+	return mongo.Connect(ctx, opts)
 }
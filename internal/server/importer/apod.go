@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APOD imports NASA's Astronomy Picture of the Day
+type APOD struct {
+	// BaseURL is the APOD API endpoint, overridable for testing
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewAPOD(apiKey string) *APOD {
+	if apiKey == "" {
+		apiKey = "DEMO_KEY"
+	}
+	return &APOD{BaseURL: "https://api.nasa.gov/planetary/apod", APIKey: apiKey, Client: defaultClient}
+}
+
+func (a *APOD) Name() string {
+	return "NASA Astronomy Picture of the Day"
+}
+
+type apodResponse struct {
+	Copyright   string `json:"copyright"`
+	Date        string `json:"date"`
+	Explanation string `json:"explanation"`
+	HDURL       string `json:"hdurl"`
+	MediaType   string `json:"media_type"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+}
+
+func (a *APOD) Latest(ctx context.Context) (*Item, error) {
+	body, err := get(ctx, a.Client, a.BaseURL+"?api_key="+url.QueryEscape(a.APIKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var apod apodResponse
+	if err := json.Unmarshal(body, &apod); err != nil {
+		return nil, fmt.Errorf("invalid APOD response: %w", err)
+	}
+	// Some days are videos
+	if apod.MediaType != "image" {
+		return nil, ErrNoImage
+	}
+
+	imageURL := apod.HDURL
+	if imageURL == "" {
+		imageURL = apod.URL
+	}
+
+	// Each day has a page like https://apod.nasa.gov/apod/ap240101.html
+	sourceURL := imageURL
+	if date, err := time.Parse("2006-01-02", apod.Date); err == nil {
+		sourceURL = "https://apod.nasa.gov/apod/ap" + date.Format("060102") + ".html"
+	}
+
+	// Images without a copyright holder are NASA's and in the public domain
+	author, license := strings.TrimSpace(apod.Copyright), ""
+	if author == "" {
+		author, license = "NASA", "Public Domain"
+	}
+
+	return &Item{
+		ImageURL: imageURL,
+		Metadata: metadata(apod.Title, apod.Explanation, sourceURL, author, license, "nasa", "apod", "space"),
+	}, nil
+}
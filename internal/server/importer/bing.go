@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Bing imports Bing's image of the day
+type Bing struct {
+	// BaseURL is the Bing host, overridable for testing
+	BaseURL string
+	Market  string
+	Client  *http.Client
+}
+
+func NewBing(market string) *Bing {
+	if market == "" {
+		market = "en-US"
+	}
+	return &Bing{BaseURL: "https://www.bing.com", Market: market, Client: defaultClient}
+}
+
+func (b *Bing) Name() string {
+	return "Bing Daily (" + b.Market + ")"
+}
+
+type bingArchive struct {
+	Images []struct {
+		StartDate     string `json:"startdate"`
+		URL           string `json:"url"`
+		URLBase       string `json:"urlbase"`
+		Copyright     string `json:"copyright"`
+		CopyrightLink string `json:"copyrightlink"`
+		Title         string `json:"title"`
+	} `json:"images"`
+}
+
+func (b *Bing) Latest(ctx context.Context) (*Item, error) {
+	query := url.Values{}
+	query.Set("format", "js")
+	query.Set("idx", "0")
+	query.Set("n", "1")
+	query.Set("mkt", b.Market)
+
+	body, err := get(ctx, b.Client, b.BaseURL+"/HPImageArchive.aspx?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var archive bingArchive
+	if err := json.Unmarshal(body, &archive); err != nil {
+		return nil, fmt.Errorf("invalid Bing response: %w", err)
+	}
+	if len(archive.Images) == 0 {
+		return nil, ErrNoImage
+	}
+	image := archive.Images[0]
+
+	// urlbase without a size suffix gives the largest rendition
+	imageURL := b.BaseURL + image.URL
+	if image.URLBase != "" {
+		imageURL = b.BaseURL + image.URLBase + "_UHD.jpg"
+	}
+
+	// Copyright looks like "Description (© Author/Agency)"
+	description, author := image.Copyright, ""
+	if i := strings.LastIndex(image.Copyright, "(©"); i >= 0 {
+		description = strings.TrimSpace(image.Copyright[:i])
+		author = strings.TrimSpace(strings.TrimSuffix(image.Copyright[i+len("(©"):], ")"))
+	}
+
+	sourceURL := image.CopyrightLink
+	if !strings.HasPrefix(sourceURL, "http") {
+		sourceURL = imageURL
+	}
+
+	return &Item{
+		ImageURL: imageURL,
+		Metadata: metadata(image.Title, description, sourceURL, author, "", "bing"),
+	}, nil
+}
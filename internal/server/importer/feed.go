@@ -0,0 +1,246 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const mediaNS = "http://search.yahoo.com/mrss/"
+
+// Feed imports the newest image from an RSS 2.0, Atom or Media RSS feed.
+// Images are taken from media:content, enclosures or enclosure links.
+type Feed struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewFeed(feedURL string) *Feed {
+	return &Feed{URL: feedURL, Client: defaultClient}
+}
+
+func (f *Feed) Name() string {
+	if u, err := url.Parse(f.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return f.URL
+}
+
+type mediaContent struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+	Width  int    `xml:"width,attr"`
+}
+
+// mediaFields are the Media RSS elements shared by RSS items and Atom entries
+type mediaFields struct {
+	MediaContents []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaGroup    struct {
+		Contents []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
+	MediaCredit  string `xml:"http://search.yahoo.com/mrss/ credit"`
+	MediaLicense struct {
+		Text string `xml:",chardata"`
+		Href string `xml:"href,attr"`
+	} `xml:"http://search.yahoo.com/mrss/ license"`
+}
+
+// image returns the widest image in the media elements, if any
+func (m *mediaFields) image() string {
+	best, bestWidth := "", -1
+	for _, content := range append(m.MediaContents, m.MediaGroup.Contents...) {
+		isImage := content.Medium == "image" || strings.HasPrefix(content.Type, "image/")
+		if content.URL != "" && isImage && content.Width > bestWidth {
+			best, bestWidth = content.URL, content.Width
+		}
+	}
+	return best
+}
+
+func (m *mediaFields) license() string {
+	if text := strings.TrimSpace(m.MediaLicense.Text); text != "" {
+		return text
+	}
+	return m.MediaLicense.Href
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	mediaFields
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	Enclosures  []struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+}
+
+type atomFeed struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	mediaFields
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+	Summary string `xml:"summary"`
+	Content string `xml:"content"`
+	Rights  string `xml:"rights"`
+	Author  struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+func (f *Feed) Latest(ctx context.Context) (*Item, error) {
+	body, err := get(ctx, f.Client, f.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, fmt.Errorf("invalid RSS feed: %w", err)
+		}
+		for _, item := range feed.Channel.Items {
+			if imported := f.rssItem(&item); imported != nil {
+				return imported, nil
+			}
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, fmt.Errorf("invalid Atom feed: %w", err)
+		}
+		for _, entry := range feed.Entries {
+			if imported := f.atomEntry(&entry); imported != nil {
+				return imported, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed format <%s>", root)
+	}
+	return nil, ErrNoImage
+}
+
+func (f *Feed) rssItem(item *rssItem) *Item {
+	imageURL := item.image()
+	for _, enclosure := range item.Enclosures {
+		if imageURL == "" && strings.HasPrefix(enclosure.Type, "image/") {
+			imageURL = enclosure.URL
+		}
+	}
+	if imageURL == "" {
+		return nil
+	}
+
+	author := firstNonEmpty(item.MediaCredit, item.Creator, item.Author)
+	sourceURL := firstNonEmpty(item.Link, imageURL)
+	return &Item{
+		ImageURL: f.resolve(imageURL),
+		Metadata: metadata(item.Title, stripHTML(item.Description), f.resolve(sourceURL), author, item.license(), item.Categories...),
+	}
+}
+
+func (f *Feed) atomEntry(entry *atomEntry) *Item {
+	imageURL, link := entry.image(), ""
+	for _, l := range entry.Links {
+		switch {
+		case l.Rel == "enclosure" && strings.HasPrefix(l.Type, "image/") && imageURL == "":
+			imageURL = l.Href
+		case (l.Rel == "" || l.Rel == "alternate") && link == "":
+			link = l.Href
+		}
+	}
+	if imageURL == "" {
+		return nil
+	}
+
+	var tags []string
+	for _, category := range entry.Categories {
+		tags = append(tags, category.Term)
+	}
+
+	author := firstNonEmpty(entry.MediaCredit, entry.Author.Name)
+	sourceURL := firstNonEmpty(link, imageURL)
+	description := stripHTML(firstNonEmpty(entry.Summary, entry.Content))
+	license := firstNonEmpty(entry.license(), entry.Rights)
+	return &Item{
+		ImageURL: f.resolve(imageURL),
+		Metadata: metadata(entry.Title, description, f.resolve(sourceURL), author, license, tags...),
+	}
+}
+
+// resolve makes a possibly relative URL in the feed absolute
+func (f *Feed) resolve(ref string) string {
+	base, err := url.Parse(f.URL)
+	if err != nil {
+		return ref
+	}
+	resolved, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return resolved.String()
+}
+
+// rootElement returns the local name of the document's first element
+func rootElement(body []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("invalid feed: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML turns an HTML description into plain text
+func stripHTML(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(s, " "))), " ")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+// Package importer fetches wallpapers from outside image sources, such as
+// Bing's image of the day, for the official streams.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// maxResponseSize bounds how much of a feed or API response is read
+const maxResponseSize = 10 << 20
+
+// ErrNoImage is returned when a source currently has nothing to import, such
+// as an APOD that is a video
+var ErrNoImage = errors.New("no image available")
+
+// Item is the latest image a source offers, with attribution
+type Item struct {
+	ImageURL string
+	Metadata repository.WallpaperMetadata
+}
+
+// Importer is an image source an official stream publishes from
+type Importer interface {
+	// Name is shown as the stream's name in the catalog
+	Name() string
+	// Latest returns the source's current image
+	Latest(ctx context.Context) (*Item, error)
+}
+
+// Stream ties an importer to the device it publishes to
+type Stream struct {
+	DeviceID string
+	Importer Importer
+}
+
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// ParseStreams parses a comma separated list of device-id=source entries,
+// where source is one of
+//
+//	bing[:market]       Bing image of the day, e.g. bing:de-DE
+//	apod[:api-key]      NASA Astronomy Picture of the Day
+//	feed:<url>          the newest image in an RSS, Atom or Media RSS feed
+func ParseStreams(spec string) ([]Stream, error) {
+	var streams []Stream
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		deviceID, source, ok := strings.Cut(entry, "=")
+		if !ok || deviceID == "" {
+			return nil, fmt.Errorf("invalid import stream %q: expected device-id=source", entry)
+		}
+		kind, arg, _ := strings.Cut(source, ":")
+
+		var imp Importer
+		switch kind {
+		case "bing":
+			imp = NewBing(arg)
+		case "apod":
+			imp = NewAPOD(arg)
+		case "feed":
+			if arg == "" {
+				return nil, fmt.Errorf("invalid import stream %q: feed needs a URL", entry)
+			}
+			imp = NewFeed(arg)
+		default:
+			return nil, fmt.Errorf("invalid import stream %q: unknown source %q", entry, kind)
+		}
+		streams = append(streams, Stream{DeviceID: deviceID, Importer: imp})
+	}
+	return streams, nil
+}
+
+// get fetches url and returns its body, failing on non-2xx responses
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "wallstream-importer")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// serveFixture serves testdata/name for every request and records the last
+// request's URL
+func serveFixture(t *testing.T, name string, status int) (*httptest.Server, *url.URL) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested := &url.URL{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requested = *r.URL
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, requested
+}
+
+func TestBing(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		status  int
+		// want is relative to the test server's URL
+		wantImage string
+		wantMeta  repository.WallpaperMetadata
+		wantErr   error
+	}{
+		{
+			name:      "image of the day",
+			fixture:   "bing.json",
+			status:    http.StatusOK,
+			wantImage: "/th?id=OHR.FrozenFalls_EN-US1234567890_UHD.jpg",
+			wantMeta: repository.WallpaperMetadata{
+				Title:       "Winter's grip",
+				Description: "Frozen waterfall in Iceland",
+				SourceURL:   "https://www.bing.com/search?q=frozen+waterfall",
+				Author:      "Jane Doe/Getty Images",
+				Tags:        []string{"bing"},
+			},
+		},
+		{name: "no images", fixture: "bing_empty.json", status: http.StatusOK, wantErr: ErrNoImage},
+		{name: "server error", fixture: "bing_empty.json", status: http.StatusInternalServerError, wantErr: errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requested := serveFixture(t, tt.fixture, tt.status)
+			bing := NewBing("de-DE")
+			bing.BaseURL = server.URL
+
+			item, err := bing.Latest(context.Background())
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("Latest() error = %v, want %v", err, tt.wantErr)
+			}
+			if requested.Path != "/HPImageArchive.aspx" || requested.Query().Get("mkt") != "de-DE" {
+				t.Errorf("requested %s, want /HPImageArchive.aspx with mkt=de-DE", requested)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if want := server.URL + tt.wantImage; item.ImageURL != want {
+				t.Errorf("ImageURL = %q, want %q", item.ImageURL, want)
+			}
+			if !reflect.DeepEqual(item.Metadata, tt.wantMeta) {
+				t.Errorf("Metadata = %+v, want %+v", item.Metadata, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestAPOD(t *testing.T) {
+	tests := []struct {
+		name      string
+		fixture   string
+		wantImage string
+		wantMeta  repository.WallpaperMetadata
+		wantErr   error
+	}{
+		{
+			name:      "public domain image prefers hdurl",
+			fixture:   "apod_image.json",
+			wantImage: "https://apod.nasa.gov/apod/image/2601/Galaxy_Hubble_4000.jpg",
+			wantMeta: repository.WallpaperMetadata{
+				Title:       "A Spiral in Sculptor",
+				Description: "A spiral galaxy some 30 million light-years away.",
+				SourceURL:   "https://apod.nasa.gov/apod/ap260118.html",
+				Author:      "NASA",
+				License:     "Public Domain",
+				Tags:        []string{"nasa", "apod", "space"},
+			},
+		},
+		{
+			name:      "copyrighted image without hdurl",
+			fixture:   "apod_copyright.json",
+			wantImage: "https://apod.nasa.gov/apod/image/2601/StarTrails_Smith_1080.jpg",
+			wantMeta: repository.WallpaperMetadata{
+				Title:       "Star Trails",
+				Description: "Star trails over a desert observatory.",
+				SourceURL:   "https://apod.nasa.gov/apod/ap260117.html",
+				Author:      "John Smith",
+				Tags:        []string{"nasa", "apod", "space"},
+			},
+		},
+		{name: "video day", fixture: "apod_video.json", wantErr: ErrNoImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requested := serveFixture(t, tt.fixture, http.StatusOK)
+			apod := NewAPOD("test-key")
+			apod.BaseURL = server.URL
+
+			item, err := apod.Latest(context.Background())
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("Latest() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := requested.Query().Get("api_key"); got != "test-key" {
+				t.Errorf("api_key = %q, want test-key", got)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if item.ImageURL != tt.wantImage {
+				t.Errorf("ImageURL = %q, want %q", item.ImageURL, tt.wantImage)
+			}
+			if !reflect.DeepEqual(item.Metadata, tt.wantMeta) {
+				t.Errorf("Metadata = %+v, want %+v", item.Metadata, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// wantImage and wantSource starting with "/" are relative to the
+		// test server's URL
+		wantImage  string
+		wantSource string
+		wantMeta   repository.WallpaperMetadata
+		wantErr    error
+	}{
+		{
+			name:       "rss enclosure with relative links",
+			fixture:    "rss.xml",
+			wantImage:  "/images/harbour.jpg",
+			wantSource: "/posts/harbour",
+			wantMeta: repository.WallpaperMetadata{
+				Title:       "Harbour at Dawn",
+				Description: "Boats at first light & calm water.",
+				Author:      "Ana Lima",
+				Tags:        []string{"harbour", "sunrise"},
+			},
+		},
+		{
+			name:       "media rss picks the widest image",
+			fixture:    "mrss.xml",
+			wantImage:  "https://gallery.example.com/alpine-lake-3840.jpg",
+			wantSource: "https://gallery.example.com/alpine-lake",
+			wantMeta: repository.WallpaperMetadata{
+				Title:       "Alpine Lake",
+				Description: "Still water below the peaks.",
+				Author:      "Kai Berg",
+				License:     "CC BY 4.0",
+			},
+		},
+		{
+			name:       "atom enclosure link",
+			fixture:    "atom.xml",
+			wantImage:  "https://desert.example.com/dunes.png",
+			wantSource: "https://desert.example.com/dunes",
+			wantMeta: repository.WallpaperMetadata{
+				Title:       "Dunes at Sunset",
+				Description: "Long shadows across the sand.",
+				Author:      "Omar Haddad",
+				License:     "All rights reserved",
+				Tags:        []string{"desert", "sunset"},
+			},
+		},
+		{name: "no images", fixture: "no_images.xml", wantErr: ErrNoImage},
+		{name: "not a feed", fixture: "unsupported.xml", wantErr: errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := serveFixture(t, tt.fixture, http.StatusOK)
+			feed := NewFeed(server.URL + "/feed.xml")
+
+			item, err := feed.Latest(context.Background())
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("Latest() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			resolve := func(s string) string {
+				if len(s) > 0 && s[0] == '/' {
+					return server.URL + s
+				}
+				return s
+			}
+			want := tt.wantMeta
+			want.SourceURL = resolve(tt.wantSource)
+			if item.ImageURL != resolve(tt.wantImage) {
+				t.Errorf("ImageURL = %q, want %q", item.ImageURL, resolve(tt.wantImage))
+			}
+			if !reflect.DeepEqual(item.Metadata, want) {
+				t.Errorf("Metadata = %+v, want %+v", item.Metadata, want)
+			}
+		})
+	}
+}
+
+func TestParseStreams(t *testing.T) {
+	streams, err := ParseStreams("daily=bing:en-GB, space=apod, photos=feed:https://example.com/rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"daily", "space", "photos"}
+	if len(streams) != len(want) {
+		t.Fatalf("got %d streams, want %d", len(streams), len(want))
+	}
+	for i, stream := range streams {
+		if stream.DeviceID != want[i] {
+			t.Errorf("stream %d device = %q, want %q", i, stream.DeviceID, want[i])
+		}
+	}
+
+	for _, spec := range []string{"daily", "daily=unknown", "photos=feed"} {
+		if _, err := ParseStreams(spec); err == nil {
+			t.Errorf("ParseStreams(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+// errAny stands for any non-nil error in test tables
+var errAny = errors.New("any error")
+
+func matchErr(err, want error) bool {
+	switch want {
+	case nil:
+		return err == nil
+	case errAny:
+		return err != nil
+	}
+	return errors.Is(err, want)
+}
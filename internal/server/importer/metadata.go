@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// Limits that keep imported metadata within what publishing accepts
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 4000
+	maxAuthorLength      = 200
+	maxLicenseLength     = 64
+	maxTags              = 20
+	maxTagLength         = 32
+)
+
+// metadata builds attribution metadata, shortening values that are too long
+// rather than failing the import over them
+func metadata(title, description, sourceURL, author, license string, tags ...string) repository.WallpaperMetadata {
+	var kept []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && len(tag) <= maxTagLength && len(kept) < maxTags {
+			kept = append(kept, tag)
+		}
+	}
+
+	// Publishing only accepts web links as sources
+	if u, err := url.Parse(sourceURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		sourceURL = ""
+	}
+
+	return repository.WallpaperMetadata{
+		Title:       truncate(title, maxTitleLength),
+		Description: truncate(description, maxDescriptionLength),
+		SourceURL:   sourceURL,
+		Author:      truncate(author, maxAuthorLength),
+		License:     truncate(license, maxLicenseLength),
+		Tags:        kept,
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return strings.TrimSpace(s[:n])
+}
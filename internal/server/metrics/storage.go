@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storageScanInterval bounds how often the upload directory is walked, since
+// scrapes can come far more often than usage meaningfully changes
+const storageScanInterval = time.Minute
+
+// StorageCollector reports the size and number of files in the upload
+// directory, including in-flight uploads in its subdirectories
+type StorageCollector struct {
+	uploadDir string
+	bytes     *prometheus.Desc
+	files     *prometheus.Desc
+
+	mu        sync.Mutex
+	scannedAt time.Time
+	usedBytes int64
+	fileCount int64
+}
+
+func NewStorageCollector(uploadDir string) *StorageCollector {
+	return &StorageCollector{
+		uploadDir: uploadDir,
+		bytes:     prometheus.NewDesc(namespace+"_storage_bytes", "Bytes used by the upload directory.", nil, nil),
+		files:     prometheus.NewDesc(namespace+"_storage_files", "Files in the upload directory.", nil, nil),
+	}
+}
+
+func (c *StorageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.files
+}
+
+func (c *StorageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	if time.Since(c.scannedAt) >= storageScanInterval {
+		c.usedBytes, c.fileCount = c.scan()
+		c.scannedAt = time.Now()
+	}
+	usedBytes, fileCount := c.usedBytes, c.fileCount
+	c.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(usedBytes))
+	ch <- prometheus.MustNewConstMetric(c.files, prometheus.GaugeValue, float64(fileCount))
+}
+
+// scan walks the upload directory. Files that vanish mid-walk, as uploads
+// are moved into place or swept, are skipped.
+func (c *StorageCollector) scan() (usedBytes, fileCount int64) {
+	filepath.WalkDir(c.uploadDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		usedBytes += info.Size()
+		fileCount++
+		return nil
+	})
+	return usedBytes, fileCount
+}
@@ -0,0 +1,285 @@
+// Package mqttbridge mirrors wallpaper changes to an MQTT broker for home
+// automation, and can accept commands to switch a device's wallpaper.
+//
+// Every change is published, retained, to <prefix>/<user>/<device>/current.
+// With commands enabled, publishing {"hash": "...", "token": "..."} to
+// <prefix>/<user>/<device>/set makes that wallpaper current, like a rollback.
+// The token must be a device token of that device; commands without one are
+// ignored. Anyone who can read the set topics sees the tokens, so the broker's
+// ACLs have to keep others from subscribing to or publishing on them.
+// The bridge's availability is kept in <prefix>/status as online or offline.
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+)
+
+const (
+	// queueSize bounds the changes waiting to be published. Changes beyond it
+	// are dropped rather than slowing down publishing.
+	queueSize      = 100
+	publishTimeout = 10 * time.Second
+	commandTimeout = 30 * time.Second
+)
+
+// Config configures the bridge. Broker is a URL such as tcp://localhost:1883
+// or ssl://broker:8883.
+type Config struct {
+	Broker      string
+	Username    string
+	Password    string
+	ClientID    string
+	TopicPrefix string
+	// PublicURL is prepended to the thumbnail paths in messages, e.g.
+	// https://wallstream.example.com
+	PublicURL string
+	// Commands subscribes to the set topics. With several servers, enable it
+	// on only one of them so each command is applied once.
+	Commands bool
+}
+
+// Command is the payload of a set topic
+type Command struct {
+	Hash string `json:"hash"`
+	// Token is a device token of the device named by the topic
+	Token string `json:"token"`
+}
+
+// CurrentMessage is the retained payload of a device's current topic
+type CurrentMessage struct {
+	User         string                       `json:"user"`
+	DeviceID     string                       `json:"device_id"`
+	Hash         string                       `json:"hash"`
+	ChangedAt    int64                        `json:"changed_at"`
+	ThumbnailURL string                       `json:"thumbnail_url"`
+	Metadata     repository.WallpaperMetadata `json:"metadata"`
+}
+
+// The bridge only needs lookups from the repositories and token checks from
+// the publisher service, so tests can stand in for them without a database
+type (
+	userLookup interface {
+		GetUserByID(ctx context.Context, id string) (*repository.User, error)
+		GetUserByUsername(ctx context.Context, username string) (*repository.User, error)
+	}
+	deviceLookup interface {
+		GetPublisherDeviceByDeviceID(ctx context.Context, deviceID string) (*repository.PublisherDevice, error)
+	}
+	wallpaperLookup interface {
+		GetPublishedWallpaperByDeviceIDAndHash(ctx context.Context, deviceID, hash string) (*repository.PublishedWallpaper, error)
+	}
+	commandPublisher interface {
+		AuthenticateDeviceToken(ctx context.Context, value string) (*repository.DeviceToken, error)
+		RollbackWithDeviceToken(ctx context.Context, token *repository.DeviceToken, hash string) (*repository.PublishedWallpaper, error)
+	}
+)
+
+type Bridge struct {
+	config                 Config
+	client                 mqtt.Client
+	usersRepo              userLookup
+	publisherRepo          deviceLookup
+	publishedWallpaperRepo wallpaperLookup
+	publisherService       commandPublisher
+	changes                chan service.WallpaperChange
+}
+
+func New(config Config, usersRepo *repository.UsersRepository, publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, publisherService *service.PublisherService) *Bridge {
+	return newBridge(config, usersRepo, publisherRepo, publishedWallpaperRepo, publisherService)
+}
+
+func newBridge(config Config, usersRepo userLookup, publisherRepo deviceLookup, publishedWallpaperRepo wallpaperLookup, publisherService commandPublisher) *Bridge {
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = "wallstream"
+	}
+	config.TopicPrefix = strings.TrimSuffix(config.TopicPrefix, "/")
+	config.PublicURL = strings.TrimSuffix(config.PublicURL, "/")
+
+	return &Bridge{
+		config:                 config,
+		usersRepo:              usersRepo,
+		publisherRepo:          publisherRepo,
+		publishedWallpaperRepo: publishedWallpaperRepo,
+		publisherService:       publisherService,
+		changes:                make(chan service.WallpaperChange, queueSize),
+	}
+}
+
+// HandleEvent is the service.EventListener that feeds the bridge
+func (b *Bridge) HandleEvent(ctx context.Context, event string, userIDs []string, data interface{}) {
+	if event != service.EventWallpaperChanged {
+		return
+	}
+	change, ok := data.(service.WallpaperChange)
+	if !ok {
+		return
+	}
+	select {
+	case b.changes <- change:
+	default:
+		log.Printf("MQTT: queue full, dropped change of device %s", change.DeviceID)
+	}
+}
+
+// Run connects to the broker and publishes changes until ctx is cancelled.
+// Connection failures are retried in the background.
+func (b *Bridge) Run(ctx context.Context) {
+	statusTopic := b.config.TopicPrefix + "/status"
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.config.Broker).
+		SetClientID(b.config.ClientID).
+		SetUsername(b.config.Username).
+		SetPassword(b.config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(false).
+		SetWill(statusTopic, "offline", 1, true)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Printf("MQTT: connected to %s", b.config.Broker)
+		client.Publish(statusTopic, 1, true, "online")
+		if b.config.Commands {
+			// Subscriptions don't survive a reconnect with a clean session
+			topic := b.config.TopicPrefix + "/+/+/set"
+			if token := client.Subscribe(topic, 1, b.commandHandler(ctx)); token.WaitTimeout(publishTimeout) && token.Error() != nil {
+				log.Printf("MQTT: failed to subscribe to %s: %v", topic, token.Error())
+			}
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Printf("MQTT: connection lost: %v", err)
+	})
+
+	b.client = mqtt.NewClient(opts)
+	connected := b.client.Connect()
+	log.Printf("MQTT: bridging to %s under %s/", b.config.Broker, b.config.TopicPrefix)
+
+	// Publishes made before the first connection is up are dropped by the
+	// client, so changes wait in the queue until then
+	select {
+	case <-ctx.Done():
+		b.client.Disconnect(250)
+		return
+	case <-connected.Done():
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if b.client.IsConnected() {
+				b.client.Publish(statusTopic, 1, true, "offline").WaitTimeout(time.Second)
+			}
+			b.client.Disconnect(250)
+			return
+		case change := <-b.changes:
+			if err := b.publishChange(ctx, change); err != nil {
+				log.Printf("MQTT: failed to publish change of device %s: %v", change.DeviceID, err)
+			}
+		}
+	}
+}
+
+func (b *Bridge) publishChange(ctx context.Context, change service.WallpaperChange) error {
+	publisherDevice, err := b.publisherRepo.GetPublisherDeviceByDeviceID(ctx, change.DeviceID)
+	if err != nil || publisherDevice == nil {
+		return fmt.Errorf("device not found: %v", err)
+	}
+	user, err := b.usersRepo.GetUserByID(ctx, publisherDevice.UserID)
+	if err != nil || user == nil {
+		return fmt.Errorf("owner not found: %v", err)
+	}
+	if !validTopicLevel(user.Username) || !validTopicLevel(change.DeviceID) {
+		return fmt.Errorf("user %q or device %q can't be used in a topic", user.Username, change.DeviceID)
+	}
+
+	message := CurrentMessage{
+		User:         user.Username,
+		DeviceID:     change.DeviceID,
+		Hash:         change.Hash,
+		ChangedAt:    change.ChangedAt,
+		ThumbnailURL: b.thumbnailURL(publisherDevice),
+	}
+	publishedWallpaper, err := b.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, change.DeviceID, change.Hash)
+	if err != nil {
+		return err
+	}
+	if publishedWallpaper != nil {
+		message.Metadata = publishedWallpaper.WallpaperMetadata
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	topic := fmt.Sprintf("%s/%s/%s/current", b.config.TopicPrefix, user.Username, change.DeviceID)
+	token := b.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+// thumbnailURL links the catalog thumbnail of public streams, which needs no
+// credentials, and the owner's thumbnail otherwise
+func (b *Bridge) thumbnailURL(publisherDevice *repository.PublisherDevice) string {
+	if publisherDevice.Public {
+		return fmt.Sprintf("%s/api/catalog/streams/%s/thumbnail", b.config.PublicURL, url.PathEscape(publisherDevice.DeviceID))
+	}
+	return fmt.Sprintf("%s/api/wallpaper/%s/thumbnail", b.config.PublicURL, url.PathEscape(publisherDevice.DeviceID))
+}
+
+// commandHandler switches the current wallpaper of the device named by a set
+// topic to the hash in the payload, if the payload's token is one of that
+// device's
+func (b *Bridge) commandHandler(ctx context.Context) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		levels := strings.Split(strings.TrimPrefix(msg.Topic(), b.config.TopicPrefix+"/"), "/")
+		if len(levels) != 3 || levels[2] != "set" {
+			return
+		}
+		username, deviceID := levels[0], levels[1]
+
+		var command Command
+		if err := json.Unmarshal(msg.Payload(), &command); err != nil {
+			log.Printf("MQTT: invalid command on %s: %v", msg.Topic(), err)
+			return
+		}
+		if command.Hash == "" || command.Token == "" {
+			log.Printf("MQTT: ignored command on %s without a hash and device token", msg.Topic())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+
+		token, err := b.publisherService.AuthenticateDeviceToken(ctx, command.Token)
+		if err != nil {
+			log.Printf("MQTT: rejected command on %s: %v", msg.Topic(), err)
+			return
+		}
+		user, err := b.usersRepo.GetUserByUsername(ctx, username)
+		if err != nil || user == nil || user.ID != token.UserID || token.DeviceID != deviceID {
+			log.Printf("MQTT: rejected command on %s: token is not for this device", msg.Topic())
+			return
+		}
+		if _, err := b.publisherService.RollbackWithDeviceToken(ctx, token, command.Hash); err != nil {
+			log.Printf("MQTT: failed to switch device %s to %s: %v", deviceID, command.Hash, err)
+		}
+	}
+}
+
+// validTopicLevel reports whether s can be used as a single level of a topic
+// name
+func validTopicLevel(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "/+#\x00")
+}
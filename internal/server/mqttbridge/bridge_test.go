@@ -0,0 +1,261 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	broker "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/service"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakeStore stands in for the repositories and publisher service. Rollbacks
+// tell the bridge about the change, as the publisher service's listeners do.
+type fakeStore struct {
+	users      []*repository.User
+	devices    []*repository.PublisherDevice
+	wallpapers []*repository.PublishedWallpaper
+	tokens     map[string]*repository.DeviceToken
+
+	bridge    *Bridge
+	rollbacks chan service.WallpaperChange
+}
+
+func (f *fakeStore) GetUserByID(ctx context.Context, id string) (*repository.User, error) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) GetUserByUsername(ctx context.Context, username string) (*repository.User, error) {
+	for _, user := range f.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) GetPublisherDeviceByDeviceID(ctx context.Context, deviceID string) (*repository.PublisherDevice, error) {
+	for _, device := range f.devices {
+		if device.DeviceID == deviceID {
+			return device, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) GetPublishedWallpaperByDeviceIDAndHash(ctx context.Context, deviceID, hash string) (*repository.PublishedWallpaper, error) {
+	for _, wallpaper := range f.wallpapers {
+		if wallpaper.DeviceID == deviceID && wallpaper.Hash == hash {
+			return wallpaper, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) AuthenticateDeviceToken(ctx context.Context, value string) (*repository.DeviceToken, error) {
+	token, ok := f.tokens[value]
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid device token", service.ErrUnauthorized)
+	}
+	return token, nil
+}
+
+func (f *fakeStore) RollbackWithDeviceToken(ctx context.Context, token *repository.DeviceToken, hash string) (*repository.PublishedWallpaper, error) {
+	wallpaper, _ := f.GetPublishedWallpaperByDeviceIDAndHash(ctx, token.DeviceID, hash)
+	if wallpaper == nil {
+		return nil, service.ErrNotFound
+	}
+	change := service.WallpaperChange{DeviceID: token.DeviceID, Hash: hash, ChangedAt: time.Now().Unix()}
+	f.rollbacks <- change
+	f.bridge.HandleEvent(ctx, service.EventWallpaperChanged, []string{token.UserID}, change)
+	return wallpaper, nil
+}
+
+// startBroker runs an in-process broker that lets every client in and
+// returns its address
+func startBroker(t *testing.T) (*broker.Server, string) {
+	server := broker.New(&broker.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server, "tcp://" + tcp.Address()
+}
+
+func connect(t *testing.T, brokerURL, clientID string) mqtt.Client {
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(brokerURL).SetClientID(clientID))
+	if token := client.Connect(); !token.WaitTimeout(testTimeout) || token.Error() != nil {
+		t.Fatalf("connecting %s: %v", clientID, token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(100) })
+	return client
+}
+
+// nextCurrent subscribes a new client to topic and returns the first message
+func nextCurrent(t *testing.T, brokerURL, clientID, topic string, want func(CurrentMessage) bool) (CurrentMessage, bool) {
+	t.Helper()
+	type received struct {
+		message  CurrentMessage
+		retained bool
+	}
+	messages := make(chan received, 10)
+	client := connect(t, brokerURL, clientID)
+	token := client.Subscribe(topic, 1, func(client mqtt.Client, msg mqtt.Message) {
+		var message CurrentMessage
+		if err := json.Unmarshal(msg.Payload(), &message); err != nil {
+			t.Errorf("invalid message on %s: %v", topic, err)
+			return
+		}
+		messages <- received{message, msg.Retained()}
+	})
+	if !token.WaitTimeout(testTimeout) || token.Error() != nil {
+		t.Fatalf("subscribing to %s: %v", topic, token.Error())
+	}
+
+	deadline := time.After(testTimeout)
+	for {
+		select {
+		case got := <-messages:
+			if want(got.message) {
+				return got.message, got.retained
+			}
+		case <-deadline:
+			t.Fatalf("no matching message on %s", topic)
+		}
+	}
+}
+
+func TestBridgeWithBroker(t *testing.T) {
+	server, brokerURL := startBroker(t)
+
+	metadata := repository.WallpaperMetadata{Title: "Fjord"}
+	store := &fakeStore{
+		users: []*repository.User{
+			{ID: "user-1", Username: "alice"},
+			{ID: "user-2", Username: "bob"},
+		},
+		devices: []*repository.PublisherDevice{
+			{UserID: "user-1", DeviceID: "living-room"},
+			{UserID: "user-1", DeviceID: "bedroom", Public: true},
+		},
+		wallpapers: []*repository.PublishedWallpaper{
+			{UserID: "user-1", DeviceID: "living-room", Hash: "aaa", WallpaperMetadata: metadata},
+			{UserID: "user-1", DeviceID: "living-room", Hash: "bbb"},
+			{UserID: "user-1", DeviceID: "living-room", Hash: "ccc"},
+		},
+		tokens: map[string]*repository.DeviceToken{
+			"wst_living":  {ID: "token-1", UserID: "user-1", DeviceID: "living-room"},
+			"wst_bedroom": {ID: "token-2", UserID: "user-1", DeviceID: "bedroom"},
+		},
+		rollbacks: make(chan service.WallpaperChange, 10),
+	}
+	bridge := newBridge(Config{
+		Broker:    brokerURL,
+		ClientID:  "wallstream-test",
+		PublicURL: "https://wall.example.com/",
+		Commands:  true,
+	}, store, store, store, store)
+	store.bridge = bridge
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bridge.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// A published wallpaper is retained for clients that subscribe later
+	currentTopic := "wallstream/alice/living-room/current"
+	bridge.HandleEvent(ctx, service.EventWallpaperChanged, []string{"user-1"}, service.WallpaperChange{DeviceID: "living-room", Hash: "aaa", ChangedAt: 100})
+	isHash := func(hash string) func(CurrentMessage) bool {
+		return func(message CurrentMessage) bool { return message.Hash == hash }
+	}
+	nextCurrent(t, brokerURL, "watcher-1", currentTopic, isHash("aaa"))
+	message, retained := nextCurrent(t, brokerURL, "watcher-2", currentTopic, isHash("aaa"))
+	if !retained {
+		t.Error("current message was not retained")
+	}
+	want := CurrentMessage{
+		User:         "alice",
+		DeviceID:     "living-room",
+		Hash:         "aaa",
+		ChangedAt:    100,
+		ThumbnailURL: "https://wall.example.com/api/wallpaper/living-room/thumbnail",
+		Metadata:     metadata,
+	}
+	if message.User != want.User || message.DeviceID != want.DeviceID || message.ChangedAt != want.ChangedAt ||
+		message.ThumbnailURL != want.ThumbnailURL || message.Metadata.Title != want.Metadata.Title {
+		t.Errorf("current message = %+v, want %+v", message, want)
+	}
+
+	// Wait for the bridge's command subscription before sending commands
+	setTopic := "wallstream/alice/living-room/set"
+	deadline := time.Now().Add(testTimeout)
+	for len(server.Topics.Subscribers(setTopic).Subscriptions) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("bridge did not subscribe to commands")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	commander := connect(t, brokerURL, "commander")
+	send := func(topic, payload string) {
+		if token := commander.Publish(topic, 1, false, payload); !token.WaitTimeout(testTimeout) || token.Error() != nil {
+			t.Fatalf("publishing to %s: %v", topic, token.Error())
+		}
+	}
+
+	// Commands without a token of the topic's device are ignored
+	send(setTopic, "ccc")
+	send(setTopic, `{"hash": "ccc"}`)
+	send(setTopic, `{"hash": "ccc", "token": "wst_unknown"}`)
+	send(setTopic, `{"hash": "ccc", "token": "wst_bedroom"}`)
+	send("wallstream/bob/living-room/set", `{"hash": "ccc", "token": "wst_living"}`)
+
+	// A command with the device's token rolls it back
+	send(setTopic, `{"hash": "bbb", "token": "wst_living"}`)
+	select {
+	case rollback := <-store.rollbacks:
+		if rollback.DeviceID != "living-room" || rollback.Hash != "bbb" {
+			t.Fatalf("rolled back %s to %s, want living-room to bbb", rollback.DeviceID, rollback.Hash)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("command was not applied")
+	}
+	select {
+	case rollback := <-store.rollbacks:
+		t.Fatalf("unauthorized command rolled back %s to %s", rollback.DeviceID, rollback.Hash)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	message, retained = nextCurrent(t, brokerURL, "watcher-3", currentTopic, isHash("bbb"))
+	if !retained || message.User != "alice" {
+		t.Errorf("after rollback got %+v (retained %v), want alice's bbb retained", message, retained)
+	}
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEventRepository only inserts and reads; audit events are never changed
+// or removed through it
+type AuditEventRepository struct {
+	col *mongo.Collection
+}
+
+func NewAuditEventRepository(col *mongo.Collection) *AuditEventRepository {
+	return &AuditEventRepository{col: col}
+}
+
+func (r *AuditEventRepository) CreateEvent(ctx context.Context, event *AuditEvent) error {
+	_, err := r.col.InsertOne(ctx, event)
+	return err
+}
+
+// AuditEventFilter narrows a user's audit log. Zero values match everything.
+type AuditEventFilter struct {
+	Action string
+	Since  int64
+	Until  int64
+}
+
+// GetEventsByUserID returns a page of a user's audit events, newest first,
+// along with the total count
+func (r *AuditEventRepository) GetEventsByUserID(ctx context.Context, userID string, filter AuditEventFilter, offset, limit int64) ([]*AuditEvent, int64, error) {
+	query := bson.M{"user_id": userID}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	createdAt := bson.M{}
+	if filter.Since > 0 {
+		createdAt["$gte"] = filter.Since
+	}
+	if filter.Until > 0 {
+		createdAt["$lt"] = filter.Until
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	total, err := r.col.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.col.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DeviceCertificateRepository struct {
+	col *mongo.Collection
+}
+
+func NewDeviceCertificateRepository(col *mongo.Collection) *DeviceCertificateRepository {
+	return &DeviceCertificateRepository{col: col}
+}
+
+func (r *DeviceCertificateRepository) CreateCertificate(ctx context.Context, certificate *DeviceCertificate) error {
+	_, err := r.col.InsertOne(ctx, certificate)
+	return err
+}
+
+func (r *DeviceCertificateRepository) GetCertificateByFingerprint(ctx context.Context, fingerprint string) (*DeviceCertificate, error) {
+	var certificate DeviceCertificate
+	err := r.col.FindOne(ctx, bson.M{"fingerprint": fingerprint}).Decode(&certificate)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (r *DeviceCertificateRepository) GetCertificatesByDeviceID(ctx context.Context, deviceID string) ([]*DeviceCertificate, error) {
+	certificates := []*DeviceCertificate{}
+	cursor, err := r.col.Find(ctx, bson.M{"device_id": deviceID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &certificates); err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+func (r *DeviceCertificateRepository) CountCertificatesByDeviceID(ctx context.Context, deviceID string) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"device_id": deviceID})
+}
+
+func (r *DeviceCertificateRepository) UpdateLastUsedAt(ctx context.Context, id string, lastUsedAt int64) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"last_used_at": lastUsedAt}})
+	return err
+}
+
+// DeleteCertificate revokes a device's certificate and reports whether it
+// existed
+func (r *DeviceCertificateRepository) DeleteCertificate(ctx context.Context, deviceID, id string) (bool, error) {
+	result, err := r.col.DeleteOne(ctx, bson.M{"id": id, "device_id": deviceID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (r *DeviceCertificateRepository) DeleteCertificatesByDeviceID(ctx context.Context, deviceID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"device_id": deviceID})
+	return err
+}
+
+func (r *DeviceCertificateRepository) DeleteCertificatesByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
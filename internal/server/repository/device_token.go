@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DeviceTokenRepository struct {
+	col *mongo.Collection
+}
+
+func NewDeviceTokenRepository(col *mongo.Collection) *DeviceTokenRepository {
+	return &DeviceTokenRepository{col: col}
+}
+
+func (r *DeviceTokenRepository) CreateToken(ctx context.Context, token *DeviceToken) error {
+	_, err := r.col.InsertOne(ctx, token)
+	return err
+}
+
+func (r *DeviceTokenRepository) GetTokenByHash(ctx context.Context, tokenHash string) (*DeviceToken, error) {
+	var token DeviceToken
+	err := r.col.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *DeviceTokenRepository) GetTokensByDeviceID(ctx context.Context, deviceID string) ([]*DeviceToken, error) {
+	tokens := []*DeviceToken{}
+	cursor, err := r.col.Find(ctx, bson.M{"device_id": deviceID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *DeviceTokenRepository) CountTokensByDeviceID(ctx context.Context, deviceID string) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"device_id": deviceID})
+}
+
+func (r *DeviceTokenRepository) UpdateLastUsedAt(ctx context.Context, id string, lastUsedAt int64) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"last_used_at": lastUsedAt}})
+	return err
+}
+
+// DeleteToken revokes a device's token and reports whether it existed
+func (r *DeviceTokenRepository) DeleteToken(ctx context.Context, deviceID, id string) (bool, error) {
+	result, err := r.col.DeleteOne(ctx, bson.M{"id": id, "device_id": deviceID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (r *DeviceTokenRepository) DeleteTokensByDeviceID(ctx context.Context, deviceID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"device_id": deviceID})
+	return err
+}
+
+func (r *DeviceTokenRepository) DeleteTokensByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -1,27 +1,312 @@
 package repository
 
 type User struct {
-	ID        string `json:"id" bson:"id"`
-	Username  string `json:"username" bson:"username"`
-	APIKey    string `json:"api_key,omitempty" bson:"api_key"`
-	CreatedAt int64  `json:"created_at" bson:"created_at"`
-	UpdatedAt int64  `json:"updated_at" bson:"updated_at"`
+	ID       string `json:"id" bson:"id"`
+	Username string `json:"username" bson:"username"`
+	APIKey   string `json:"api_key,omitempty" bson:"api_key"`
+	// Role is one of the Role constants; users created before roles existed
+	// have none and are treated as RoleUser
+	Role string `json:"role" bson:"role,omitempty"`
+	// System accounts are created by the server itself, such as the owner of
+	// the official streams, and can't be registered
+	System bool `json:"system,omitempty" bson:"system,omitempty"`
+	// Disabled users can't authenticate with their API key or device tokens
+	Disabled   bool  `json:"disabled" bson:"disabled,omitempty"`
+	DisabledAt int64 `json:"disabled_at,omitempty" bson:"disabled_at,omitempty"`
+	// DeletionRequestedAt is set once the account is queued for deletion. The
+	// account is locked from then on and removed by the deletion job, which
+	// holds DeletionLeaseUntil while it works on it.
+	DeletionRequestedAt int64 `json:"deletion_requested_at,omitempty" bson:"deletion_requested_at,omitempty"`
+	DeletionLeaseUntil  int64 `json:"-" bson:"deletion_lease_until,omitempty"`
+	CreatedAt           int64 `json:"created_at" bson:"created_at"`
+	UpdatedAt           int64 `json:"updated_at" bson:"updated_at"`
+}
+
+// Roles, from least to most privileged. Moderators can look at any account;
+// admins can also change them.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Locked reports whether the account may no longer authenticate, because it
+// was disabled or is being deleted
+func (u *User) Locked() bool {
+	return u.Disabled || u.DeletionRequestedAt > 0
+}
+
+// RoleOrDefault returns the user's role, RoleUser if none was ever set
+func (u *User) RoleOrDefault() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
 }
 
 type PublishedWallpaper struct {
+	ID       string `json:"id" bson:"id"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	DeviceID string `json:"device_id" bson:"device_id"`
+	Hash     string `json:"hash" bson:"hash"`
+	URL      string `json:"url" bson:"url"`
+	// Monitors is set for multi-monitor wallpaper sets. URL then points at the
+	// primary monitor's image so single-image clients keep working, and Hash
+	// covers the whole set.
+	Monitors []MonitorImage `json:"monitors,omitempty" bson:"monitors,omitempty"`
+	// Variants are alternatives to URL for subscribers to pick between by
+	// time of day or desktop color scheme
+	Variants  []WallpaperVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+	Palette   []string           `json:"palette,omitempty" bson:"palette,omitempty"`
+	Luminance float64            `json:"luminance" bson:"luminance"`
+	Pinned    bool               `json:"pinned" bson:"pinned"`
+
+	WallpaperMetadata `bson:",inline"`
+
+	// Scheduled wallpapers wait in ScheduleStatusPending until PublishAt. Ones
+	// that expire go live with the hash they replaced in RevertHash, so the
+	// device can go back to it at ExpiresAt.
+	PublishSchedule `bson:",inline"`
+	ScheduleStatus  string `json:"schedule_status,omitempty" bson:"schedule_status,omitempty"`
+	RevertHash      string `json:"revert_hash,omitempty" bson:"revert_hash,omitempty"`
+
+	CreatedAt int64 `json:"created_at" bson:"created_at"`
+	UpdatedAt int64 `json:"updated_at" bson:"updated_at"`
+}
+
+// PublishSchedule delays a wallpaper until PublishAt and, if ExpiresAt is set,
+// replaces it with the previous wallpaper again at ExpiresAt. Both are unix
+// timestamps; zero means now and never.
+type PublishSchedule struct {
+	PublishAt int64 `json:"publish_at,omitempty" bson:"publish_at,omitempty"`
+	ExpiresAt int64 `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+const (
+	ScheduleStatusPending = "pending"
+	ScheduleStatusLive    = "live"
+	ScheduleStatusExpired = "expired"
+)
+
+// WallpaperMetadata is optional descriptive information about a wallpaper
+type WallpaperMetadata struct {
+	Title       string   `json:"title,omitempty" bson:"title,omitempty"`
+	Description string   `json:"description,omitempty" bson:"description,omitempty"`
+	SourceURL   string   `json:"source_url,omitempty" bson:"source_url,omitempty"`
+	Author      string   `json:"author,omitempty" bson:"author,omitempty"`
+	License     string   `json:"license,omitempty" bson:"license,omitempty"`
+	Tags        []string `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+// Files returns the stored files the wallpaper references
+func (w *PublishedWallpaper) Files() []string {
+	files := []string{w.URL}
+	for _, monitor := range w.Monitors {
+		if monitor.URL != w.URL {
+			files = append(files, monitor.URL)
+		}
+	}
+	for _, variant := range w.Variants {
+		if variant.URL != w.URL {
+			files = append(files, variant.URL)
+		}
+	}
+	return files
+}
+
+// MonitorImage is one image of a multi-monitor wallpaper set, along with the
+// geometry of the publisher's monitor it was shown on
+type MonitorImage struct {
+	Index  int    `json:"index" bson:"index"`
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+	X      int    `json:"x" bson:"x"`
+	Y      int    `json:"y" bson:"y"`
+	Hash   string `json:"hash" bson:"hash"`
+	URL    string `json:"url" bson:"url"`
+}
+
+// WallpaperVariant is an alternative image of a wallpaper. Day, night, light
+// and dark variants are picked by the subscriber's sun position or color
+// scheme. A time variant is shown from Start (HH:MM local time) until the next
+// time variant starts, like a dynamic wallpaper.
+type WallpaperVariant struct {
+	Kind  string `json:"kind" bson:"kind"`
+	Start string `json:"start,omitempty" bson:"start,omitempty"`
+	Hash  string `json:"hash" bson:"hash"`
+	URL   string `json:"url" bson:"url"`
+}
+
+const (
+	VariantDay   = "day"
+	VariantNight = "night"
+	VariantLight = "light"
+	VariantDark  = "dark"
+	VariantTime  = "time"
+)
+
+type PublisherDevice struct {
+	ID       string `json:"id" bson:"id"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	DeviceID string `json:"device_id" bson:"device_id"`
+	// CurrentHash points at the published wallpaper subscribers are served
+	CurrentHash      string           `json:"current_hash,omitempty" bson:"current_hash,omitempty"`
+	CurrentChangedAt int64            `json:"current_changed_at,omitempty" bson:"current_changed_at,omitempty"`
+	Retention        *RetentionPolicy `json:"retention,omitempty" bson:"retention,omitempty"`
+	// Public devices are listed in the stream catalog under Name and can be
+	// subscribed to by anyone
+	Public      bool     `json:"public" bson:"public"`
+	Name        string   `json:"name,omitempty" bson:"name,omitempty"`
+	Description string   `json:"description,omitempty" bson:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	CreatedAt   int64    `json:"created_at" bson:"created_at"`
+	UpdatedAt   int64    `json:"updated_at" bson:"updated_at"`
+}
+
+// RetentionPolicy limits how much history a device keeps. A wallpaper survives
+// if any rule keeps it; zero values disable a rule. The current wallpaper,
+// those in an enabled playlist, scheduled ones that haven't gone live and the
+// ones expiring wallpapers revert to are never pruned.
+type RetentionPolicy struct {
+	KeepLast   int  `json:"keep_last" bson:"keep_last"`
+	KeepDays   int  `json:"keep_days" bson:"keep_days"`
+	KeepPinned bool `json:"keep_pinned" bson:"keep_pinned"`
+}
+
+// UploadSession tracks a resumable upload. Filename is set once the upload is
+// complete and verified.
+type UploadSession struct {
+	ID        string            `json:"id" bson:"id"`
+	UserID    string            `json:"user_id" bson:"user_id"`
+	Length    int64             `json:"length" bson:"length"`
+	Offset    int64             `json:"offset" bson:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	Filename  string            `json:"filename,omitempty" bson:"filename,omitempty"`
+	CreatedAt int64             `json:"created_at" bson:"created_at"`
+	UpdatedAt int64             `json:"updated_at" bson:"updated_at"`
+}
+
+// Subscription records that a user follows a publisher device's stream
+type Subscription struct {
 	ID        string `json:"id" bson:"id"`
 	UserID    string `json:"user_id" bson:"user_id"`
 	DeviceID  string `json:"device_id" bson:"device_id"`
-	Hash      string `json:"hash" bson:"hash"`
-	URL       string `json:"url" bson:"url"`
+	CreatedAt int64  `json:"created_at" bson:"created_at"`
+}
+
+// Playlist rotates a device's current wallpaper through a list of its
+// published wallpapers, either every Interval seconds or on a Cron schedule
+type Playlist struct {
+	ID       string   `json:"id" bson:"id"`
+	UserID   string   `json:"user_id" bson:"user_id"`
+	DeviceID string   `json:"device_id" bson:"device_id"`
+	Name     string   `json:"name" bson:"name"`
+	Hashes   []string `json:"hashes" bson:"hashes"`
+	Shuffle  bool     `json:"shuffle" bson:"shuffle"`
+	Interval int64    `json:"interval_seconds,omitempty" bson:"interval_seconds,omitempty"`
+	Cron     string   `json:"cron,omitempty" bson:"cron,omitempty"`
+	Enabled  bool     `json:"enabled" bson:"enabled"`
+	// Order is the current pass through Hashes, reshuffled after every pass
+	// when Shuffle is set, and Position the index in it shown last
+	Order     []string `json:"order" bson:"order"`
+	Position  int      `json:"position" bson:"position"`
+	NextRunAt int64    `json:"next_run_at,omitempty" bson:"next_run_at"`
+	LastRunAt int64    `json:"last_run_at,omitempty" bson:"last_run_at,omitempty"`
+	CreatedAt int64    `json:"created_at" bson:"created_at"`
+	UpdatedAt int64    `json:"updated_at" bson:"updated_at"`
+}
+
+// AuditEvent records a security-relevant action in the log of the user it
+// concerns. Events are only ever inserted.
+type AuditEvent struct {
+	ID     string `json:"id" bson:"id"`
+	UserID string `json:"user_id" bson:"user_id"`
+	// The actor is empty for actions taken by the server itself, such as
+	// imports
+	ActorID       string `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	ActorUsername string `json:"actor_username,omitempty" bson:"actor_username,omitempty"`
+	// KeyID identifies the API key or device token the actor used
+	KeyID     string            `json:"key_id,omitempty" bson:"key_id,omitempty"`
+	Action    string            `json:"action" bson:"action"`
+	Target    string            `json:"target,omitempty" bson:"target,omitempty"`
+	Details   map[string]string `json:"details,omitempty" bson:"details,omitempty"`
+	IP        string            `json:"ip,omitempty" bson:"ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	CreatedAt int64             `json:"created_at" bson:"created_at"`
+}
+
+// DeviceToken lets automation publish to one device without the user's API
+// key. Only a hash of the token is stored.
+type DeviceToken struct {
+	ID       string `json:"id" bson:"id"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	DeviceID string `json:"device_id" bson:"device_id"`
+	Name     string `json:"name,omitempty" bson:"name,omitempty"`
+	// Token is only set in the response that creates it
+	Token     string `json:"token,omitempty" bson:"-"`
+	TokenHash string `json:"-" bson:"token_hash"`
+	// Prefix is the start of the token, to tell tokens apart
+	Prefix     string `json:"prefix" bson:"prefix"`
+	LastUsedAt int64  `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	CreatedAt  int64  `json:"created_at" bson:"created_at"`
+}
+
+// DeviceCertificate is a client certificate issued to a device for mutual
+// TLS. A certificate only authenticates while its record exists, so deleting
+// the record revokes it.
+type DeviceCertificate struct {
+	ID       string `json:"id" bson:"id"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	DeviceID string `json:"device_id" bson:"device_id"`
+	Name     string `json:"name,omitempty" bson:"name,omitempty"`
+	Serial   string `json:"serial" bson:"serial"`
+	// Fingerprint is the SHA-256 of the certificate, which is what requests
+	// are matched by
+	Fingerprint string `json:"fingerprint" bson:"fingerprint"`
+	NotAfter    int64  `json:"not_after" bson:"not_after"`
+	// Certificate and CACertificate are PEM, only set in the response that
+	// issues the certificate
+	Certificate   string `json:"certificate,omitempty" bson:"-"`
+	CACertificate string `json:"ca_certificate,omitempty" bson:"-"`
+	LastUsedAt    int64  `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	CreatedAt     int64  `json:"created_at" bson:"created_at"`
+}
+
+// Webhook receives a signed POST for every event in Events that concerns its
+// user
+type Webhook struct {
+	ID     string   `json:"id" bson:"id"`
+	UserID string   `json:"user_id" bson:"user_id"`
+	URL    string   `json:"url" bson:"url"`
+	Events []string `json:"events" bson:"events"`
+	// Secret signs the payloads. It's only shown when the webhook is created.
+	Secret    string `json:"secret,omitempty" bson:"secret"`
+	Enabled   bool   `json:"enabled" bson:"enabled"`
 	CreatedAt int64  `json:"created_at" bson:"created_at"`
 	UpdatedAt int64  `json:"updated_at" bson:"updated_at"`
 }
 
-type PublisherDevice struct {
+// WebhookDelivery is one event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
 	ID        string `json:"id" bson:"id"`
+	WebhookID string `json:"webhook_id" bson:"webhook_id"`
 	UserID    string `json:"user_id" bson:"user_id"`
-	DeviceID  string `json:"device_id" bson:"device_id"`
-	CreatedAt int64  `json:"created_at" bson:"created_at"`
-	UpdatedAt int64  `json:"updated_at" bson:"updated_at"`
+	Event     string `json:"event" bson:"event"`
+	Payload   string `json:"payload" bson:"payload"`
+	// RedeliveryOf is set on manual redeliveries of an earlier delivery
+	RedeliveryOf   string `json:"redelivery_of,omitempty" bson:"redelivery_of,omitempty"`
+	Status         string `json:"status" bson:"status"`
+	Attempts       int    `json:"attempts" bson:"attempts"`
+	NextAttemptAt  int64  `json:"next_attempt_at,omitempty" bson:"next_attempt_at"`
+	LastAttemptAt  int64  `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+	ResponseStatus int    `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	Error          string `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt      int64  `json:"created_at" bson:"created_at"`
+	UpdatedAt      int64  `json:"updated_at" bson:"updated_at"`
 }
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
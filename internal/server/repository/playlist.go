@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PlaylistRepository struct {
+	col *mongo.Collection
+}
+
+func NewPlaylistRepository(col *mongo.Collection) *PlaylistRepository {
+	return &PlaylistRepository{col: col}
+}
+
+func (r *PlaylistRepository) CreatePlaylist(ctx context.Context, playlist *Playlist) error {
+	_, err := r.col.InsertOne(ctx, playlist)
+	return err
+}
+
+func (r *PlaylistRepository) GetPlaylistByID(ctx context.Context, id string) (*Playlist, error) {
+	var playlist Playlist
+	err := r.col.FindOne(ctx, bson.M{"id": id}).Decode(&playlist)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+func (r *PlaylistRepository) GetPlaylistsByDeviceID(ctx context.Context, deviceID string) ([]*Playlist, error) {
+	playlists := []*Playlist{}
+	cursor, err := r.col.Find(ctx, bson.M{"device_id": deviceID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
+	return playlists, nil
+}
+
+// GetDuePlaylists returns the enabled playlists whose next run is at or
+// before now
+func (r *PlaylistRepository) GetDuePlaylists(ctx context.Context, now int64) ([]*Playlist, error) {
+	playlists := []*Playlist{}
+	cursor, err := r.col.Find(ctx, bson.M{"enabled": true, "next_run_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &playlists); err != nil {
+		return nil, err
+	}
+	return playlists, nil
+}
+
+func (r *PlaylistRepository) ReplacePlaylist(ctx context.Context, playlist *Playlist) error {
+	_, err := r.col.ReplaceOne(ctx, bson.M{"id": playlist.ID}, playlist)
+	return err
+}
+
+// AdvancePlaylist records a step of the rotation. It only applies if the
+// playlist's next run is still expectedNextRunAt, so when several servers run
+// the scheduler only one of them advances a given step. It reports whether
+// the update applied.
+func (r *PlaylistRepository) AdvancePlaylist(ctx context.Context, id string, expectedNextRunAt int64, order []string, position int, lastRunAt, nextRunAt int64) (bool, error) {
+	result, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": id, "next_run_at": expectedNextRunAt},
+		bson.M{"$set": bson.M{
+			"order":       order,
+			"position":    position,
+			"last_run_at": lastRunAt,
+			"next_run_at": nextRunAt,
+			"updated_at":  lastRunAt,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// PostponePlaylist moves the playlist's next run without advancing it, under
+// the same claim as AdvancePlaylist
+func (r *PlaylistRepository) PostponePlaylist(ctx context.Context, id string, expectedNextRunAt, nextRunAt, updatedAt int64) (bool, error) {
+	result, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": id, "next_run_at": expectedNextRunAt},
+		bson.M{"$set": bson.M{"next_run_at": nextRunAt, "updated_at": updatedAt}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// DisablePlaylist turns the playlist off, under the same claim as
+// AdvancePlaylist
+func (r *PlaylistRepository) DisablePlaylist(ctx context.Context, id string, expectedNextRunAt, updatedAt int64) (bool, error) {
+	result, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": id, "next_run_at": expectedNextRunAt},
+		bson.M{"$set": bson.M{"enabled": false, "updated_at": updatedAt}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// DisableOtherPlaylists turns off every playlist on the device except keepID,
+// since two enabled playlists would fight over the current wallpaper
+func (r *PlaylistRepository) DisableOtherPlaylists(ctx context.Context, deviceID, keepID string, updatedAt int64) error {
+	_, err := r.col.UpdateMany(
+		ctx,
+		bson.M{"device_id": deviceID, "id": bson.M{"$ne": keepID}, "enabled": true},
+		bson.M{"$set": bson.M{"enabled": false, "updated_at": updatedAt}},
+	)
+	return err
+}
+
+// GetEnabledPlaylistHashes returns every hash an enabled playlist on the
+// device rotates through
+func (r *PlaylistRepository) GetEnabledPlaylistHashes(ctx context.Context, deviceID string) (map[string]bool, error) {
+	values, err := r.col.Distinct(ctx, "hashes", bson.M{"device_id": deviceID, "enabled": true})
+	if err != nil {
+		return nil, err
+	}
+	hashes := map[string]bool{}
+	for _, hash := range distinctStrings(values) {
+		hashes[hash] = true
+	}
+	return hashes, nil
+}
+
+func (r *PlaylistRepository) DeletePlaylistByID(ctx context.Context, id string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *PlaylistRepository) DeletePlaylistsByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -2,9 +2,11 @@ package repository
 
 import (
 	"context"
+	"path/filepath"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PublishedWallpaperRepository struct {
@@ -56,6 +58,58 @@ func (r *PublishedWallpaperRepository) GetPublishedWallpapersByDeviceID(ctx cont
 	return publishedWallpapers, err
 }
 
+// GetPublishedWallpaperHistory returns a page of a device's wallpapers, newest
+// first, along with the total number of wallpapers on the device
+func (r *PublishedWallpaperRepository) GetPublishedWallpaperHistory(ctx context.Context, deviceID string, offset, limit int64) ([]*PublishedWallpaper, int64, error) {
+	filter := bson.M{"device_id": deviceID}
+	total, err := r.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	publishedWallpapers := []*PublishedWallpaper{}
+	if err := cursor.All(ctx, &publishedWallpapers); err != nil {
+		return nil, 0, err
+	}
+	return publishedWallpapers, total, nil
+}
+
+func (r *PublishedWallpaperRepository) GetLatestPublishedWallpaperByDeviceID(ctx context.Context, deviceID string) (*PublishedWallpaper, error) {
+	var publishedWallpaper PublishedWallpaper
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "id", Value: -1}})
+	filter := bson.M{"device_id": deviceID, "schedule_status": bson.M{"$ne": ScheduleStatusPending}}
+	err := r.col.FindOne(ctx, filter, opts).Decode(&publishedWallpaper)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &publishedWallpaper, nil
+}
+
+func (r *PublishedWallpaperRepository) GetPublishedWallpaperByDeviceIDAndHash(ctx context.Context, deviceID, hash string) (*PublishedWallpaper, error) {
+	var publishedWallpaper PublishedWallpaper
+	err := r.col.FindOne(ctx, bson.M{"device_id": deviceID, "hash": hash}).Decode(&publishedWallpaper)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &publishedWallpaper, nil
+}
+
 func (r *PublishedWallpaperRepository) GetPublishedWallpaperByHash(ctx context.Context, hash string) (*PublishedWallpaper, error) {
 	var publishedWallpaper PublishedWallpaper
 	err := r.col.FindOne(ctx, bson.M{"hash": hash}).Decode(&publishedWallpaper)
@@ -68,12 +122,186 @@ func (r *PublishedWallpaperRepository) GetPublishedWallpaperByHash(ctx context.C
 	return &publishedWallpaper, nil
 }
 
-func (r *PublishedWallpaperRepository) DeletePublishedWallpaperByHash(ctx context.Context, hash string) error {
-	_, err := r.col.DeleteOne(ctx, bson.M{"hash": hash})
+func (r *PublishedWallpaperRepository) DeletePublishedWallpaperByID(ctx context.Context, id string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"id": id})
 	return err
 }
 
+func (r *PublishedWallpaperRepository) UpdatePinned(ctx context.Context, deviceID, hash string, pinned bool, updatedAt int64) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"device_id": deviceID, "hash": hash},
+		bson.M{"$set": bson.M{"pinned": pinned, "updated_at": updatedAt}},
+	)
+	return err
+}
+
+// GetPublishedWallpaperByUserIDAndHash returns one of the user's wallpapers
+// with the given hash, or nil if there is none
+func (r *PublishedWallpaperRepository) GetPublishedWallpaperByUserIDAndHash(ctx context.Context, userID, hash string) (*PublishedWallpaper, error) {
+	var publishedWallpaper PublishedWallpaper
+	err := r.col.FindOne(ctx, bson.M{"user_id": userID, "hash": hash}).Decode(&publishedWallpaper)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &publishedWallpaper, nil
+}
+
+// UpdateMetadata replaces the metadata of every wallpaper the user published
+// with the given hash, since the same image published to several devices is
+// still one wallpaper to its owner
+func (r *PublishedWallpaperRepository) UpdateMetadata(ctx context.Context, userID, hash string, metadata WallpaperMetadata, updatedAt int64) error {
+	set := bson.M{"updated_at": updatedAt}
+	unset := bson.M{}
+	fields := map[string]string{
+		"title":       metadata.Title,
+		"description": metadata.Description,
+		"source_url":  metadata.SourceURL,
+		"author":      metadata.Author,
+		"license":     metadata.License,
+	}
+	for field, value := range fields {
+		if value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+	if len(metadata.Tags) == 0 {
+		unset["tags"] = ""
+	} else {
+		set["tags"] = metadata.Tags
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	_, err := r.col.UpdateMany(ctx, bson.M{"user_id": userID, "hash": hash}, update)
+	return err
+}
+
+// SearchDeviceIDsByMetadata returns the devices with a published wallpaper
+// whose title, description, author or tags match pattern, a case-insensitive
+// regular expression
+func (r *PublishedWallpaperRepository) SearchDeviceIDsByMetadata(ctx context.Context, pattern string) ([]string, error) {
+	regex := bson.M{"$regex": pattern, "$options": "i"}
+	// Wallpapers that haven't gone live yet stay under wraps
+	values, err := r.col.Distinct(ctx, "device_id", bson.M{"schedule_status": bson.M{"$ne": ScheduleStatusPending}, "$or": bson.A{
+		bson.M{"title": regex},
+		bson.M{"description": regex},
+		bson.M{"author": regex},
+		bson.M{"tags": regex},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return distinctStrings(values), nil
+}
+
+// GetDueScheduledWallpapers returns the pending wallpapers whose PublishAt
+// and the live ones whose ExpiresAt is at or before now
+func (r *PublishedWallpaperRepository) GetDueScheduledWallpapers(ctx context.Context, now int64) ([]*PublishedWallpaper, error) {
+	publishedWallpapers := []*PublishedWallpaper{}
+	cursor, err := r.col.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"schedule_status": ScheduleStatusPending, "publish_at": bson.M{"$lte": now}},
+		bson.M{"schedule_status": ScheduleStatusLive, "expires_at": bson.M{"$lte": now}},
+	}}, options.Find().SetSort(bson.D{{Key: "publish_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &publishedWallpapers); err != nil {
+		return nil, err
+	}
+	return publishedWallpapers, nil
+}
+
+// UpdateScheduleStatus moves a scheduled wallpaper from one status to the
+// next. It only applies if the status is still from, so when several servers
+// run the scheduler only one of them makes a given transition. An empty status
+// clears it. It reports whether the update applied.
+func (r *PublishedWallpaperRepository) UpdateScheduleStatus(ctx context.Context, id, from, to, revertHash string, updatedAt int64) (bool, error) {
+	set := bson.M{"updated_at": updatedAt}
+	unset := bson.M{}
+	if to == "" {
+		unset["schedule_status"] = ""
+	} else {
+		set["schedule_status"] = to
+	}
+	if revertHash == "" {
+		unset["revert_hash"] = ""
+	} else {
+		set["revert_hash"] = revertHash
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	result, err := r.col.UpdateOne(ctx, bson.M{"id": id, "schedule_status": from}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// CountPublishedWallpapersByURL counts wallpapers referencing a stored file,
+// either directly or as one of their monitor images or variants
+func (r *PublishedWallpaperRepository) CountPublishedWallpapersByURL(ctx context.Context, url string) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"url": url},
+		bson.M{"monitors.url": url},
+		bson.M{"variants.url": url},
+	}})
+}
+
 func (r *PublishedWallpaperRepository) DeletePublishedWallpaperByDeviceID(ctx context.Context, deviceID string) error {
 	_, err := r.col.DeleteOne(ctx, bson.M{"device_id": deviceID})
 	return err
 }
+
+func (r *PublishedWallpaperRepository) DeletePublishedWallpapersByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// GetReferencedFilenames returns the base names of every stored file a
+// published wallpaper points at
+func (r *PublishedWallpaperRepository) GetReferencedFilenames(ctx context.Context) (map[string]struct{}, error) {
+	urls, err := r.col.Distinct(ctx, "url", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	monitorURLs, err := r.col.Distinct(ctx, "monitors.url", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	variantURLs, err := r.col.Distinct(ctx, "variants.url", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	urls = append(urls, monitorURLs...)
+	urls = append(urls, variantURLs...)
+	filenames := make(map[string]struct{}, len(urls))
+	for _, url := range urls {
+		if s, ok := url.(string); ok && s != "" {
+			filenames[filepath.Base(s)] = struct{}{}
+		}
+	}
+	return filenames, nil
+}
+
+// distinctStrings keeps the non-empty strings out of a Distinct result
+func distinctStrings(values []interface{}) []string {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok && s != "" {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
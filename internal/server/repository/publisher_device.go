@@ -47,7 +47,90 @@ func (r *PublisherDeviceRepository) GetPublisherDeviceByDeviceID(ctx context.Con
 	return &publisherDevice, err
 }
 
+func (r *PublisherDeviceRepository) UpdateCurrentHash(ctx context.Context, deviceID, hash string, changedAt int64) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"device_id": deviceID},
+		bson.M{"$set": bson.M{"current_hash": hash, "current_changed_at": changedAt, "updated_at": changedAt}},
+	)
+	return err
+}
+
+func (r *PublisherDeviceRepository) UpdateRetention(ctx context.Context, deviceID string, retention *RetentionPolicy, updatedAt int64) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"device_id": deviceID},
+		bson.M{"$set": bson.M{"retention": retention, "updated_at": updatedAt}},
+	)
+	return err
+}
+
+func (r *PublisherDeviceRepository) UpdateStreamSettings(ctx context.Context, deviceID string, public bool, name, description string, tags []string, updatedAt int64) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"device_id": deviceID},
+		bson.M{"$set": bson.M{"public": public, "name": name, "description": description, "tags": tags, "updated_at": updatedAt}},
+	)
+	return err
+}
+
+// GetPublicPublisherDevices returns the public devices, optionally only those
+// among deviceIDs when it isn't nil
+func (r *PublisherDeviceRepository) GetPublicPublisherDevices(ctx context.Context, deviceIDs []string) ([]*PublisherDevice, error) {
+	filter := bson.M{"public": true}
+	if deviceIDs != nil {
+		filter["device_id"] = bson.M{"$in": deviceIDs}
+	}
+
+	publisherDevices := []*PublisherDevice{}
+	cursor, err := r.col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &publisherDevices); err != nil {
+		return nil, err
+	}
+	return publisherDevices, nil
+}
+
+// SearchPublicDeviceIDs returns the public devices whose name, description or
+// tags match pattern, a case-insensitive regular expression
+func (r *PublisherDeviceRepository) SearchPublicDeviceIDs(ctx context.Context, pattern string) ([]string, error) {
+	regex := bson.M{"$regex": pattern, "$options": "i"}
+	values, err := r.col.Distinct(ctx, "device_id", bson.M{
+		"public": true,
+		"$or": bson.A{
+			bson.M{"name": regex},
+			bson.M{"description": regex},
+			bson.M{"tags": regex},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return distinctStrings(values), nil
+}
+
+func (r *PublisherDeviceRepository) GetPublisherDevicesWithRetention(ctx context.Context) ([]*PublisherDevice, error) {
+	publisherDevices := []*PublisherDevice{}
+	cursor, err := r.col.Find(ctx, bson.M{"retention": bson.M{"$ne": nil}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &publisherDevices); err != nil {
+		return nil, err
+	}
+	return publisherDevices, nil
+}
+
 func (r *PublisherDeviceRepository) DeletePublisherDeviceByDeviceID(ctx context.Context, deviceID string) error {
 	_, err := r.col.DeleteOne(ctx, bson.M{"device_id": deviceID})
 	return err
 }
+
+func (r *PublisherDeviceRepository) DeletePublisherDevicesByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
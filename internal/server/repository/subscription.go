@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SubscriptionRepository struct {
+	col *mongo.Collection
+}
+
+func NewSubscriptionRepository(col *mongo.Collection) *SubscriptionRepository {
+	return &SubscriptionRepository{col: col}
+}
+
+func (r *SubscriptionRepository) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	_, err := r.col.InsertOne(ctx, subscription)
+	return err
+}
+
+func (r *SubscriptionRepository) GetSubscription(ctx context.Context, userID, deviceID string) (*Subscription, error) {
+	var subscription Subscription
+	err := r.col.FindOne(ctx, bson.M{"user_id": userID, "device_id": deviceID}).Decode(&subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (r *SubscriptionRepository) GetSubscriptionsByUserID(ctx context.Context, userID string) ([]*Subscription, error) {
+	subscriptions := []*Subscription{}
+	cursor, err := r.col.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// GetSubscriberIDs returns the users subscribed to a device
+func (r *SubscriptionRepository) GetSubscriberIDs(ctx context.Context, deviceID string) ([]string, error) {
+	values, err := r.col.Distinct(ctx, "user_id", bson.M{"device_id": deviceID})
+	if err != nil {
+		return nil, err
+	}
+	return distinctStrings(values), nil
+}
+
+func (r *SubscriptionRepository) DeleteSubscription(ctx context.Context, userID, deviceID string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"user_id": userID, "device_id": deviceID})
+	return err
+}
+
+// CountSubscribersByDeviceIDs returns the number of subscribers of each of the
+// given devices. Devices without subscribers are left out.
+func (r *SubscriptionRepository) CountSubscribersByDeviceIDs(ctx context.Context, deviceIDs []string) (map[string]int64, error) {
+	cursor, err := r.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"device_id": bson.M{"$in": deviceIDs}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$device_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := map[string]int64{}
+	for cursor.Next(ctx) {
+		var row struct {
+			DeviceID string `bson:"_id"`
+			Count    int64  `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		counts[row.DeviceID] = row.Count
+	}
+	return counts, cursor.Err()
+}
+
+// DeleteSubscriptionsByUserID removes the user's subscriptions
+func (r *SubscriptionRepository) DeleteSubscriptionsByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// DeleteSubscriptionsByDeviceIDs removes everyone's subscriptions to the
+// devices
+func (r *SubscriptionRepository) DeleteSubscriptionsByDeviceIDs(ctx context.Context, deviceIDs []string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"device_id": bson.M{"$in": deviceIDs}})
+	return err
+}
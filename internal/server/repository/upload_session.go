@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UploadSessionRepository struct {
+	col *mongo.Collection
+}
+
+func NewUploadSessionRepository(col *mongo.Collection) *UploadSessionRepository {
+	return &UploadSessionRepository{col: col}
+}
+
+func (r *UploadSessionRepository) CreateUploadSession(ctx context.Context, uploadSession *UploadSession) error {
+	_, err := r.col.InsertOne(ctx, uploadSession)
+	return err
+}
+
+func (r *UploadSessionRepository) GetUploadSessionByID(ctx context.Context, id string) (*UploadSession, error) {
+	var uploadSession UploadSession
+	err := r.col.FindOne(ctx, bson.M{"id": id}).Decode(&uploadSession)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &uploadSession, nil
+}
+
+func (r *UploadSessionRepository) UpdateUploadSessionProgress(ctx context.Context, id string, offset int64, filename string, updatedAt int64) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": id},
+		bson.M{"$set": bson.M{"offset": offset, "filename": filename, "updated_at": updatedAt}},
+	)
+	return err
+}
+
+func (r *UploadSessionRepository) DeleteUploadSessionByID(ctx context.Context, id string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *UploadSessionRepository) DeleteUploadSessionsByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// CountUploadSessionsUpdatedBefore counts sessions that haven't been written
+// to since cutoff
+func (r *UploadSessionRepository) CountUploadSessionsUpdatedBefore(ctx context.Context, cutoff int64) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"updated_at": bson.M{"$lt": cutoff}})
+}
+
+// DeleteUploadSessionsUpdatedBefore removes sessions that haven't been written
+// to since cutoff
+func (r *UploadSessionRepository) DeleteUploadSessionsUpdatedBefore(ctx context.Context, cutoff int64) (int64, error) {
+	res, err := r.col.DeleteMany(ctx, bson.M{"updated_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UsersRepository struct {
@@ -60,6 +61,140 @@ func (r *UsersRepository) UpdateUserAPIKey(ctx context.Context, userID, apiKey s
 	return err
 }
 
+func (r *UsersRepository) UpdateUserRole(ctx context.Context, userID, role string, updatedAt int64) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": userID},
+		bson.M{"$set": bson.M{"role": role, "updated_at": updatedAt}},
+	)
+	return err
+}
+
+func (r *UsersRepository) UpdateUserDisabled(ctx context.Context, userID string, disabled bool, updatedAt int64) error {
+	update := bson.M{"$set": bson.M{"disabled": true, "disabled_at": updatedAt, "updated_at": updatedAt}}
+	if !disabled {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": updatedAt},
+			"$unset": bson.M{"disabled": "", "disabled_at": ""},
+		}
+	}
+	_, err := r.col.UpdateOne(ctx, bson.M{"id": userID}, update)
+	return err
+}
+
+// UserFilter narrows a user search. Zero values match everything.
+type UserFilter struct {
+	// Query matches usernames as a case-insensitive regular expression
+	Query    string
+	Role     string
+	Disabled *bool
+}
+
+// SearchUsers returns a page of users ordered by username, along with the
+// total count
+func (r *UsersRepository) SearchUsers(ctx context.Context, filter UserFilter, offset, limit int64) ([]*User, int64, error) {
+	query := bson.M{}
+	if filter.Query != "" {
+		query["username"] = bson.M{"$regex": filter.Query, "$options": "i"}
+	}
+	if filter.Role == RoleUser {
+		// Users from before roles existed have none
+		query["role"] = bson.M{"$in": bson.A{nil, RoleUser}}
+	} else if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query["disabled"] = true
+		} else {
+			query["disabled"] = bson.M{"$ne": true}
+		}
+	}
+
+	total, err := r.col.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "username", Value: 1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.col.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// CountActiveUsersByRole counts the enabled accounts with role that aren't
+// queued for deletion
+func (r *UsersRepository) CountActiveUsersByRole(ctx context.Context, role string) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{
+		"role":                  role,
+		"disabled":              bson.M{"$ne": true},
+		"deletion_requested_at": bson.M{"$exists": false},
+	})
+}
+
+// MarkForDeletion queues an account for deletion. It only applies to accounts
+// not already queued, and reports whether it did.
+func (r *UsersRepository) MarkForDeletion(ctx context.Context, userID string, requestedAt int64) (bool, error) {
+	result, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": userID, "deletion_requested_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deletion_requested_at": requestedAt, "updated_at": requestedAt}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// GetUsersPendingDeletion returns accounts queued for deletion that no
+// deletion job holds a lease on, oldest request first
+func (r *UsersRepository) GetUsersPendingDeletion(ctx context.Context, now, limit int64) ([]*User, error) {
+	users := []*User{}
+	cursor, err := r.col.Find(ctx, bson.M{
+		"deletion_requested_at": bson.M{"$exists": true},
+		"$or": bson.A{
+			bson.M{"deletion_lease_until": bson.M{"$exists": false}},
+			bson.M{"deletion_lease_until": bson.M{"$lte": now}},
+		},
+	}, options.Find().SetSort(bson.D{{Key: "deletion_requested_at", Value: 1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ClaimDeletion takes the lease on a queued account until leaseUntil. It only
+// applies if the lease is still the one the caller saw, so when several
+// servers run the deletion job only one of them works on a given account. It
+// reports whether the update applied.
+func (r *UsersRepository) ClaimDeletion(ctx context.Context, userID string, expectedLeaseUntil, leaseUntil int64) (bool, error) {
+	filter := bson.M{"id": userID, "deletion_requested_at": bson.M{"$exists": true}}
+	if expectedLeaseUntil == 0 {
+		filter["deletion_lease_until"] = bson.M{"$exists": false}
+	} else {
+		filter["deletion_lease_until"] = expectedLeaseUntil
+	}
+	result, err := r.col.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deletion_lease_until": leaseUntil}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
 func (r *UsersRepository) DeleteUserByID(ctx context.Context, id string) error {
 	_, err := r.col.DeleteOne(ctx, bson.M{"id": id})
 	return err
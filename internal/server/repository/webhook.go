@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookRepository struct {
+	col *mongo.Collection
+}
+
+func NewWebhookRepository(col *mongo.Collection) *WebhookRepository {
+	return &WebhookRepository{col: col}
+}
+
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	_, err := r.col.InsertOne(ctx, webhook)
+	return err
+}
+
+func (r *WebhookRepository) GetWebhookByID(ctx context.Context, id string) (*Webhook, error) {
+	var webhook Webhook
+	err := r.col.FindOne(ctx, bson.M{"id": id}).Decode(&webhook)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *WebhookRepository) GetWebhooksByUserID(ctx context.Context, userID string) ([]*Webhook, error) {
+	webhooks := []*Webhook{}
+	cursor, err := r.col.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetEnabledWebhooksForEvent returns the enabled webhooks of any of userIDs
+// that subscribe to event
+func (r *WebhookRepository) GetEnabledWebhooksForEvent(ctx context.Context, userIDs []string, event string) ([]*Webhook, error) {
+	webhooks := []*Webhook{}
+	cursor, err := r.col.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}, "events": event, "enabled": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) ReplaceWebhook(ctx context.Context, webhook *Webhook) error {
+	_, err := r.col.ReplaceOne(ctx, bson.M{"id": webhook.ID}, webhook)
+	return err
+}
+
+func (r *WebhookRepository) DeleteWebhookByID(ctx context.Context, id string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (r *WebhookRepository) DeleteWebhooksByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+type WebhookDeliveryRepository struct {
+	col *mongo.Collection
+}
+
+func NewWebhookDeliveryRepository(col *mongo.Collection) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{col: col}
+}
+
+func (r *WebhookDeliveryRepository) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	_, err := r.col.InsertOne(ctx, delivery)
+	return err
+}
+
+func (r *WebhookDeliveryRepository) GetDeliveryByID(ctx context.Context, id string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := r.col.FindOne(ctx, bson.M{"id": id}).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// GetDeliveriesByWebhookID returns a page of a webhook's deliveries, newest
+// first, along with the total count
+func (r *WebhookDeliveryRepository) GetDeliveriesByWebhookID(ctx context.Context, webhookID string, offset, limit int64) ([]*WebhookDelivery, int64, error) {
+	filter := bson.M{"webhook_id": webhookID}
+	total, err := r.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// GetDueDeliveries returns up to limit pending deliveries whose next attempt
+// is at or before now, oldest first
+func (r *WebhookDeliveryRepository) GetDueDeliveries(ctx context.Context, now, limit int64) ([]*WebhookDelivery, error) {
+	deliveries := []*WebhookDelivery{}
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(limit)
+	cursor, err := r.col.Find(ctx, bson.M{"status": DeliveryStatusPending, "next_attempt_at": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimDelivery pushes a pending delivery's next attempt out to leaseUntil
+// before attempting it. It only applies if the next attempt is still
+// expectedNextAttemptAt, so when several servers deliver only one of them
+// sends a given attempt. It reports whether the update applied.
+func (r *WebhookDeliveryRepository) ClaimDelivery(ctx context.Context, id string, expectedNextAttemptAt, leaseUntil int64) (bool, error) {
+	result, err := r.col.UpdateOne(
+		ctx,
+		bson.M{"id": id, "status": DeliveryStatusPending, "next_attempt_at": expectedNextAttemptAt},
+		bson.M{"$set": bson.M{"next_attempt_at": leaseUntil}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *WebhookDeliveryRepository) ReplaceDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	_, err := r.col.ReplaceOne(ctx, bson.M{"id": delivery.ID}, delivery)
+	return err
+}
+
+func (r *WebhookDeliveryRepository) DeleteDeliveriesByWebhookID(ctx context.Context, webhookID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"webhook_id": webhookID})
+	return err
+}
+
+// DeleteDeliveriesBefore removes finished deliveries created before createdAt
+// and reports how many there were
+func (r *WebhookDeliveryRepository) DeleteDeliveriesBefore(ctx context.Context, createdAt int64) (int64, error) {
+	result, err := r.col.DeleteMany(ctx, bson.M{
+		"status":     bson.M{"$ne": DeliveryStatusPending},
+		"created_at": bson.M{"$lt": createdAt},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *WebhookDeliveryRepository) DeleteDeliveriesByUserID(ctx context.Context, userID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
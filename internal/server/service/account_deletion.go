@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+const (
+	// accountDeletionBatch bounds the accounts deleted per pass
+	accountDeletionBatch = 10
+	// accountDeletionLease is how long a pass has to delete one account
+	// before another server may take over
+	accountDeletionLease = 10 * time.Minute
+)
+
+// AccountDeletionService removes accounts queued for deletion along with
+// everything they own. Every step can be repeated, so an account whose
+// deletion failed part way is picked up again and finished by a later pass.
+// The audit log is kept as a record of what the account did.
+type AccountDeletionService struct {
+	usersRepo              *repository.UsersRepository
+	publisherRepo          *repository.PublisherDeviceRepository
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	subscriptionRepo       *repository.SubscriptionRepository
+	playlistRepo           *repository.PlaylistRepository
+	webhookRepo            *repository.WebhookRepository
+	webhookDeliveryRepo    *repository.WebhookDeliveryRepository
+	deviceTokenRepo        *repository.DeviceTokenRepository
+	deviceCertificateRepo  *repository.DeviceCertificateRepository
+	uploadSessionRepo      *repository.UploadSessionRepository
+	fileService            *FileService
+	auditService           *AuditService
+}
+
+func NewAccountDeletionService(usersRepo *repository.UsersRepository, publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, subscriptionRepo *repository.SubscriptionRepository, playlistRepo *repository.PlaylistRepository, webhookRepo *repository.WebhookRepository, webhookDeliveryRepo *repository.WebhookDeliveryRepository, deviceTokenRepo *repository.DeviceTokenRepository, deviceCertificateRepo *repository.DeviceCertificateRepository, uploadSessionRepo *repository.UploadSessionRepository, fileService *FileService, auditService *AuditService) *AccountDeletionService {
+	return &AccountDeletionService{
+		usersRepo:              usersRepo,
+		publisherRepo:          publisherRepo,
+		publishedWallpaperRepo: publishedWallpaperRepo,
+		subscriptionRepo:       subscriptionRepo,
+		playlistRepo:           playlistRepo,
+		webhookRepo:            webhookRepo,
+		webhookDeliveryRepo:    webhookDeliveryRepo,
+		deviceTokenRepo:        deviceTokenRepo,
+		deviceCertificateRepo:  deviceCertificateRepo,
+		uploadSessionRepo:      uploadSessionRepo,
+		fileService:            fileService,
+		auditService:           auditService,
+	}
+}
+
+// AccountDeletionReport summarizes one deletion pass
+type AccountDeletionReport struct {
+	Due           int      `json:"due"`
+	Deleted       int      `json:"deleted"`
+	ReleasedFiles int      `json:"released_files"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// RunDue deletes the accounts queued for deletion
+func (s *AccountDeletionService) RunDue(ctx context.Context) (*AccountDeletionReport, error) {
+	now := time.Now()
+	users, err := s.usersRepo.GetUsersPendingDeletion(ctx, now.Unix(), accountDeletionBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AccountDeletionReport{}
+	for _, user := range users {
+		report.Due++
+		claimed, err := s.usersRepo.ClaimDeletion(ctx, user.ID, user.DeletionLeaseUntil, now.Add(accountDeletionLease).Unix())
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("user %s: %v", user.Username, err))
+			continue
+		}
+		if !claimed {
+			// Another server got to it first
+			continue
+		}
+
+		if err := s.deleteAccount(ctx, user, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("user %s: %v", user.Username, err))
+			continue
+		}
+		report.Deleted++
+	}
+	return report, nil
+}
+
+// deleteAccount removes everything the user owns, then the user. The account
+// record goes last so that it stays queued until nothing is left.
+func (s *AccountDeletionService) deleteAccount(ctx context.Context, user *repository.User, report *AccountDeletionReport) error {
+	publisherDevices, err := s.publisherRepo.GetPublisherDevicesByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	deviceIDs := make([]string, 0, len(publisherDevices))
+	for _, publisherDevice := range publisherDevices {
+		deviceIDs = append(deviceIDs, publisherDevice.DeviceID)
+	}
+
+	// Stop anything that could publish or send on the user's behalf first
+	if err := s.deviceTokenRepo.DeleteTokensByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("device tokens: %w", err)
+	}
+	if err := s.deviceCertificateRepo.DeleteCertificatesByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("device certificates: %w", err)
+	}
+	if err := s.playlistRepo.DeletePlaylistsByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("playlists: %w", err)
+	}
+	if err := s.webhookRepo.DeleteWebhooksByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+	if err := s.webhookDeliveryRepo.DeleteDeliveriesByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("webhook deliveries: %w", err)
+	}
+
+	// Both the user's subscriptions and everyone's subscriptions to the
+	// user's streams
+	if err := s.subscriptionRepo.DeleteSubscriptionsByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("subscriptions: %w", err)
+	}
+	if len(deviceIDs) > 0 {
+		if err := s.subscriptionRepo.DeleteSubscriptionsByDeviceIDs(ctx, deviceIDs); err != nil {
+			return fmt.Errorf("subscribers: %w", err)
+		}
+	}
+
+	// Abandoned partial files are left to the storage GC
+	if err := s.uploadSessionRepo.DeleteUploadSessionsByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("upload sessions: %w", err)
+	}
+
+	if err := s.deleteWallpapers(ctx, user.ID, report); err != nil {
+		return fmt.Errorf("wallpapers: %w", err)
+	}
+	if err := s.publisherRepo.DeletePublisherDevicesByUserID(ctx, user.ID); err != nil {
+		return fmt.Errorf("devices: %w", err)
+	}
+
+	if err := s.usersRepo.DeleteUserByID(ctx, user.ID); err != nil {
+		return err
+	}
+	s.auditService.Record(ctx, user.ID, AuditUserDeleted, user.Username, map[string]string{
+		"devices": fmt.Sprintf("%d", len(deviceIDs)),
+	})
+	return nil
+}
+
+// deleteWallpapers removes the user's published wallpapers and the stored
+// files nothing else references. Files left behind by an interrupted pass
+// are unreferenced from then on, so the storage GC sweeps them.
+func (s *AccountDeletionService) deleteWallpapers(ctx context.Context, userID string, report *AccountDeletionReport) error {
+	publishedWallpapers, err := s.publishedWallpaperRepo.GetPublishedWallpapersByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.publishedWallpaperRepo.DeletePublishedWallpapersByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	released := map[string]bool{}
+	for _, publishedWallpaper := range publishedWallpapers {
+		for _, file := range publishedWallpaper.Files() {
+			if released[file] {
+				continue
+			}
+			released[file] = true
+
+			// Files are only removed once no one else's wallpaper uses them
+			references, err := s.publishedWallpaperRepo.CountPublishedWallpapersByURL(ctx, file)
+			if err != nil {
+				return err
+			}
+			if references > 0 {
+				continue
+			}
+			if err := s.fileService.Remove(file); err != nil {
+				return err
+			}
+			report.ReleasedFiles++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// roleRanks orders the roles from least to most privileged
+var roleRanks = map[string]int{
+	repository.RoleUser:      0,
+	repository.RoleModerator: 1,
+	repository.RoleAdmin:     2,
+}
+
+// ValidRole reports whether role is one of the repository.Role constants
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants everything min does. An unset role
+// is a plain user.
+func RoleAtLeast(role, min string) bool {
+	if role == "" {
+		role = repository.RoleUser
+	}
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[min]
+}
+
+// AdminService lets moderators look at any account and admins change them
+type AdminService struct {
+	usersRepo              *repository.UsersRepository
+	publisherRepo          *repository.PublisherDeviceRepository
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	fileService            *FileService
+	usersService           *UsersService
+	auditService           *AuditService
+}
+
+func NewAdminService(usersRepo *repository.UsersRepository, publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, fileService *FileService, usersService *UsersService, auditService *AuditService) *AdminService {
+	return &AdminService{usersRepo: usersRepo, publisherRepo: publisherRepo, publishedWallpaperRepo: publishedWallpaperRepo, fileService: fileService, usersService: usersService, auditService: auditService}
+}
+
+// UserList is a page of users ordered by username
+type UserList struct {
+	Total  int64              `json:"total"`
+	Offset int64              `json:"offset"`
+	Limit  int64              `json:"limit"`
+	Users  []*repository.User `json:"users"`
+}
+
+// ListUsers searches users by a username substring, role and whether they are
+// disabled
+func (s *AdminService) ListUsers(ctx context.Context, query, role string, disabled *bool, offset, limit int64) (*UserList, error) {
+	if role != "" && !ValidRole(role) {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInput, role)
+	}
+	filter := repository.UserFilter{Role: role, Disabled: disabled}
+	if query = strings.TrimSpace(query); query != "" {
+		filter.Query = regexp.QuoteMeta(query)
+	}
+
+	users, total, err := s.usersRepo.SearchUsers(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		adminView(user)
+	}
+	return &UserList{Total: total, Offset: offset, Limit: limit, Users: users}, nil
+}
+
+func (s *AdminService) GetUser(ctx context.Context, username string) (*repository.User, error) {
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return adminView(user), nil
+}
+
+func (s *AdminService) GetUserDevices(ctx context.Context, username string) ([]*repository.PublisherDevice, error) {
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	publisherDevices, err := s.publisherRepo.GetPublisherDevicesByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if publisherDevices == nil {
+		publisherDevices = []*repository.PublisherDevice{}
+	}
+	return publisherDevices, nil
+}
+
+// StorageUsage is how much of the upload directory a user's wallpapers take.
+// A file shared by several devices counts once towards the user's total.
+type StorageUsage struct {
+	Username   string          `json:"username"`
+	Wallpapers int             `json:"wallpapers"`
+	Files      int             `json:"files"`
+	Bytes      int64           `json:"bytes"`
+	Devices    []DeviceStorage `json:"devices"`
+	// MissingFiles counts referenced files that aren't on disk
+	MissingFiles int `json:"missing_files,omitempty"`
+}
+
+type DeviceStorage struct {
+	DeviceID   string `json:"device_id"`
+	Wallpapers int    `json:"wallpapers"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+}
+
+func (s *AdminService) GetStorageUsage(ctx context.Context, username string) (*StorageUsage, error) {
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	publishedWallpapers, err := s.publishedWallpaperRepo.GetPublishedWallpapersByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &StorageUsage{Username: user.Username, Devices: []DeviceStorage{}}
+	sizes := map[string]int64{}
+	deviceIndex := map[string]int{}
+	deviceFiles := map[string]map[string]struct{}{}
+	for _, publishedWallpaper := range publishedWallpapers {
+		i, ok := deviceIndex[publishedWallpaper.DeviceID]
+		if !ok {
+			i = len(usage.Devices)
+			deviceIndex[publishedWallpaper.DeviceID] = i
+			deviceFiles[publishedWallpaper.DeviceID] = map[string]struct{}{}
+			usage.Devices = append(usage.Devices, DeviceStorage{DeviceID: publishedWallpaper.DeviceID})
+		}
+		usage.Wallpapers++
+		usage.Devices[i].Wallpapers++
+
+		for _, file := range publishedWallpaper.Files() {
+			filename := filepath.Base(file)
+			size, seen := sizes[filename]
+			if !seen {
+				size, err = s.fileService.Size(filename)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						return nil, err
+					}
+					usage.MissingFiles++
+				}
+				sizes[filename] = size
+				usage.Files++
+				usage.Bytes += size
+			}
+			if _, counted := deviceFiles[publishedWallpaper.DeviceID][filename]; !counted {
+				deviceFiles[publishedWallpaper.DeviceID][filename] = struct{}{}
+				usage.Devices[i].Files++
+				usage.Devices[i].Bytes += size
+			}
+		}
+	}
+	return usage, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling takes effect on
+// the account's next request.
+func (s *AdminService) SetDisabled(ctx context.Context, username string, disabled bool) (*repository.User, error) {
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == RequestInfoFrom(ctx).ActorID {
+		return nil, fmt.Errorf("%w: you can't disable or enable your own account", ErrInvalidInput)
+	}
+	if disabled {
+		if err := refuseOtherAdmin(ctx, user, "disable"); err != nil {
+			return nil, err
+		}
+	}
+	if user.Disabled == disabled {
+		return adminView(user), nil
+	}
+
+	now := time.Now().Unix()
+	if err := s.usersRepo.UpdateUserDisabled(ctx, user.ID, disabled, now); err != nil {
+		return nil, err
+	}
+
+	action := AuditUserEnabled
+	if disabled {
+		action = AuditUserDisabled
+	}
+	s.auditService.Record(ctx, user.ID, action, user.Username, nil)
+
+	user.Disabled, user.DisabledAt, user.UpdatedAt = disabled, 0, now
+	if disabled {
+		user.DisabledAt = now
+	}
+	return adminView(user), nil
+}
+
+func (s *AdminService) SetRole(ctx context.Context, username, role string) (*repository.User, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInput, role)
+	}
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == RequestInfoFrom(ctx).ActorID {
+		return nil, fmt.Errorf("%w: you can't change your own role", ErrInvalidInput)
+	}
+	previous := user.RoleOrDefault()
+	if previous == role {
+		return adminView(user), nil
+	}
+	if err := refuseOtherAdmin(ctx, user, "change the role of"); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if err := s.usersRepo.UpdateUserRole(ctx, user.ID, role, now); err != nil {
+		return nil, err
+	}
+	s.auditService.Record(ctx, user.ID, AuditRoleChanged, user.Username, map[string]string{
+		"from": previous,
+		"to":   role,
+	})
+
+	user.Role, user.UpdatedAt = role, now
+	return adminView(user), nil
+}
+
+// RotateAPIKey forces a new API key on an account, such as when its key has
+// leaked. The new key is returned so it can be handed to the user.
+func (s *AdminService) RotateAPIKey(ctx context.Context, username string) (string, error) {
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if err := refuseOtherAdmin(ctx, user, "rotate the API key of"); err != nil {
+		return "", err
+	}
+	return s.usersService.RotateAPIKey(ctx, user.ID)
+}
+
+// DeleteUser queues another account for deletion. confirm must be its
+// username.
+func (s *AdminService) DeleteUser(ctx context.Context, username, confirm string) (*repository.User, error) {
+	user, err := s.getUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == RequestInfoFrom(ctx).ActorID {
+		return nil, fmt.Errorf("%w: delete your own account with DELETE /api/users/me", ErrInvalidInput)
+	}
+	if err := refuseOtherAdmin(ctx, user, "delete"); err != nil {
+		return nil, err
+	}
+	user, err = s.usersService.RequestDeletion(ctx, user.ID, confirm)
+	if err != nil {
+		return nil, err
+	}
+	return adminView(user), nil
+}
+
+func (s *AdminService) getUser(ctx context.Context, username string) (*repository.User, error) {
+	user, err := s.usersRepo.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: no user %s", ErrNotFound, username)
+	}
+	return user, nil
+}
+
+// refuseOtherAdmin keeps admins from acting against each other, so a single
+// compromised admin account can't lock the rest out. Demoting or removing an
+// admin is done in the database.
+func refuseOtherAdmin(ctx context.Context, user *repository.User, action string) error {
+	if user.RoleOrDefault() == repository.RoleAdmin && user.ID != RequestInfoFrom(ctx).ActorID {
+		return fmt.Errorf("%w: %s is an admin, and admins can't %s other admins", ErrForbidden, user.Username, action)
+	}
+	return nil
+}
+
+// adminView prepares a user to be shown to someone else: the API key is
+// cleared and the role filled in
+func adminView(user *repository.User) *repository.User {
+	user.APIKey = ""
+	user.Role = user.RoleOrDefault()
+	return user
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// Audited actions
+const (
+	AuditUserRegistered      = "user.registered"
+	AuditUserDisabled        = "user.disabled"
+	AuditUserEnabled         = "user.enabled"
+	AuditRoleChanged         = "user.role_changed"
+	AuditDeletionRequested   = "user.deletion_requested"
+	AuditUserDeleted         = "user.deleted"
+	AuditAccountExported     = "account.exported"
+	AuditAccountImported     = "account.imported"
+	AuditAPIKeyRotated       = "api_key.rotated"
+	AuditDeviceTokenCreated  = "device_token.created"
+	AuditDeviceTokenRevoked  = "device_token.revoked"
+	AuditDeviceCertIssued    = "device_certificate.issued"
+	AuditDeviceCertRevoked   = "device_certificate.revoked"
+	AuditDeviceCreated       = "device.created"
+	AuditDeviceDeleted       = "device.deleted"
+	AuditWallpaperPublished  = "wallpaper.published"
+	AuditWallpaperDeleted    = "wallpaper.deleted"
+	AuditSubscriptionCreated = "subscription.created"
+	AuditSubscriptionDeleted = "subscription.deleted"
+)
+
+// RequestInfo is who made a request and from where, as recorded in audit
+// events. The API layer attaches it to the request context.
+type RequestInfo struct {
+	ActorID       string
+	ActorUsername string
+	KeyID         string
+	IP            string
+	RequestID     string
+}
+
+type requestInfoKey struct{}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the request info attached to ctx, or the zero value
+// for work the server does on its own
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// APIKeyID identifies an API key in audit events without revealing it
+func APIKeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key_" + hex.EncodeToString(sum[:6])
+}
+
+// deviceTokenKeyID identifies a device token in audit events
+func deviceTokenKeyID(tokenID string) string {
+	return "token_" + tokenID
+}
+
+// DeviceCertificateKeyID identifies a device certificate in audit events
+func DeviceCertificateKeyID(certificateID string) string {
+	return "cert_" + certificateID
+}
+
+// AuditService writes and reads the audit log
+type AuditService struct {
+	repo *repository.AuditEventRepository
+}
+
+func NewAuditService(repo *repository.AuditEventRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends an event to userID's audit log, taking the actor, key, IP and
+// request ID from ctx. Failing to record is logged rather than failing the
+// action, which has already happened.
+func (s *AuditService) Record(ctx context.Context, userID, action, target string, details map[string]string) {
+	info := RequestInfoFrom(ctx)
+	event := &repository.AuditEvent{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		ActorID:       info.ActorID,
+		ActorUsername: info.ActorUsername,
+		KeyID:         info.KeyID,
+		Action:        action,
+		Target:        target,
+		Details:       details,
+		IP:            info.IP,
+		RequestID:     info.RequestID,
+		CreatedAt:     time.Now().Unix(),
+	}
+	// Record even if the request was cancelled right after the action
+	if err := s.repo.CreateEvent(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("Failed to record audit event %s for user %s: %v", action, userID, err)
+	}
+}
+
+// AuditLog is a page of a user's audit events, newest first
+type AuditLog struct {
+	Total  int64                    `json:"total"`
+	Offset int64                    `json:"offset"`
+	Limit  int64                    `json:"limit"`
+	Events []*repository.AuditEvent `json:"events"`
+}
+
+func (s *AuditService) GetEvents(ctx context.Context, userID string, filter repository.AuditEventFilter, offset, limit int64) (*AuditLog, error) {
+	events, total, err := s.repo.GetEventsByUserID(ctx, userID, filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+		Events: events,
+	}, nil
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// thumbnailDir holds generated catalog thumbnails, named after the file
+	// they were generated from so the storage GC can tell when they're stale
+	thumbnailDir    = ".thumbnails"
+	thumbnailWidth  = 480
+	thumbnailHeight = 270
+
+	CatalogSortPopular = "popular"
+	CatalogSortRecent  = "recent"
+)
+
+// CatalogService lists public streams and manages subscriptions to them
+type CatalogService struct {
+	uploadDir              string
+	publisherRepo          *repository.PublisherDeviceRepository
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	subscriptionRepo       *repository.SubscriptionRepository
+	usersRepo              *repository.UsersRepository
+	webhookService         *WebhookService
+	auditService           *AuditService
+}
+
+func NewCatalogService(uploadDir string, publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, subscriptionRepo *repository.SubscriptionRepository, usersRepo *repository.UsersRepository, webhookService *WebhookService, auditService *AuditService) *CatalogService {
+	return &CatalogService{
+		uploadDir:              uploadDir,
+		publisherRepo:          publisherRepo,
+		publishedWallpaperRepo: publishedWallpaperRepo,
+		subscriptionRepo:       subscriptionRepo,
+		usersRepo:              usersRepo,
+		webhookService:         webhookService,
+		auditService:           auditService,
+	}
+}
+
+// StreamSummary is a public stream as it appears in the catalog
+type StreamSummary struct {
+	DeviceID     string   `json:"device_id"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Owner        string   `json:"owner"`
+	Tags         []string `json:"tags,omitempty"`
+	Subscribers  int64    `json:"subscribers"`
+	CurrentHash  string   `json:"current_hash,omitempty"`
+	UpdatedAt    int64    `json:"updated_at"`
+	ThumbnailURL string   `json:"thumbnail_url,omitempty"`
+}
+
+// CatalogQuery selects a page of the catalog. Every word of Query has to match
+// the stream's name, description or tags, or the metadata of one of its
+// wallpapers. Color, if set, keeps only streams whose current wallpaper
+// matches it.
+type CatalogQuery struct {
+	Query  string
+	Sort   string
+	Color  *ColorFilter
+	Offset int64
+	Limit  int64
+}
+
+// CatalogPage is one page of catalog results
+type CatalogPage struct {
+	Total   int64            `json:"total"`
+	Offset  int64            `json:"offset"`
+	Limit   int64            `json:"limit"`
+	Streams []*StreamSummary `json:"streams"`
+}
+
+// ListStreams searches and sorts the public streams
+func (s *CatalogService) ListStreams(ctx context.Context, query *CatalogQuery) (*CatalogPage, error) {
+	if query.Sort == "" {
+		query.Sort = CatalogSortPopular
+	}
+	if query.Sort != CatalogSortPopular && query.Sort != CatalogSortRecent {
+		return nil, fmt.Errorf("%w: sort must be %s or %s", ErrInvalidInput, CatalogSortPopular, CatalogSortRecent)
+	}
+
+	deviceIDs, err := s.searchDeviceIDs(ctx, query.Query)
+	if err != nil {
+		return nil, err
+	}
+	publisherDevices, err := s.publisherRepo.GetPublicPublisherDevices(ctx, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	if query.Color != nil {
+		publisherDevices, err = s.filterByCurrentColor(ctx, publisherDevices, query.Color)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(publisherDevices))
+	for _, publisherDevice := range publisherDevices {
+		ids = append(ids, publisherDevice.DeviceID)
+	}
+	subscribers, err := s.subscriptionRepo.CountSubscribersByDeviceIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	popular := func(a, b *repository.PublisherDevice) bool {
+		return subscribers[a.DeviceID] > subscribers[b.DeviceID]
+	}
+	recent := func(a, b *repository.PublisherDevice) bool {
+		return a.CurrentChangedAt > b.CurrentChangedAt
+	}
+	first, second := popular, recent
+	if query.Sort == CatalogSortRecent {
+		first, second = recent, popular
+	}
+	sort.SliceStable(publisherDevices, func(i, j int) bool {
+		a, b := publisherDevices[i], publisherDevices[j]
+		switch {
+		case first(a, b):
+			return true
+		case first(b, a):
+			return false
+		case second(a, b):
+			return true
+		case second(b, a):
+			return false
+		}
+		return a.DeviceID < b.DeviceID
+	})
+
+	page := &CatalogPage{
+		Total:   int64(len(publisherDevices)),
+		Offset:  query.Offset,
+		Limit:   query.Limit,
+		Streams: []*StreamSummary{},
+	}
+	start := min(query.Offset, page.Total)
+	end := page.Total
+	if query.Limit > 0 {
+		end = min(start+query.Limit, page.Total)
+	}
+
+	owners := map[string]string{}
+	for _, publisherDevice := range publisherDevices[start:end] {
+		owner, ok := owners[publisherDevice.UserID]
+		if !ok {
+			user, err := s.usersRepo.GetUserByID(ctx, publisherDevice.UserID)
+			if err == nil {
+				owner = user.Username
+			}
+			owners[publisherDevice.UserID] = owner
+		}
+
+		summary := &StreamSummary{
+			DeviceID:    publisherDevice.DeviceID,
+			Name:        publisherDevice.Name,
+			Description: publisherDevice.Description,
+			Owner:       owner,
+			Tags:        publisherDevice.Tags,
+			Subscribers: subscribers[publisherDevice.DeviceID],
+			CurrentHash: publisherDevice.CurrentHash,
+			UpdatedAt:   publisherDevice.CurrentChangedAt,
+		}
+		if summary.Name == "" {
+			summary.Name = publisherDevice.DeviceID
+		}
+		if publisherDevice.CurrentHash != "" {
+			summary.ThumbnailURL = fmt.Sprintf("/api/catalog/streams/%s/thumbnail", publisherDevice.DeviceID)
+		}
+		page.Streams = append(page.Streams, summary)
+	}
+	return page, nil
+}
+
+// filterByCurrentColor keeps the devices whose current wallpaper's palette
+// matches filter. Devices with nothing current never match.
+func (s *CatalogService) filterByCurrentColor(ctx context.Context, publisherDevices []*repository.PublisherDevice, filter *ColorFilter) ([]*repository.PublisherDevice, error) {
+	matching := []*repository.PublisherDevice{}
+	for _, publisherDevice := range publisherDevices {
+		if publisherDevice.CurrentHash == "" {
+			continue
+		}
+		publishedWallpaper, err := currentPublishedWallpaper(ctx, s.publishedWallpaperRepo, publisherDevice)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filter.Matches(publishedWallpaper) {
+			matching = append(matching, publisherDevice)
+		}
+	}
+	return matching, nil
+}
+
+// searchDeviceIDs returns the devices matching every word of query, or nil
+// when there is nothing to search for
+func (s *CatalogService) searchDeviceIDs(ctx context.Context, query string) ([]string, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var matches map[string]bool
+	for _, word := range words {
+		pattern := regexp.QuoteMeta(word)
+		deviceIDs, err := s.publisherRepo.SearchPublicDeviceIDs(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		metadataDeviceIDs, err := s.publishedWallpaperRepo.SearchDeviceIDsByMetadata(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		wordMatches := map[string]bool{}
+		for _, deviceID := range append(deviceIDs, metadataDeviceIDs...) {
+			if matches == nil || matches[deviceID] {
+				wordMatches[deviceID] = true
+			}
+		}
+		matches = wordMatches
+	}
+
+	deviceIDs := make([]string, 0, len(matches))
+	for deviceID := range matches {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	return deviceIDs, nil
+}
+
+// GetStreamThumbnail returns the path of a thumbnail of a public stream's
+// current wallpaper, generating it the first time it's asked for
+func (s *CatalogService) GetStreamThumbnail(ctx context.Context, deviceID string) (string, error) {
+	publisherDevice, err := s.getPublicPublisherDevice(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	return s.currentThumbnail(ctx, publisherDevice)
+}
+
+// GetDeviceThumbnail returns the path of a thumbnail of a device's current
+// wallpaper for its owner, or for anyone if it's a public stream
+func (s *CatalogService) GetDeviceThumbnail(ctx context.Context, userID, deviceID string) (string, error) {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if publisherDevice == nil || (publisherDevice.UserID != userID && !publisherDevice.Public) {
+		return "", fmt.Errorf("%w: no publisher device %s", ErrNotFound, deviceID)
+	}
+	return s.currentThumbnail(ctx, publisherDevice)
+}
+
+// currentThumbnail generates a thumbnail of the device's current wallpaper the
+// first time it's asked for
+func (s *CatalogService) currentThumbnail(ctx context.Context, publisherDevice *repository.PublisherDevice) (string, error) {
+	publishedWallpaper, err := currentPublishedWallpaper(ctx, s.publishedWallpaperRepo, publisherDevice)
+	if err != nil {
+		return "", err
+	}
+
+	thumbnailPath := filepath.Join(s.uploadDir, thumbnailDir, filepath.Base(publishedWallpaper.URL)+".jpg")
+	if _, err := os.Stat(thumbnailPath); err == nil {
+		return thumbnailPath, nil
+	}
+	if err := utils.GenerateThumbnail(filepath.Join(s.uploadDir, filepath.Base(publishedWallpaper.URL)), thumbnailPath, thumbnailWidth, thumbnailHeight); err != nil {
+		return "", fmt.Errorf("%w: no thumbnail for device %s: %v", ErrNotFound, publisherDevice.DeviceID, err)
+	}
+	return thumbnailPath, nil
+}
+
+// Subscribe follows a public stream. Subscribing twice is a no-op.
+func (s *CatalogService) Subscribe(ctx context.Context, userID, deviceID string) (*repository.Subscription, error) {
+	publisherDevice, err := s.getPublicPublisherDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, err := s.subscriptionRepo.GetSubscription(ctx, userID, deviceID)
+	if err != nil || subscription != nil {
+		return subscription, err
+	}
+
+	subscription = &repository.Subscription{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := s.subscriptionRepo.CreateSubscription(ctx, subscription); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// A concurrent request subscribed first
+			return s.subscriptionRepo.GetSubscription(ctx, userID, deviceID)
+		}
+		return nil, err
+	}
+
+	// Tell the stream's owner who subscribed
+	subscriber := SubscriptionRequest{DeviceID: deviceID, UserID: userID}
+	if user, err := s.usersRepo.GetUserByID(ctx, userID); err == nil && user != nil {
+		subscriber.Username = user.Username
+	}
+	s.webhookService.Notify(ctx, EventSubscriptionRequested, []string{publisherDevice.UserID}, subscriber)
+	s.recordSubscription(ctx, AuditSubscriptionCreated, publisherDevice.UserID, userID, deviceID)
+	return subscription, nil
+}
+
+// SubscriptionRequest is the webhook payload of EventSubscriptionRequested
+type SubscriptionRequest struct {
+	DeviceID string `json:"device_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username,omitempty"`
+}
+
+func (s *CatalogService) Unsubscribe(ctx context.Context, userID, deviceID string) error {
+	subscription, err := s.subscriptionRepo.GetSubscription(ctx, userID, deviceID)
+	if err != nil {
+		return err
+	}
+	if subscription == nil {
+		return fmt.Errorf("%w: not subscribed to %s", ErrNotFound, deviceID)
+	}
+	if err := s.subscriptionRepo.DeleteSubscription(ctx, userID, deviceID); err != nil {
+		return err
+	}
+
+	ownerID := ""
+	if publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID); err == nil && publisherDevice != nil {
+		ownerID = publisherDevice.UserID
+	}
+	s.recordSubscription(ctx, AuditSubscriptionDeleted, ownerID, userID, deviceID)
+	return nil
+}
+
+// recordSubscription audits a subscription change for the subscriber and,
+// when known, the stream's owner
+func (s *CatalogService) recordSubscription(ctx context.Context, action, ownerID, subscriberID, deviceID string) {
+	details := map[string]string{"subscriber_id": subscriberID}
+	s.auditService.Record(ctx, subscriberID, action, deviceID, details)
+	if ownerID != "" && ownerID != subscriberID {
+		s.auditService.Record(ctx, ownerID, action, deviceID, details)
+	}
+}
+
+func (s *CatalogService) GetSubscriptions(ctx context.Context, userID string) ([]*repository.Subscription, error) {
+	return s.subscriptionRepo.GetSubscriptionsByUserID(ctx, userID)
+}
+
+func (s *CatalogService) getPublicPublisherDevice(ctx context.Context, deviceID string) (*repository.PublisherDevice, error) {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if publisherDevice == nil || !publisherDevice.Public {
+		return nil, fmt.Errorf("%w: no public stream %s", ErrNotFound, deviceID)
+	}
+	return publisherDevice, nil
+}
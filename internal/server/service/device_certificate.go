@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/pki"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxDeviceCertificates = 20
+	// certificateUseInterval limits how often a certificate's last use is
+	// written, since every request made with it authenticates
+	certificateUseInterval = time.Minute
+)
+
+// IssueDeviceCertificate signs a client certificate for a device from a PEM
+// certificate request. The device keeps its private key; the certificate in
+// the response is the only time it is returned.
+func (s *PublisherService) IssueDeviceCertificate(ctx context.Context, userID, deviceID, name, csrPEM string) (*repository.DeviceCertificate, error) {
+	if s.ca == nil {
+		return nil, fmt.Errorf("%w: device certificates are not enabled on this server", ErrNotFound)
+	}
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) > maxDeviceTokenName {
+		return nil, fmt.Errorf("%w: certificate name is longer than %d characters", ErrInvalidInput, maxDeviceTokenName)
+	}
+
+	count, err := s.deviceCertificateRepo.CountCertificatesByDeviceID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxDeviceCertificates {
+		return nil, fmt.Errorf("%w: a device can have at most %d certificates", ErrInvalidInput, maxDeviceCertificates)
+	}
+
+	cert, certPEM, err := s.ca.Sign([]byte(csrPEM), deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	certificate := &repository.DeviceCertificate{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		DeviceID:    deviceID,
+		Name:        name,
+		Serial:      cert.SerialNumber.Text(16),
+		Fingerprint: pki.Fingerprint(cert),
+		NotAfter:    cert.NotAfter.Unix(),
+		CreatedAt:   time.Now().Unix(),
+	}
+	if err := s.deviceCertificateRepo.CreateCertificate(ctx, certificate); err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(ctx, userID, AuditDeviceCertIssued, deviceID, map[string]string{
+		"certificate_id": DeviceCertificateKeyID(certificate.ID),
+		"name":           name,
+	})
+	certificate.Certificate = string(certPEM)
+	certificate.CACertificate = string(s.ca.CertPEM())
+	return certificate, nil
+}
+
+func (s *PublisherService) GetDeviceCertificates(ctx context.Context, userID, deviceID string) ([]*repository.DeviceCertificate, error) {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+	return s.deviceCertificateRepo.GetCertificatesByDeviceID(ctx, deviceID)
+}
+
+func (s *PublisherService) RevokeDeviceCertificate(ctx context.Context, userID, deviceID, certificateID string) error {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return err
+	}
+	deleted, err := s.deviceCertificateRepo.DeleteCertificate(ctx, deviceID, certificateID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: no certificate %s", ErrNotFound, certificateID)
+	}
+	s.auditService.Record(ctx, userID, AuditDeviceCertRevoked, deviceID, map[string]string{"certificate_id": DeviceCertificateKeyID(certificateID)})
+	return nil
+}
+
+// AuthenticateDeviceCertificate maps a verified client certificate to the
+// device it was issued to and that device's owner. The TLS handshake has
+// already checked the certificate against the CA and its expiry.
+func (s *PublisherService) AuthenticateDeviceCertificate(ctx context.Context, cert *x509.Certificate) (*repository.DeviceCertificate, *repository.User, error) {
+	certificate, err := s.deviceCertificateRepo.GetCertificateByFingerprint(ctx, pki.Fingerprint(cert))
+	if err != nil {
+		return nil, nil, err
+	}
+	if certificate == nil {
+		return nil, nil, fmt.Errorf("%w: unknown or revoked certificate", ErrUnauthorized)
+	}
+
+	owner, err := s.usersRepo.GetUserByID(ctx, certificate.UserID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, fmt.Errorf("%w: unknown or revoked certificate", ErrUnauthorized)
+		}
+		return nil, nil, err
+	}
+	if owner.Locked() {
+		return nil, nil, fmt.Errorf("%w: account disabled", ErrForbidden)
+	}
+
+	now := time.Now()
+	if now.Sub(time.Unix(certificate.LastUsedAt, 0)) >= certificateUseInterval {
+		if err := s.deviceCertificateRepo.UpdateLastUsedAt(ctx, certificate.ID, now.Unix()); err != nil {
+			log.Printf("Failed to record use of device certificate %s: %v", certificate.ID, err)
+		}
+	}
+	return certificate, owner, nil
+}
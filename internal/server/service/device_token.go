@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+const (
+	maxDeviceTokens     = 20
+	maxDeviceTokenName  = 100
+	deviceTokenPrefix   = "wst_"
+	deviceTokenShownLen = len(deviceTokenPrefix) + 8
+)
+
+// inboundClient downloads images published by URL. Token holders pick the
+// URL, so it refuses to reach the server's own network.
+var inboundClient = utils.NewPublicHTTPClient(30 * time.Second)
+
+func hashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateDeviceToken issues a token that can only publish to the device. The
+// returned token is the only time its value is shown.
+func (s *PublisherService) CreateDeviceToken(ctx context.Context, userID, deviceID, name string) (*repository.DeviceToken, error) {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) > maxDeviceTokenName {
+		return nil, fmt.Errorf("%w: token name is longer than %d characters", ErrInvalidInput, maxDeviceTokenName)
+	}
+
+	count, err := s.deviceTokenRepo.CountTokensByDeviceID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxDeviceTokens {
+		return nil, fmt.Errorf("%w: a device can have at most %d tokens", ErrInvalidInput, maxDeviceTokens)
+	}
+
+	secret, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	value := deviceTokenPrefix + secret
+
+	token := &repository.DeviceToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Name:      name,
+		TokenHash: hashDeviceToken(value),
+		Prefix:    value[:deviceTokenShownLen],
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := s.deviceTokenRepo.CreateToken(ctx, token); err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(ctx, userID, AuditDeviceTokenCreated, deviceID, map[string]string{
+		"token_id": deviceTokenKeyID(token.ID),
+		"name":     name,
+	})
+	token.Token = value
+	return token, nil
+}
+
+func (s *PublisherService) GetDeviceTokens(ctx context.Context, userID, deviceID string) ([]*repository.DeviceToken, error) {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+	return s.deviceTokenRepo.GetTokensByDeviceID(ctx, deviceID)
+}
+
+func (s *PublisherService) RevokeDeviceToken(ctx context.Context, userID, deviceID, tokenID string) error {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return err
+	}
+	deleted, err := s.deviceTokenRepo.DeleteToken(ctx, deviceID, tokenID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: no token %s", ErrNotFound, tokenID)
+	}
+	s.auditService.Record(ctx, userID, AuditDeviceTokenRevoked, deviceID, map[string]string{"token_id": deviceTokenKeyID(tokenID)})
+	return nil
+}
+
+// AuthenticateDeviceToken returns the token record for a token value
+func (s *PublisherService) AuthenticateDeviceToken(ctx context.Context, value string) (*repository.DeviceToken, error) {
+	if !strings.HasPrefix(value, deviceTokenPrefix) {
+		return nil, fmt.Errorf("%w: invalid device token", ErrUnauthorized)
+	}
+	token, err := s.deviceTokenRepo.GetTokenByHash(ctx, hashDeviceToken(value))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("%w: invalid device token", ErrUnauthorized)
+	}
+
+	owner, err := s.usersRepo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if owner.Locked() {
+		return nil, fmt.Errorf("%w: account disabled", ErrForbidden)
+	}
+	return token, nil
+}
+
+// PublishWithDeviceToken publishes an image to the token's device the same way
+// its owner would
+func (s *PublisherService) PublishWithDeviceToken(ctx context.Context, token *repository.DeviceToken, file io.Reader, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error) {
+	// The token acts on behalf of its owner
+	info := RequestInfoFrom(ctx)
+	info.ActorID, info.KeyID = token.UserID, deviceTokenKeyID(token.ID)
+	ctx = WithRequestInfo(ctx, info)
+
+	publishedWallpaper, err := s.PublishWallpaperFile(ctx, token.UserID, token.DeviceID, file, metadata, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.deviceTokenRepo.UpdateLastUsedAt(ctx, token.ID, time.Now().Unix()); err != nil {
+		log.Printf("Failed to record use of device token %s: %v", token.ID, err)
+	}
+	return publishedWallpaper, nil
+}
+
+// RollbackWithDeviceToken makes a wallpaper already published to the token's
+// device current again, the same way its owner would
+func (s *PublisherService) RollbackWithDeviceToken(ctx context.Context, token *repository.DeviceToken, hash string) (*repository.PublishedWallpaper, error) {
+	info := RequestInfoFrom(ctx)
+	info.ActorID, info.KeyID = token.UserID, deviceTokenKeyID(token.ID)
+	ctx = WithRequestInfo(ctx, info)
+
+	publishedWallpaper, err := s.RollbackWallpaper(ctx, token.UserID, token.DeviceID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.deviceTokenRepo.UpdateLastUsedAt(ctx, token.ID, time.Now().Unix()); err != nil {
+		log.Printf("Failed to record use of device token %s: %v", token.ID, err)
+	}
+	return publishedWallpaper, nil
+}
+
+// PublishURLWithDeviceToken downloads an image and publishes it to the token's
+// device
+func (s *PublisherService) PublishURLWithDeviceToken(ctx context.Context, token *repository.DeviceToken, imageURL string, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error) {
+	target, err := url.Parse(imageURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an http or https URL", ErrInvalidInput)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	req.Header.Set("User-Agent", "wallstream-inbound")
+
+	// The caller only learns that the download failed, not why, so the
+	// endpoint can't be used to probe what the server can reach
+	resp, err := inboundClient.Do(req)
+	if err != nil {
+		log.Printf("Inbound download of %s for device %s failed: %v", imageURL, token.DeviceID, err)
+		return nil, fmt.Errorf("%w: could not download the image", ErrInvalidInput)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Inbound download of %s for device %s failed: %s", imageURL, token.DeviceID, resp.Status)
+		return nil, fmt.Errorf("%w: could not download the image", ErrInvalidInput)
+	}
+
+	return s.PublishWithDeviceToken(ctx, token, resp.Body, metadata, schedule)
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is wrapped by errors for records that don't exist or that
+	// the caller isn't allowed to see
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidInput is wrapped by errors caused by bad request data
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrUnauthorized is wrapped by errors for missing or invalid
+	// credentials, such as a revoked device token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is wrapped by errors for valid credentials that aren't
+	// allowed to do something, such as a disabled account or missing role
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict is wrapped by errors for requests that disagree with the
+	// current state of a record, such as a stale upload offset
+	ErrConflict = errors.New("conflict")
+	// ErrAlreadyPublished is returned when a device already has a wallpaper
+	// with the same hash
+	ErrAlreadyPublished = fmt.Errorf("%w: wallpaper already published", ErrInvalidInput)
+)
@@ -0,0 +1,572 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+const (
+	exportFormat  = "wallstream-export"
+	exportVersion = 1
+	// exportFilesDir is where the image files are kept in an archive
+	exportFilesDir = "files/"
+	// maxExportRecords bounds the size of a JSON file read from an archive
+	maxExportRecords = 64 << 20
+)
+
+// MaxImportSize caps the size of an uploaded export archive. It is set from
+// the config at startup.
+var MaxImportSize int64 = 10 << 30
+
+// ExportManifest describes an export archive. It is written to
+// manifest.json next to user.json, devices.json, wallpapers.json,
+// playlists.json, subscriptions.json and the image files under files/.
+// Credentials such as API keys, device tokens and webhook secrets are left
+// out.
+type ExportManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Username   string `json:"username"`
+	ExportedAt int64  `json:"exported_at"`
+	// MissingFiles lists referenced files that weren't on disk
+	MissingFiles []string `json:"missing_files,omitempty"`
+}
+
+// AccountExport is everything an archive holds about an account besides the
+// image files
+type AccountExport struct {
+	User          *repository.User
+	Devices       []*repository.PublisherDevice
+	Wallpapers    []*repository.PublishedWallpaper
+	Playlists     []*repository.Playlist
+	Subscriptions []*repository.Subscription
+}
+
+// ExportService writes accounts to zip archives and recreates them from
+// archives, such as when moving between servers
+type ExportService struct {
+	usersRepo              *repository.UsersRepository
+	publisherRepo          *repository.PublisherDeviceRepository
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	subscriptionRepo       *repository.SubscriptionRepository
+	playlistRepo           *repository.PlaylistRepository
+	fileService            *FileService
+	auditService           *AuditService
+}
+
+func NewExportService(usersRepo *repository.UsersRepository, publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, subscriptionRepo *repository.SubscriptionRepository, playlistRepo *repository.PlaylistRepository, fileService *FileService, auditService *AuditService) *ExportService {
+	return &ExportService{usersRepo: usersRepo, publisherRepo: publisherRepo, publishedWallpaperRepo: publishedWallpaperRepo, subscriptionRepo: subscriptionRepo, playlistRepo: playlistRepo, fileService: fileService, auditService: auditService}
+}
+
+// Export loads the records of an account. Loading them before anything is
+// written lets the caller still report errors as such.
+func (s *ExportService) Export(ctx context.Context, userID string) (*AccountExport, error) {
+	user, err := s.usersRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.APIKey = ""
+	user.Role = user.RoleOrDefault()
+
+	publisherDevices, err := s.publisherRepo.GetPublisherDevicesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	publishedWallpapers, err := s.publishedWallpaperRepo.GetPublishedWallpapersByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := s.subscriptionRepo.GetSubscriptionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	playlists := []*repository.Playlist{}
+	for _, publisherDevice := range publisherDevices {
+		devicePlaylists, err := s.playlistRepo.GetPlaylistsByDeviceID(ctx, publisherDevice.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, devicePlaylists...)
+	}
+
+	return &AccountExport{
+		User:          user,
+		Devices:       publisherDevices,
+		Wallpapers:    publishedWallpapers,
+		Playlists:     playlists,
+		Subscriptions: subscriptions,
+	}, nil
+}
+
+// WriteArchive streams an export to w as a zip archive, reading each image
+// file from disk as it goes
+func (s *ExportService) WriteArchive(ctx context.Context, export *AccountExport, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	manifest := &ExportManifest{
+		Format:     exportFormat,
+		Version:    exportVersion,
+		Username:   export.User.Username,
+		ExportedAt: time.Now().Unix(),
+	}
+
+	// Images go first so the manifest can list the ones that are missing
+	written := map[string]bool{}
+	for _, publishedWallpaper := range export.Wallpapers {
+		for _, file := range publishedWallpaper.Files() {
+			filename := filepath.Base(file)
+			if written[filename] {
+				continue
+			}
+			written[filename] = true
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			err := s.writeArchiveFile(archive, filename)
+			if os.IsNotExist(err) {
+				manifest.MissingFiles = append(manifest.MissingFiles, filename)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	records := []struct {
+		name string
+		v    interface{}
+	}{
+		{"manifest.json", manifest},
+		{"user.json", export.User},
+		{"devices.json", nonNil(export.Devices)},
+		{"wallpapers.json", nonNil(export.Wallpapers)},
+		{"playlists.json", nonNil(export.Playlists)},
+		{"subscriptions.json", nonNil(export.Subscriptions)},
+	}
+	for _, record := range records {
+		entry, err := archive.Create(record.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(record.v); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	s.auditService.Record(ctx, export.User.ID, AuditAccountExported, export.User.Username, map[string]string{
+		"devices":    fmt.Sprintf("%d", len(export.Devices)),
+		"wallpapers": fmt.Sprintf("%d", len(export.Wallpapers)),
+	})
+	return nil
+}
+
+// writeArchiveFile copies a stored file into the archive. Images are already
+// compressed, so they are stored as they are.
+func (s *ExportService) writeArchiveFile(archive *zip.Writer, filename string) error {
+	file, err := s.fileService.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     exportFilesDir + filename,
+		Method:   zip.Store,
+		Modified: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// ArchiveImportReport describes what an archive import recreated and what it
+// left out
+type ArchiveImportReport struct {
+	Devices       int      `json:"devices"`
+	MergedDevices int      `json:"merged_devices"`
+	Wallpapers    int      `json:"wallpapers"`
+	Files         int      `json:"files"`
+	Playlists     int      `json:"playlists"`
+	Subscriptions int      `json:"subscriptions"`
+	Skipped       []string `json:"skipped"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// ImportArchive recreates an export archive read from r under userID. Devices
+// that don't exist here are created with their settings and playlists;
+// devices the user already has get the wallpapers they are missing. Devices
+// owned by someone else on this server are skipped. Importing the same
+// archive again only fills in what failed the first time.
+func (s *ExportService) ImportArchive(ctx context.Context, userID string, r io.Reader) (*ArchiveImportReport, error) {
+	// zip needs random access, so the upload is spooled to disk first
+	spool, err := s.fileService.CreateTemp("import-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, io.LimitReader(r, MaxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxImportSize {
+		return nil, fmt.Errorf("%w: archive exceeds %d bytes", ErrInvalidInput, MaxImportSize)
+	}
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a zip archive: %v", ErrInvalidInput, err)
+	}
+
+	var manifest ExportManifest
+	if err := readArchiveJSON(archive, "manifest.json", &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Format != exportFormat || manifest.Version != exportVersion {
+		return nil, fmt.Errorf("%w: unsupported archive format %s version %d", ErrInvalidInput, manifest.Format, manifest.Version)
+	}
+	export := &AccountExport{}
+	for name, v := range map[string]interface{}{
+		"devices.json":       &export.Devices,
+		"wallpapers.json":    &export.Wallpapers,
+		"playlists.json":     &export.Playlists,
+		"subscriptions.json": &export.Subscriptions,
+	} {
+		if err := readArchiveJSON(archive, name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	importer := &accountImporter{
+		ExportService: s,
+		userID:        userID,
+		archive:       archive,
+		stored:        map[string]*StoredFile{},
+		report:        &ArchiveImportReport{Skipped: []string{}},
+	}
+	if err := importer.run(ctx, export); err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(ctx, userID, AuditAccountImported, manifest.Username, map[string]string{
+		"devices":    fmt.Sprintf("%d", importer.report.Devices),
+		"wallpapers": fmt.Sprintf("%d", importer.report.Wallpapers),
+	})
+	return importer.report, nil
+}
+
+// accountImporter holds the state of one import
+type accountImporter struct {
+	*ExportService
+	userID  string
+	archive *zip.Reader
+	// stored maps the archive's file names to the files stored from them
+	stored map[string]*StoredFile
+	report *ArchiveImportReport
+}
+
+func (im *accountImporter) run(ctx context.Context, export *AccountExport) error {
+	// created are the devices made by this import, with the current hash
+	// they had when exported
+	created := map[string]string{}
+	merged := map[string]bool{}
+	for _, exported := range export.Devices {
+		existing, err := im.publisherRepo.GetPublisherDeviceByDeviceID(ctx, exported.DeviceID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case existing == nil:
+			// Checked the way changing the settings through the API would
+			// check them
+			settings, err := normalizeStreamSettings(exported.DeviceID, &StreamSettings{
+				Public:      exported.Public,
+				Name:        exported.Name,
+				Description: exported.Description,
+				Tags:        exported.Tags,
+			})
+			if err == nil {
+				err = validateRetentionPolicy(exported.Retention)
+			}
+			if err != nil {
+				im.report.Skipped = append(im.report.Skipped, fmt.Sprintf("device %s: %v", exported.DeviceID, err))
+				continue
+			}
+
+			now := time.Now().Unix()
+			publisherDevice := *exported
+			publisherDevice.ID = uuid.New().String()
+			publisherDevice.UserID = im.userID
+			publisherDevice.Public, publisherDevice.Name = settings.Public, settings.Name
+			publisherDevice.Description, publisherDevice.Tags = settings.Description, settings.Tags
+			// Set once its wallpaper has been imported
+			publisherDevice.CurrentHash, publisherDevice.CurrentChangedAt = "", 0
+			publisherDevice.UpdatedAt = now
+			if err := im.publisherRepo.CreatePublisherDevice(ctx, &publisherDevice); err != nil {
+				return err
+			}
+			created[exported.DeviceID] = exported.CurrentHash
+			im.report.Devices++
+		case existing.UserID == im.userID:
+			merged[exported.DeviceID] = true
+			im.report.MergedDevices++
+		default:
+			im.report.Skipped = append(im.report.Skipped, fmt.Sprintf("device %s: taken by another user", exported.DeviceID))
+		}
+	}
+
+	imported := map[string]bool{}
+	for _, exported := range export.Wallpapers {
+		if _, ok := created[exported.DeviceID]; !ok && !merged[exported.DeviceID] {
+			continue
+		}
+		ok, err := im.importWallpaper(ctx, exported)
+		if err != nil {
+			im.report.Errors = append(im.report.Errors, fmt.Sprintf("wallpaper %s on %s: %v", exported.Hash, exported.DeviceID, err))
+			continue
+		}
+		imported[exported.DeviceID+"/"+exported.Hash] = true
+		if ok {
+			im.report.Wallpapers++
+		}
+	}
+
+	for deviceID, currentHash := range created {
+		if currentHash == "" || !imported[deviceID+"/"+currentHash] {
+			continue
+		}
+		if err := im.publisherRepo.UpdateCurrentHash(ctx, deviceID, currentHash, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+
+	// Playlists only come along with the devices they belong to
+	for _, exported := range export.Playlists {
+		if _, ok := created[exported.DeviceID]; !ok {
+			continue
+		}
+		playlist := *exported
+		playlist.ID = uuid.New().String()
+		playlist.UserID = im.userID
+		playlist.Hashes = filterHashes(playlist.Hashes, exported.DeviceID, imported)
+		playlist.Order = filterHashes(playlist.Order, exported.DeviceID, imported)
+		playlist.Position = min(playlist.Position, max(len(playlist.Order)-1, 0))
+		if len(playlist.Hashes) == 0 {
+			playlist.Enabled = false
+		}
+		if err := im.playlistRepo.CreatePlaylist(ctx, &playlist); err != nil {
+			return err
+		}
+		im.report.Playlists++
+	}
+
+	for _, exported := range export.Subscriptions {
+		if err := im.importSubscription(ctx, exported.DeviceID); err != nil {
+			im.report.Skipped = append(im.report.Skipped, fmt.Sprintf("subscription to %s: %v", exported.DeviceID, err))
+		}
+	}
+	return nil
+}
+
+// importWallpaper stores a wallpaper's files and records it. It reports
+// false for wallpapers the device already has. Wallpapers whose files don't
+// match their hashes are rejected; the files stored for them are left for the
+// storage GC, as they may be shared with other wallpapers.
+func (im *accountImporter) importWallpaper(ctx context.Context, exported *repository.PublishedWallpaper) (bool, error) {
+	existing, err := im.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, exported.DeviceID, exported.Hash)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		return false, nil
+	}
+
+	publishedWallpaper := *exported
+	publishedWallpaper.ID = uuid.New().String()
+	publishedWallpaper.UserID = im.userID
+	publishedWallpaper.WallpaperMetadata, err = normalizeMetadata(exported.WallpaperMetadata)
+	if err != nil {
+		return false, err
+	}
+
+	primary, err := im.storeFile(ctx, exported.URL)
+	if err != nil {
+		return false, err
+	}
+	publishedWallpaper.URL = primary.Path
+	publishedWallpaper.Monitors = append([]repository.MonitorImage(nil), exported.Monitors...)
+	for i := range publishedWallpaper.Monitors {
+		monitor := &publishedWallpaper.Monitors[i]
+		stored, err := im.storeFile(ctx, monitor.URL)
+		if err != nil {
+			return false, err
+		}
+		if stored.Hash != monitor.Hash {
+			return false, fmt.Errorf("%w: image of monitor %d doesn't match its hash", ErrInvalidInput, monitor.Index)
+		}
+		monitor.URL = stored.Path
+	}
+	publishedWallpaper.Variants = append([]repository.WallpaperVariant(nil), exported.Variants...)
+	for i := range publishedWallpaper.Variants {
+		variant := &publishedWallpaper.Variants[i]
+		stored, err := im.storeFile(ctx, variant.URL)
+		if err != nil {
+			return false, err
+		}
+		if stored.Hash != variant.Hash {
+			return false, fmt.Errorf("%w: %s variant doesn't match its hash", ErrInvalidInput, variant.Kind)
+		}
+		variant.URL = stored.Path
+	}
+
+	// The wallpaper's hash is derived from its files' the way publishing
+	// derives it. A set's main image is one of its monitors'.
+	hash := variantsHash(primary.Hash, publishedWallpaper.Variants)
+	if len(publishedWallpaper.Monitors) > 0 {
+		hash = wallpaperSetHash(publishedWallpaper.Monitors)
+		if !slices.ContainsFunc(publishedWallpaper.Monitors, func(monitor repository.MonitorImage) bool { return monitor.Hash == primary.Hash }) {
+			hash = ""
+		}
+	}
+	if hash != exported.Hash {
+		return false, fmt.Errorf("%w: files don't match the wallpaper's hash", ErrInvalidInput)
+	}
+
+	// Pins and schedule state belong to the exporting server. Only a schedule
+	// still to come is kept, to go live here when it's due; everything else
+	// arrives as plain history.
+	publishedWallpaper.Pinned = false
+	publishedWallpaper.RevertHash = ""
+	now := time.Now().Unix()
+	if exported.ScheduleStatus == repository.ScheduleStatusPending && exported.PublishAt > now &&
+		(exported.ExpiresAt == 0 || exported.ExpiresAt > exported.PublishAt) {
+		publishedWallpaper.ScheduleStatus = repository.ScheduleStatusPending
+	} else {
+		publishedWallpaper.PublishSchedule = repository.PublishSchedule{}
+		publishedWallpaper.ScheduleStatus = ""
+	}
+
+	// The palette is worked out again rather than trusted, as color searches
+	// rely on it
+	publishedWallpaper.Palette, publishedWallpaper.Luminance = nil, 0
+	palette, err := utils.ExtractPalette(primary.Path, paletteSize)
+	if err != nil {
+		log.Printf("Skipping palette for %s: %v", primary.Path, err)
+	} else {
+		publishedWallpaper.Palette = palette.Colors
+		publishedWallpaper.Luminance = palette.Luminance
+	}
+
+	if err := im.publishedWallpaperRepo.CreatePublishedWallpaper(ctx, &publishedWallpaper); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// storeFile stores the archive's copy of a file referenced by an exported
+// wallpaper once, and returns the stored file
+func (im *accountImporter) storeFile(ctx context.Context, exportedPath string) (*StoredFile, error) {
+	filename := filepath.Base(exportedPath)
+	if stored, ok := im.stored[filename]; ok {
+		return stored, nil
+	}
+
+	entry, err := im.archive.Open(path.Join(exportFilesDir, filename))
+	if err != nil {
+		return nil, fmt.Errorf("%w: file %s is missing from the archive", ErrInvalidInput, filename)
+	}
+	defer entry.Close()
+
+	stored, err := im.fileService.StoreImage(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+	im.stored[filename] = stored
+	im.report.Files++
+	return stored, nil
+}
+
+// importSubscription follows a stream again if it is public, or the user's
+// own, on this server
+func (im *accountImporter) importSubscription(ctx context.Context, deviceID string) error {
+	publisherDevice, err := im.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if publisherDevice == nil || (!publisherDevice.Public && publisherDevice.UserID != im.userID) {
+		return errors.New("no such public stream here")
+	}
+	existing, err := im.subscriptionRepo.GetSubscription(ctx, im.userID, deviceID)
+	if err != nil || existing != nil {
+		return err
+	}
+	if err := im.subscriptionRepo.CreateSubscription(ctx, &repository.Subscription{
+		ID:        uuid.New().String(),
+		UserID:    im.userID,
+		DeviceID:  deviceID,
+		CreatedAt: time.Now().Unix(),
+	}); err != nil {
+		return err
+	}
+	im.report.Subscriptions++
+	return nil
+}
+
+// filterHashes keeps the hashes whose wallpapers the device has after the
+// import
+func filterHashes(hashes []string, deviceID string, imported map[string]bool) []string {
+	kept := []string{}
+	for _, hash := range hashes {
+		if imported[deviceID+"/"+hash] {
+			kept = append(kept, hash)
+		}
+	}
+	return kept
+}
+
+// readArchiveJSON decodes a JSON file of an export archive into v
+func readArchiveJSON(archive *zip.Reader, name string, v interface{}) error {
+	entry, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("%w: archive has no %s", ErrInvalidInput, name)
+	}
+	defer entry.Close()
+	if err := json.NewDecoder(io.LimitReader(entry, maxExportRecords)).Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid %s: %v", ErrInvalidInput, name, err)
+	}
+	return nil
+}
+
+// nonNil keeps empty lists from being written as null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -1,15 +1,43 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/metrics"
 )
 
+// MaxUploadSize caps the size of a single wallpaper upload. It is set from
+// the config at startup.
+var MaxUploadSize int64 = 50 << 20
+
+// incomingDir holds uploads while they are being verified, and scratch
+// files. The GC only sweeps files here once they are older than
+// staleUploadAge, so nothing still in use is removed.
+const incomingDir = ".incoming"
+
+// allowedImageTypes maps sniffed content types to the extension files are
+// stored with
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
 type FileService struct {
 	uploadDir string
 }
@@ -18,6 +46,13 @@ func NewFileService(uploadDir string) *FileService {
 	return &FileService{uploadDir: uploadDir}
 }
 
+// Path returns where a stored file lives on disk. Records name files by
+// their path when they were stored, so only the base name is kept in case
+// the upload directory has moved since.
+func (s *FileService) Path(filename string) string {
+	return filepath.Join(s.uploadDir, filepath.Base(filename))
+}
+
 func (s *FileService) UploadFileStream(ctx context.Context, file multipart.File, filename string) (string, error) {
 	if err := os.MkdirAll(s.uploadDir, 0755); err != nil {
 		return "", err
@@ -32,9 +67,138 @@ func (s *FileService) UploadFileStream(ctx context.Context, file multipart.File,
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
+	start := time.Now()
+	size, err := io.Copy(dst, file)
+	observeUpload("file", start, size, err)
+	if err != nil {
 		return "", err
 	}
 
 	return uniqueName, nil
 }
+
+// observeUpload records an upload's size and how long receiving it took.
+// Uploads rejected as invalid are told apart from ones that failed.
+func observeUpload(kind string, start time.Time, size int64, err error) {
+	result := metrics.Result(err)
+	if errors.Is(err, ErrInvalidInput) {
+		result = "rejected"
+	}
+	metrics.UploadDuration.WithLabelValues(kind, result).Observe(time.Since(start).Seconds())
+	metrics.UploadBytes.WithLabelValues(kind).Add(float64(size))
+}
+
+// StoredFile is an upload that passed verification and now lives in the
+// upload directory
+type StoredFile struct {
+	Filename    string
+	Path        string
+	Hash        string
+	Size        int64
+	ContentType string
+}
+
+// StoreImage streams r to disk while hashing it, checks that it is an image
+// of an allowed type no larger than MaxUploadSize, and only then moves it
+// into the upload directory. Nothing is left behind on failure.
+func (s *FileService) StoreImage(ctx context.Context, r io.Reader) (stored *StoredFile, err error) {
+	start := time.Now()
+	defer func() {
+		var size int64
+		if stored != nil {
+			size = stored.Size
+		}
+		observeUpload("image", start, size, err)
+	}()
+
+	incoming := filepath.Join(s.uploadDir, incomingDir)
+	if err := os.MkdirAll(incoming, 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(incoming, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Sniff the type from the first bytes before writing anything
+	buffered := bufio.NewReaderSize(r, 512)
+	head, _ := buffered.Peek(512)
+	contentType := http.DetectContentType(head)
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported file type %s", ErrInvalidInput, contentType)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(buffered, MaxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxUploadSize {
+		return nil, fmt.Errorf("%w: file exceeds %d bytes", ErrInvalidInput, MaxUploadSize)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Formats we have decoders for must actually decode
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, _, err := image.DecodeConfig(tmp); err != nil && err != image.ErrFormat {
+		return nil, fmt.Errorf("%w: corrupt image: %v", ErrInvalidInput, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	filename := uuid.New().String() + ext
+	dstPath := filepath.Join(s.uploadDir, filename)
+	if err := os.Rename(tmp.Name(), dstPath); err != nil {
+		return nil, err
+	}
+
+	return &StoredFile{
+		Filename:    filename,
+		Path:        dstPath,
+		Hash:        hex.EncodeToString(hasher.Sum(nil)),
+		Size:        size,
+		ContentType: contentType,
+	}, nil
+}
+
+// Remove deletes a stored file
+func (s *FileService) Remove(filename string) error {
+	err := os.Remove(filepath.Join(s.uploadDir, filepath.Base(filename)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Size returns the size of a stored file
+func (s *FileService) Size(filename string) (int64, error) {
+	info, err := os.Stat(filepath.Join(s.uploadDir, filepath.Base(filename)))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Open opens a stored file for reading
+func (s *FileService) Open(filename string) (*os.File, error) {
+	return os.Open(filepath.Join(s.uploadDir, filepath.Base(filename)))
+}
+
+// CreateTemp creates a scratch file next to in-flight uploads. The GC leaves
+// it alone until it is older than staleUploadAge; the caller removes it.
+func (s *FileService) CreateTemp(pattern string) (*os.File, error) {
+	incoming := filepath.Join(s.uploadDir, incomingDir)
+	if err := os.MkdirAll(incoming, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(incoming, pattern)
+}
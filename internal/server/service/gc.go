@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// staleUploadAge is the least time a staging file has gone unmodified before
+// the GC treats it as abandoned, whatever the grace period
+const staleUploadAge = 24 * time.Hour
+
+// StorageGC deletes files in the upload directory that no published wallpaper
+// references, such as uploads that were never published or whose records were
+// deleted
+type StorageGC struct {
+	uploadDir              string
+	gracePeriod            time.Duration
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	uploadSessionRepo      *repository.UploadSessionRepository
+}
+
+func NewStorageGC(uploadDir string, gracePeriod time.Duration, publishedWallpaperRepo *repository.PublishedWallpaperRepository, uploadSessionRepo *repository.UploadSessionRepository) *StorageGC {
+	return &StorageGC{uploadDir: uploadDir, gracePeriod: gracePeriod, publishedWallpaperRepo: publishedWallpaperRepo, uploadSessionRepo: uploadSessionRepo}
+}
+
+// SweepReport describes what a sweep did, or would do on a dry run
+type SweepReport struct {
+	DryRun     bool     `json:"dry_run"`
+	Scanned    int      `json:"scanned"`
+	Referenced int      `json:"referenced"`
+	TooRecent  int      `json:"too_recent"`
+	Deleted    []string `json:"deleted"`
+	FreedBytes int64    `json:"freed_bytes"`
+	// StaleUploads counts abandoned resumable or in-flight uploads
+	StaleUploads int `json:"stale_uploads"`
+	// StaleUploadSessions counts records of abandoned resumable uploads
+	StaleUploadSessions int64 `json:"stale_upload_sessions"`
+	// StaleThumbnails counts catalog thumbnails of files that are gone
+	StaleThumbnails int      `json:"stale_thumbnails"`
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// Sweep removes unreferenced files older than the grace period. The grace
+// period covers the window between an upload and the publish that references
+// it, so a sweep never races a client that is mid-publish.
+func (g *StorageGC) Sweep(ctx context.Context, dryRun bool) (*SweepReport, error) {
+	report := &SweepReport{DryRun: dryRun, Deleted: []string{}}
+
+	entries, err := os.ReadDir(g.uploadDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return nil, err
+	}
+
+	referenced, err := g.publishedWallpaperRepo.GetReferencedFilenames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-g.gracePeriod)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		report.Scanned++
+
+		if _, ok := referenced[entry.Name()]; ok {
+			report.Referenced++
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		if info.ModTime().After(cutoff) {
+			report.TooRecent++
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(filepath.Join(g.uploadDir, entry.Name())); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+		}
+		report.Deleted = append(report.Deleted, entry.Name())
+		report.FreedBytes += info.Size()
+	}
+
+	// Staging files can be in use for longer than a short grace period, such
+	// as an import spool that is read for the whole import
+	staleCutoff := time.Now().Add(-staleUploadAge)
+	if cutoff.Before(staleCutoff) {
+		staleCutoff = cutoff
+	}
+	for _, dir := range []string{partialDir, incomingDir} {
+		g.sweepStaleUploads(filepath.Join(g.uploadDir, dir), staleCutoff, report)
+	}
+	g.sweepUploadSessions(ctx, staleCutoff, report)
+	g.sweepThumbnails(filepath.Join(g.uploadDir, thumbnailDir), referenced, report)
+
+	return report, nil
+}
+
+// sweepStaleUploads removes files in a staging directory that haven't been
+// written to since cutoff. Resumable uploads touch their partial file on every
+// append, so only abandoned ones are old enough.
+func (g *StorageGC) sweepStaleUploads(dir string, cutoff time.Time, report *SweepReport) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if !report.DryRun {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+		}
+		report.StaleUploads++
+		report.FreedBytes += info.Size()
+	}
+}
+
+// sweepUploadSessions removes the records of resumable uploads that stopped
+// before the same cutoff as their partial files, which are gone or going, so
+// they can't be resumed anyway
+func (g *StorageGC) sweepUploadSessions(ctx context.Context, cutoff time.Time, report *SweepReport) {
+	var (
+		n   int64
+		err error
+	)
+	if report.DryRun {
+		n, err = g.uploadSessionRepo.CountUploadSessionsUpdatedBefore(ctx, cutoff.Unix())
+	} else {
+		n, err = g.uploadSessionRepo.DeleteUploadSessionsUpdatedBefore(ctx, cutoff.Unix())
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return
+	}
+	report.StaleUploadSessions = n
+}
+
+// sweepThumbnails removes thumbnails whose source file is no longer referenced.
+// They can always be generated again, so there's no grace period.
+func (g *StorageGC) sweepThumbnails(dir string, referenced map[string]struct{}, report *SweepReport) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		// Dotfiles are thumbnails still being written
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if _, ok := referenced[strings.TrimSuffix(entry.Name(), ".jpg")]; ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if !report.DryRun {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				continue
+			}
+		}
+		report.StaleThumbnails++
+		report.FreedBytes += info.Size()
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/importer"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+// ImportService keeps the official streams up to date by publishing each
+// importer's latest image onto a public device owned by a system user
+type ImportService struct {
+	username               string
+	streams                []importer.Stream
+	client                 *http.Client
+	usersRepo              *repository.UsersRepository
+	publisherRepo          *repository.PublisherDeviceRepository
+	publisherService       *PublisherService
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+}
+
+func NewImportService(username string, streams []importer.Stream, usersRepo *repository.UsersRepository, publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, publisherService *PublisherService) *ImportService {
+	return &ImportService{
+		username:               username,
+		streams:                streams,
+		client:                 &http.Client{Timeout: 5 * time.Minute},
+		usersRepo:              usersRepo,
+		publisherRepo:          publisherRepo,
+		publisherService:       publisherService,
+		publishedWallpaperRepo: publishedWallpaperRepo,
+	}
+}
+
+// ImportReport summarizes one import pass
+type ImportReport struct {
+	Streams   int      `json:"streams"`
+	Published int      `json:"published"`
+	Unchanged int      `json:"unchanged"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// Run checks every stream's source and publishes images that are new
+func (s *ImportService) Run(ctx context.Context) (*ImportReport, error) {
+	report := &ImportReport{}
+	if len(s.streams) == 0 {
+		return report, nil
+	}
+
+	user, err := s.ensureSystemUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range s.streams {
+		report.Streams++
+		published, err := s.importStream(ctx, user.ID, stream)
+		switch {
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Sprintf("stream %s: %v", stream.DeviceID, err))
+		case published:
+			report.Published++
+		default:
+			report.Unchanged++
+		}
+	}
+	return report, nil
+}
+
+func (s *ImportService) importStream(ctx context.Context, userID string, stream importer.Stream) (bool, error) {
+	publisherDevice, err := s.ensureStreamDevice(ctx, userID, stream)
+	if err != nil {
+		return false, err
+	}
+
+	item, err := stream.Importer.Latest(ctx)
+	if errors.Is(err, importer.ErrNoImage) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Skip the download when the source still offers what's current
+	current, err := currentPublishedWallpaper(ctx, s.publishedWallpaperRepo, publisherDevice)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	if current != nil && current.SourceURL == item.Metadata.SourceURL && current.Title == item.Metadata.Title {
+		return false, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, item.ImageURL, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET %s: %s", item.ImageURL, resp.Status)
+	}
+
+	_, err = s.publisherService.PublishWallpaperFile(ctx, userID, stream.DeviceID, resp.Body, item.Metadata, repository.PublishSchedule{})
+	if errors.Is(err, ErrAlreadyPublished) {
+		// The source went back to an image we already have
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ensureSystemUser returns the user that owns the official streams, creating
+// it on first use. An account someone else registered under the name is never
+// taken over.
+func (s *ImportService) ensureSystemUser(ctx context.Context) (*repository.User, error) {
+	user, err := s.usersRepo.GetUserByUsername(ctx, s.username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if !user.System {
+			return nil, fmt.Errorf("%w: %s is a registered account, not the system account; set import.username to a free name", ErrConflict, s.username)
+		}
+		if user.Locked() {
+			return nil, fmt.Errorf("%w: system account %s is locked", ErrForbidden, s.username)
+		}
+		return user, nil
+	}
+
+	apiKey, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	user = &repository.User{
+		ID:        uuid.New().String(),
+		Username:  s.username,
+		APIKey:    apiKey,
+		System:    true,
+		CreatedAt: time.Now().Unix(),
+		UpdatedAt: time.Now().Unix(),
+	}
+	if err := s.usersRepo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ensureStreamDevice returns the stream's device, creating it as a public
+// stream on first use
+func (s *ImportService) ensureStreamDevice(ctx context.Context, userID string, stream importer.Stream) (*repository.PublisherDevice, error) {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, stream.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if publisherDevice != nil {
+		if publisherDevice.UserID != userID {
+			return nil, fmt.Errorf("%w: device %s belongs to another user", ErrConflict, stream.DeviceID)
+		}
+		return publisherDevice, nil
+	}
+
+	if err := s.publisherService.CreatePublisherDevice(ctx, userID, stream.DeviceID); err != nil {
+		return nil, err
+	}
+	return s.publisherService.UpdateStreamSettings(ctx, userID, stream.DeviceID, &StreamSettings{
+		Public: true,
+		Name:   stream.Importer.Name(),
+		Tags:   []string{"official"},
+	})
+}
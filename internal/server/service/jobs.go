@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/metrics"
+)
+
+// RunPeriodically calls fn every interval until ctx is cancelled. Failures are
+// logged and the job simply runs again on the next tick.
+func RunPeriodically(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("Job %s scheduled every %s", name, interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			RunJob(ctx, name, fn)
+		}
+	}
+}
+
+// RunJob runs a job once, logging a failure and recording the outcome in the
+// job metrics
+func RunJob(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	start := time.Now()
+	err := fn(ctx)
+	metrics.JobDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	metrics.JobRuns.WithLabelValues(name, metrics.Result(err)).Inc()
+	if err != nil {
+		log.Printf("Job %s failed: %v", name, err)
+		return
+	}
+	metrics.JobLastSuccess.WithLabelValues(name).SetToCurrentTime()
+}
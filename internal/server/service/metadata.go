@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 4000
+	maxAttributionLength = 200
+	maxLicenseLength     = 64
+	maxTags              = 20
+	maxTagLength         = 32
+)
+
+// normalizeMetadata trims the metadata, lowercases and deduplicates tags, and
+// rejects values that are too long or a source URL that isn't http(s)
+func normalizeMetadata(metadata repository.WallpaperMetadata) (repository.WallpaperMetadata, error) {
+	metadata.Title = strings.TrimSpace(metadata.Title)
+	metadata.Description = strings.TrimSpace(metadata.Description)
+	metadata.SourceURL = strings.TrimSpace(metadata.SourceURL)
+	metadata.Author = strings.TrimSpace(metadata.Author)
+	metadata.License = strings.TrimSpace(metadata.License)
+
+	limits := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"title", metadata.Title, maxTitleLength},
+		{"description", metadata.Description, maxDescriptionLength},
+		{"author", metadata.Author, maxAttributionLength},
+		{"license", metadata.License, maxLicenseLength},
+	}
+	for _, limit := range limits {
+		if len(limit.value) > limit.max {
+			return metadata, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidInput, limit.name, limit.max)
+		}
+	}
+
+	if metadata.SourceURL != "" {
+		sourceURL, err := url.Parse(metadata.SourceURL)
+		if err != nil || (sourceURL.Scheme != "http" && sourceURL.Scheme != "https") || sourceURL.Host == "" {
+			return metadata, fmt.Errorf("%w: source_url must be an absolute http or https URL", ErrInvalidInput)
+		}
+	}
+
+	tags, err := normalizeTags(metadata.Tags)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Tags = tags
+	return metadata, nil
+}
+
+// normalizeTags lowercases, trims and deduplicates tags, dropping empty ones
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidInput, tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidInput, maxTags)
+	}
+	return normalized, nil
+}
+
+// WallpaperMetadataPatch changes the fields that are set and leaves the rest
+// alone. Setting a field to an empty value clears it.
+type WallpaperMetadataPatch struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	SourceURL   *string   `json:"source_url"`
+	Author      *string   `json:"author"`
+	License     *string   `json:"license"`
+	Tags        *[]string `json:"tags"`
+}
+
+func (p *WallpaperMetadataPatch) apply(metadata repository.WallpaperMetadata) repository.WallpaperMetadata {
+	if p.Title != nil {
+		metadata.Title = *p.Title
+	}
+	if p.Description != nil {
+		metadata.Description = *p.Description
+	}
+	if p.SourceURL != nil {
+		metadata.SourceURL = *p.SourceURL
+	}
+	if p.Author != nil {
+		metadata.Author = *p.Author
+	}
+	if p.License != nil {
+		metadata.License = *p.License
+	}
+	if p.Tags != nil {
+		metadata.Tags = *p.Tags
+	}
+	return metadata
+}
+
+// UpdateWallpaperMetadata edits the metadata of the user's wallpaper with the
+// given hash on every device it was published to
+func (s *PublisherService) UpdateWallpaperMetadata(ctx context.Context, userID, hash string, patch *WallpaperMetadataPatch) (*repository.PublishedWallpaper, error) {
+	publishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByUserIDAndHash(ctx, userID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if publishedWallpaper == nil {
+		return nil, fmt.Errorf("%w: no published wallpaper with hash %s", ErrNotFound, hash)
+	}
+
+	metadata, err := normalizeMetadata(patch.apply(publishedWallpaper.WallpaperMetadata))
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAt := time.Now().Unix()
+	if err := s.publishedWallpaperRepo.UpdateMetadata(ctx, userID, hash, metadata, updatedAt); err != nil {
+		return nil, err
+	}
+	publishedWallpaper.WallpaperMetadata = metadata
+	publishedWallpaper.UpdatedAt = updatedAt
+	return publishedWallpaper, nil
+}
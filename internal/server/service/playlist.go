@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+const (
+	minPlaylistInterval = time.Minute
+	maxPlaylistLength   = 500
+)
+
+// cronParser accepts standard five-field expressions, descriptors such as
+// @hourly, and a CRON_TZ=Area/City prefix
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// PlaylistService manages playlists and advances the due ones
+type PlaylistService struct {
+	playlistRepo           *repository.PlaylistRepository
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	publisherService       *PublisherService
+}
+
+func NewPlaylistService(playlistRepo *repository.PlaylistRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, publisherService *PublisherService) *PlaylistService {
+	return &PlaylistService{playlistRepo: playlistRepo, publishedWallpaperRepo: publishedWallpaperRepo, publisherService: publisherService}
+}
+
+// PlaylistInput describes a playlist to create or replace. Exactly one of
+// Interval (a duration such as "1h") and Cron has to be set. Enabled
+// defaults to true.
+type PlaylistInput struct {
+	Name     string   `json:"name"`
+	Hashes   []string `json:"hashes"`
+	Shuffle  bool     `json:"shuffle"`
+	Interval string   `json:"interval"`
+	Cron     string   `json:"cron"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+func (s *PlaylistService) CreatePlaylist(ctx context.Context, userID, deviceID string, input *PlaylistInput) (*repository.Playlist, error) {
+	if _, err := s.publisherService.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	playlist := &repository.Playlist{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		CreatedAt: now,
+	}
+	if err := s.apply(ctx, playlist, input, now); err != nil {
+		return nil, err
+	}
+
+	if err := s.playlistRepo.CreatePlaylist(ctx, playlist); err != nil {
+		return nil, err
+	}
+	if playlist.Enabled {
+		if err := s.playlistRepo.DisableOtherPlaylists(ctx, deviceID, playlist.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return playlist, nil
+}
+
+func (s *PlaylistService) GetPlaylists(ctx context.Context, userID, deviceID string) ([]*repository.Playlist, error) {
+	if _, err := s.publisherService.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+	return s.playlistRepo.GetPlaylistsByDeviceID(ctx, deviceID)
+}
+
+func (s *PlaylistService) GetPlaylist(ctx context.Context, userID, deviceID, id string) (*repository.Playlist, error) {
+	if _, err := s.publisherService.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+	playlist, err := s.playlistRepo.GetPlaylistByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if playlist == nil || playlist.DeviceID != deviceID {
+		return nil, fmt.Errorf("%w: no playlist %s on device %s", ErrNotFound, id, deviceID)
+	}
+	return playlist, nil
+}
+
+// UpdatePlaylist replaces a playlist's settings. The rotation starts over
+// from the beginning.
+func (s *PlaylistService) UpdatePlaylist(ctx context.Context, userID, deviceID, id string, input *PlaylistInput) (*repository.Playlist, error) {
+	playlist, err := s.GetPlaylist(ctx, userID, deviceID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if err := s.apply(ctx, playlist, input, now); err != nil {
+		return nil, err
+	}
+	if err := s.playlistRepo.ReplacePlaylist(ctx, playlist); err != nil {
+		return nil, err
+	}
+	if playlist.Enabled {
+		if err := s.playlistRepo.DisableOtherPlaylists(ctx, deviceID, playlist.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return playlist, nil
+}
+
+func (s *PlaylistService) DeletePlaylist(ctx context.Context, userID, deviceID, id string) error {
+	if _, err := s.GetPlaylist(ctx, userID, deviceID, id); err != nil {
+		return err
+	}
+	return s.playlistRepo.DeletePlaylistByID(ctx, id)
+}
+
+// SkipPlaylist advances a playlist right away instead of waiting for its next
+// scheduled run
+func (s *PlaylistService) SkipPlaylist(ctx context.Context, userID, deviceID, id string) (*repository.Playlist, error) {
+	playlist, err := s.GetPlaylist(ctx, userID, deviceID, id)
+	if err != nil {
+		return nil, err
+	}
+	switch step, err := s.advance(ctx, playlist, time.Now()); {
+	case err != nil:
+		return nil, err
+	case step == playlistDisabled:
+		return nil, fmt.Errorf("%w: none of the playlist's wallpapers exist anymore, so it was disabled", ErrNotFound)
+	case step == playlistPostponed:
+		return nil, fmt.Errorf("%w: none of the playlist's wallpapers have gone live yet", ErrConflict)
+	}
+	return playlist, nil
+}
+
+// PlaylistReport summarizes one scheduler pass
+type PlaylistReport struct {
+	Due      int `json:"due"`
+	Advanced int `json:"advanced"`
+	// Postponed playlists only have wallpapers that haven't gone live yet
+	Postponed int `json:"postponed"`
+	// Disabled playlists have no wallpapers left at all
+	Disabled int `json:"disabled"`
+	// Claimed playlists were advanced by another scheduler
+	Claimed int      `json:"claimed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// RunDue advances every enabled playlist whose next run has come
+func (s *PlaylistService) RunDue(ctx context.Context) (*PlaylistReport, error) {
+	now := time.Now()
+	playlists, err := s.playlistRepo.GetDuePlaylists(ctx, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PlaylistReport{}
+	for _, playlist := range playlists {
+		report.Due++
+		step, err := s.advance(ctx, playlist, now)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("playlist %s: %v", playlist.ID, err))
+			continue
+		}
+		switch step {
+		case playlistAdvanced:
+			report.Advanced++
+		case playlistPostponed:
+			report.Postponed++
+		case playlistDisabled:
+			report.Disabled++
+		case playlistClaimed:
+			report.Claimed++
+		}
+	}
+	return report, nil
+}
+
+// playlistStep is what advancing a playlist did
+type playlistStep int
+
+const (
+	playlistAdvanced playlistStep = iota
+	playlistPostponed
+	playlistDisabled
+	playlistClaimed
+)
+
+// advance makes the playlist's next wallpaper current and schedules the run
+// after it. Wallpapers deleted since the playlist was made are skipped, as are
+// ones still waiting to go live. With nothing live it waits for the next run,
+// and with nothing left at all it disables the playlist.
+func (s *PlaylistService) advance(ctx context.Context, playlist *repository.Playlist, now time.Time) (playlistStep, error) {
+	order, position := playlist.Order, playlist.Position
+
+	var hash string
+	pending := false
+	for range playlist.Hashes {
+		position++
+		if position >= len(order) {
+			order = playlistOrder(playlist.Hashes, playlist.Shuffle, lastShown(order, position-1))
+			position = 0
+		}
+
+		publishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, playlist.DeviceID, order[position])
+		if err != nil {
+			return 0, err
+		}
+		if publishedWallpaper == nil {
+			continue
+		}
+		if publishedWallpaper.ScheduleStatus == repository.ScheduleStatusPending {
+			pending = true
+			continue
+		}
+		hash = publishedWallpaper.Hash
+		break
+	}
+
+	if hash == "" && !pending {
+		disabled, err := s.playlistRepo.DisablePlaylist(ctx, playlist.ID, playlist.NextRunAt, now.Unix())
+		if err != nil || !disabled {
+			return playlistClaimed, err
+		}
+		playlist.Enabled, playlist.UpdatedAt = false, now.Unix()
+		return playlistDisabled, nil
+	}
+
+	nextRunAt, err := nextPlaylistRun(playlist, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if hash == "" {
+		postponed, err := s.playlistRepo.PostponePlaylist(ctx, playlist.ID, playlist.NextRunAt, nextRunAt, now.Unix())
+		if err != nil || !postponed {
+			return playlistClaimed, err
+		}
+		playlist.NextRunAt, playlist.UpdatedAt = nextRunAt, now.Unix()
+		return playlistPostponed, nil
+	}
+
+	// Claim this step first so a second scheduler doesn't advance it too
+	advanced, err := s.playlistRepo.AdvancePlaylist(ctx, playlist.ID, playlist.NextRunAt, order, position, now.Unix(), nextRunAt)
+	if err != nil || !advanced {
+		return playlistClaimed, err
+	}
+	if err := s.publisherService.setCurrentWallpaper(ctx, playlist.DeviceID, hash, now.Unix()); err != nil {
+		return 0, err
+	}
+
+	playlist.Order, playlist.Position = order, position
+	playlist.LastRunAt, playlist.NextRunAt = now.Unix(), nextRunAt
+	playlist.UpdatedAt = now.Unix()
+	return playlistAdvanced, nil
+}
+
+// apply validates input and copies it onto playlist, restarting the rotation
+func (s *PlaylistService) apply(ctx context.Context, playlist *repository.Playlist, input *PlaylistInput, now int64) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = "Playlist"
+	}
+	if len(name) > maxTitleLength {
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidInput, maxTitleLength)
+	}
+
+	if len(input.Hashes) == 0 || len(input.Hashes) > maxPlaylistLength {
+		return fmt.Errorf("%w: a playlist needs between 1 and %d wallpapers", ErrInvalidInput, maxPlaylistLength)
+	}
+	seen := map[string]bool{}
+	for _, hash := range input.Hashes {
+		if seen[hash] {
+			return fmt.Errorf("%w: wallpaper %s is in the playlist twice", ErrInvalidInput, hash)
+		}
+		seen[hash] = true
+
+		publishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, playlist.DeviceID, hash)
+		if err != nil {
+			return err
+		}
+		if publishedWallpaper == nil {
+			return fmt.Errorf("%w: no published wallpaper %s on device %s", ErrInvalidInput, hash, playlist.DeviceID)
+		}
+		if publishedWallpaper.ScheduleStatus == repository.ScheduleStatusPending {
+			return fmt.Errorf("%w: wallpaper %s is scheduled and hasn't gone live yet", ErrInvalidInput, hash)
+		}
+	}
+
+	playlist.Interval, playlist.Cron = 0, ""
+	switch {
+	case input.Interval != "" && input.Cron != "":
+		return fmt.Errorf("%w: give either an interval or a cron expression, not both", ErrInvalidInput)
+	case input.Interval != "":
+		interval, err := time.ParseDuration(input.Interval)
+		if err != nil {
+			return fmt.Errorf("%w: invalid interval: %v", ErrInvalidInput, err)
+		}
+		if interval < minPlaylistInterval {
+			return fmt.Errorf("%w: interval must be at least %s", ErrInvalidInput, minPlaylistInterval)
+		}
+		playlist.Interval = int64(interval / time.Second)
+	case input.Cron != "":
+		if _, err := cronParser.Parse(input.Cron); err != nil {
+			return fmt.Errorf("%w: invalid cron expression: %v", ErrInvalidInput, err)
+		}
+		playlist.Cron = input.Cron
+	default:
+		return fmt.Errorf("%w: a playlist needs an interval or a cron expression", ErrInvalidInput)
+	}
+
+	playlist.Name = name
+	playlist.Hashes = input.Hashes
+	playlist.Shuffle = input.Shuffle
+	playlist.Enabled = input.Enabled == nil || *input.Enabled
+	playlist.Order = playlistOrder(input.Hashes, input.Shuffle, "")
+	playlist.Position = -1
+	playlist.UpdatedAt = now
+
+	// Enabled playlists show their first wallpaper on the next scheduler pass
+	playlist.NextRunAt = 0
+	if playlist.Enabled {
+		playlist.NextRunAt = now
+	}
+	return nil
+}
+
+// playlistOrder returns the order of one pass through hashes. Shuffled passes
+// don't start with the wallpaper the previous pass ended on.
+func playlistOrder(hashes []string, shuffle bool, previous string) []string {
+	order := append([]string(nil), hashes...)
+	if !shuffle {
+		return order
+	}
+	rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	if len(order) > 1 && order[0] == previous {
+		last := len(order) - 1
+		order[0], order[last] = order[last], order[0]
+	}
+	return order
+}
+
+func lastShown(order []string, position int) string {
+	if position < 0 || position >= len(order) {
+		return ""
+	}
+	return order[position]
+}
+
+// nextPlaylistRun returns when the playlist should advance after now
+func nextPlaylistRun(playlist *repository.Playlist, now time.Time) (int64, error) {
+	if playlist.Cron == "" {
+		return now.Add(time.Duration(playlist.Interval) * time.Second).Unix(), nil
+	}
+	schedule, err := cronParser.Parse(playlist.Cron)
+	if err != nil {
+		return 0, err
+	}
+	return schedule.Next(now).Unix(), nil
+}
@@ -3,21 +3,39 @@ package service
 import (
 	"context"
 	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/metrics"
+	"github.io/khosbilegt/wallstream/internal/server/pki"
 	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
 	shared "github.io/khosbilegt/wallstream/internal/shared"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// paletteSize is how many dominant colors are stored per wallpaper
+const paletteSize = 5
+
 type PublisherService struct {
 	publisherRepo          *repository.PublisherDeviceRepository
 	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	fileService            *FileService
+	webhookService         *WebhookService
+	deviceTokenRepo        *repository.DeviceTokenRepository
+	deviceCertificateRepo  *repository.DeviceCertificateRepository
+	// ca issues device certificates; nil when mutual TLS is off
+	ca           *pki.CA
+	usersRepo    *repository.UsersRepository
+	auditService *AuditService
 }
 
-func NewPublisherService(publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository) *PublisherService {
-	return &PublisherService{publisherRepo: publisherRepo, publishedWallpaperRepo: publishedWallpaperRepo}
+func NewPublisherService(publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, fileService *FileService, webhookService *WebhookService, deviceTokenRepo *repository.DeviceTokenRepository, deviceCertificateRepo *repository.DeviceCertificateRepository, ca *pki.CA, usersRepo *repository.UsersRepository, auditService *AuditService) *PublisherService {
+	return &PublisherService{publisherRepo: publisherRepo, publishedWallpaperRepo: publishedWallpaperRepo, fileService: fileService, webhookService: webhookService, deviceTokenRepo: deviceTokenRepo, deviceCertificateRepo: deviceCertificateRepo, ca: ca, usersRepo: usersRepo, auditService: auditService}
 }
 
 func (s *PublisherService) CreatePublisherDevice(ctx context.Context, userID, deviceID string) error {
@@ -29,7 +47,14 @@ func (s *PublisherService) CreatePublisherDevice(ctx context.Context, userID, de
 		UpdatedAt: time.Now().Unix(),
 	}
 
-	return s.publisherRepo.CreatePublisherDevice(ctx, publisherDevice)
+	if err := s.publisherRepo.CreatePublisherDevice(ctx, publisherDevice); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%w: device ID already in use", ErrConflict)
+		}
+		return err
+	}
+	s.auditService.Record(ctx, userID, AuditDeviceCreated, deviceID, nil)
+	return nil
 }
 
 func (s *PublisherService) GetPublisherDevicesByUserID(ctx context.Context, userID string) ([]*repository.PublisherDevice, error) {
@@ -50,8 +75,20 @@ func (s *PublisherService) GetPublisherDeviceByDeviceID(ctx context.Context, dev
 	return publisherDevice, nil
 }
 
-func (s *PublisherService) DeletePublisherDeviceByDeviceID(ctx context.Context, deviceID string) error {
-	return s.publisherRepo.DeletePublisherDeviceByDeviceID(ctx, deviceID)
+func (s *PublisherService) DeletePublisherDeviceByDeviceID(ctx context.Context, userID, deviceID string) error {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return err
+	}
+	if err := s.publisherRepo.DeletePublisherDeviceByDeviceID(ctx, deviceID); err != nil {
+		return err
+	}
+	s.auditService.Record(ctx, userID, AuditDeviceDeleted, deviceID, nil)
+	// Tokens and certificates must not carry over to a device later created
+	// with the same ID
+	if err := s.deviceTokenRepo.DeleteTokensByDeviceID(ctx, deviceID); err != nil {
+		return err
+	}
+	return s.deviceCertificateRepo.DeleteCertificatesByDeviceID(ctx, deviceID)
 }
 
 // Generate url to upload the wallpaper to the server
@@ -64,49 +101,386 @@ func (s *PublisherService) GenerateUploadURL(ctx context.Context, userID, device
 	return uploadURL, nil
 }
 
-// TODO: Cleanup previous files
-// Publish wallpaper given file path that was already uploaded to the server
-func (s *PublisherService) PublishUploadedWallpaper(ctx context.Context, userID, deviceID, filename string) error {
-	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
-	if err != nil {
+// Publish wallpaper given file path that was already uploaded to the server,
+// optionally along with variants that were uploaded the same way
+func (s *PublisherService) PublishUploadedWallpaper(ctx context.Context, userID, deviceID, filename string, variantUploads []VariantUpload, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) error {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
 		return err
 	}
-	if publisherDevice == nil {
-		return fmt.Errorf("no publisher device found for device %s", deviceID)
-	}
-	if publisherDevice.UserID != userID {
-		return fmt.Errorf("publisher device not found for user %s", userID)
-	}
 	// Check hash of the file exists in the database
-	filePath := "uploads/" + filename
+	filePath := s.fileService.Path(filename)
 	hash, err := shared.HashFile(filePath)
 
 	if err != nil {
 		return err
 	}
 
-	previousPublishedWallpapers, err := s.publishedWallpaperRepo.GetPublishedWallpapersByDeviceID(ctx, hash)
+	variants, err := buildVariants(s.fileService, variantUploads)
 	if err != nil {
 		return err
 	}
-	for _, previousPublishedWallpaper := range previousPublishedWallpapers {
-		if previousPublishedWallpaper.Hash == hash {
-			return fmt.Errorf("published wallpaper already exists for hash %s", hash)
+
+	_, err = s.publish(ctx, &repository.PublishedWallpaper{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Hash:     variantsHash(hash, variants),
+		URL:      filePath,
+		Variants: variants,
+
+		WallpaperMetadata: metadata,
+		PublishSchedule:   schedule,
+	})
+	return err
+}
+
+// PublishWallpaperFile stores and publishes an image in one step. If anything
+// after storing fails the file is removed again, so a failed publish never
+// leaves an orphaned upload behind.
+func (s *PublisherService) PublishWallpaperFile(ctx context.Context, userID, deviceID string, file io.Reader, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error) {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.fileService.StoreImage(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	publishedWallpaper, err := s.publish(ctx, &repository.PublishedWallpaper{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Hash:     stored.Hash,
+		URL:      stored.Path,
+
+		WallpaperMetadata: metadata,
+		PublishSchedule:   schedule,
+	})
+	if err != nil {
+		if removeErr := s.fileService.Remove(stored.Filename); removeErr != nil {
+			log.Printf("Failed to remove %s after failed publish: %v", stored.Path, removeErr)
 		}
+		return nil, err
 	}
-	publishedWallpaper := &repository.PublishedWallpaper{
-		ID:        uuid.New().String(),
-		UserID:    userID,
+	return publishedWallpaper, nil
+}
+
+// publish records a wallpaper whose files are already stored as the device's
+// new current wallpaper, or as a pending one if it's scheduled for later. The
+// caller fills in the user, device, hash, files, metadata and schedule.
+func (s *PublisherService) publish(ctx context.Context, publishedWallpaper *repository.PublishedWallpaper) (*repository.PublishedWallpaper, error) {
+	metadata, err := normalizeMetadata(publishedWallpaper.WallpaperMetadata)
+	if err != nil {
+		return nil, err
+	}
+	publishedWallpaper.WallpaperMetadata = metadata
+
+	now := time.Now().Unix()
+	schedule, err := normalizeSchedule(publishedWallpaper.PublishSchedule, now)
+	if err != nil {
+		return nil, err
+	}
+	publishedWallpaper.PublishSchedule = schedule
+
+	deviceID, hash := publishedWallpaper.DeviceID, publishedWallpaper.Hash
+	previousPublishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, deviceID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if previousPublishedWallpaper != nil {
+		return nil, fmt.Errorf("%w for hash %s, roll back to it instead", ErrAlreadyPublished, hash)
+	}
+	publishedWallpaper.ID = uuid.New().String()
+	publishedWallpaper.CreatedAt = now
+	publishedWallpaper.UpdatedAt = publishedWallpaper.CreatedAt
+
+	pending := schedule.PublishAt > 0
+	switch {
+	case pending:
+		publishedWallpaper.ScheduleStatus = repository.ScheduleStatusPending
+	case schedule.ExpiresAt > 0:
+		revertHash, err := s.currentHash(ctx, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		publishedWallpaper.ScheduleStatus = repository.ScheduleStatusLive
+		publishedWallpaper.RevertHash = revertHash
+	}
+
+	// A wallpaper in a format we can't decode is still publishable, it just
+	// won't show up in color searches
+	palette, err := utils.ExtractPalette(s.fileService.Path(publishedWallpaper.URL), paletteSize)
+	if err != nil {
+		log.Printf("Skipping palette for %s: %v", publishedWallpaper.URL, err)
+	} else {
+		publishedWallpaper.Palette = palette.Colors
+		publishedWallpaper.Luminance = palette.Luminance
+	}
+	if err := s.publishedWallpaperRepo.CreatePublishedWallpaper(ctx, publishedWallpaper); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w for hash %s, roll back to it instead", ErrAlreadyPublished, hash)
+		}
+		return nil, err
+	}
+	if !pending {
+		if err := s.setCurrentWallpaper(ctx, deviceID, hash, publishedWallpaper.CreatedAt); err != nil {
+			// Don't leave a record behind that was never made current
+			if deleteErr := s.publishedWallpaperRepo.DeletePublishedWallpaperByID(ctx, publishedWallpaper.ID); deleteErr != nil {
+				log.Printf("Failed to remove published wallpaper %s: %v", publishedWallpaper.ID, deleteErr)
+			}
+			return nil, err
+		}
+	}
+	// Pending wallpapers are made current by the scheduler at PublishAt
+
+	status := "current"
+	if pending {
+		status = "scheduled"
+	}
+	metrics.Publishes.WithLabelValues(status).Inc()
+	s.auditService.Record(ctx, publishedWallpaper.UserID, AuditWallpaperPublished, hash, map[string]string{"device_id": deviceID})
+	s.webhookService.Notify(ctx, EventWallpaperPublished, []string{publishedWallpaper.UserID}, publishedWallpaper)
+	return publishedWallpaper, nil
+}
+
+// getOwnedPublisherDevice returns the device if it exists and belongs to userID
+func (s *PublisherService) getOwnedPublisherDevice(ctx context.Context, userID, deviceID string) (*repository.PublisherDevice, error) {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if publisherDevice == nil || publisherDevice.UserID != userID {
+		return nil, fmt.Errorf("%w: no publisher device %s", ErrNotFound, deviceID)
+	}
+	return publisherDevice, nil
+}
+
+// FilePath returns where a published wallpaper's file lives on disk
+func (s *PublisherService) FilePath(url string) string {
+	return s.fileService.Path(url)
+}
+
+// GetCurrentWallpaper returns the wallpaper the device's current pointer
+// references, falling back to the newest one for devices published to before
+// the pointer existed. Public streams can be read by anyone.
+func (s *PublisherService) GetCurrentWallpaper(ctx context.Context, userID, deviceID string) (*repository.PublishedWallpaper, error) {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if publisherDevice == nil || (publisherDevice.UserID != userID && !publisherDevice.Public) {
+		return nil, fmt.Errorf("%w: no publisher device %s", ErrNotFound, deviceID)
+	}
+	return currentPublishedWallpaper(ctx, s.publishedWallpaperRepo, publisherDevice)
+}
+
+func currentPublishedWallpaper(ctx context.Context, publishedWallpaperRepo *repository.PublishedWallpaperRepository, publisherDevice *repository.PublisherDevice) (*repository.PublishedWallpaper, error) {
+	deviceID := publisherDevice.DeviceID
+
+	var publishedWallpaper *repository.PublishedWallpaper
+	var err error
+	if publisherDevice.CurrentHash != "" {
+		publishedWallpaper, err = publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, deviceID, publisherDevice.CurrentHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if publishedWallpaper == nil {
+		publishedWallpaper, err = publishedWallpaperRepo.GetLatestPublishedWallpaperByDeviceID(ctx, deviceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if publishedWallpaper == nil {
+		return nil, fmt.Errorf("%w: no published wallpapers for device %s", ErrNotFound, deviceID)
+	}
+	return publishedWallpaper, nil
+}
+
+// StreamSettings control how a device appears in the public catalog
+type StreamSettings struct {
+	Public      bool     `json:"public"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// UpdateStreamSettings publishes a device to the catalog or takes it back out.
+// Public streams without a name are listed under their device ID.
+func (s *PublisherService) UpdateStreamSettings(ctx context.Context, userID, deviceID string, settings *StreamSettings) (*repository.PublisherDevice, error) {
+	publisherDevice, err := s.getOwnedPublisherDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err = normalizeStreamSettings(deviceID, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAt := time.Now().Unix()
+	if err := s.publisherRepo.UpdateStreamSettings(ctx, deviceID, settings.Public, settings.Name, settings.Description, settings.Tags, updatedAt); err != nil {
+		return nil, err
+	}
+	publisherDevice.Public = settings.Public
+	publisherDevice.Name = settings.Name
+	publisherDevice.Description = settings.Description
+	publisherDevice.Tags = settings.Tags
+	publisherDevice.UpdatedAt = updatedAt
+	return publisherDevice, nil
+}
+
+// normalizeStreamSettings trims and checks settings, returning a copy. Public
+// streams are named after their device unless given a name.
+func normalizeStreamSettings(deviceID string, settings *StreamSettings) (*StreamSettings, error) {
+	name := strings.TrimSpace(settings.Name)
+	if name == "" && settings.Public {
+		name = deviceID
+	}
+	description := strings.TrimSpace(settings.Description)
+	if len(name) > maxTitleLength {
+		return nil, fmt.Errorf("%w: name is longer than %d characters", ErrInvalidInput, maxTitleLength)
+	}
+	if len(description) > maxDescriptionLength {
+		return nil, fmt.Errorf("%w: description is longer than %d characters", ErrInvalidInput, maxDescriptionLength)
+	}
+	tags, err := normalizeTags(settings.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamSettings{Public: settings.Public, Name: name, Description: description, Tags: tags}, nil
+}
+
+// UpdateRetentionPolicy replaces a device's retention policy, or removes it
+// when policy is nil
+func (s *PublisherService) UpdateRetentionPolicy(ctx context.Context, userID, deviceID string, policy *repository.RetentionPolicy) (*repository.PublisherDevice, error) {
+	publisherDevice, err := s.getOwnedPublisherDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRetentionPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if err := s.publisherRepo.UpdateRetention(ctx, deviceID, policy, now); err != nil {
+		return nil, err
+	}
+	publisherDevice.Retention = policy
+	publisherDevice.UpdatedAt = now
+	return publisherDevice, nil
+}
+
+func validateRetentionPolicy(policy *repository.RetentionPolicy) error {
+	if policy != nil && (policy.KeepLast < 0 || policy.KeepDays < 0) {
+		return fmt.Errorf("%w: retention limits cannot be negative", ErrInvalidInput)
+	}
+	return nil
+}
+
+// SetWallpaperPinned pins or unpins a wallpaper so retention with KeepPinned
+// never prunes it
+func (s *PublisherService) SetWallpaperPinned(ctx context.Context, userID, deviceID, hash string, pinned bool) error {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return err
+	}
+
+	publishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, deviceID, hash)
+	if err != nil {
+		return err
+	}
+	if publishedWallpaper == nil {
+		return fmt.Errorf("%w: no published wallpaper %s on device %s", ErrNotFound, hash, deviceID)
+	}
+
+	return s.publishedWallpaperRepo.UpdatePinned(ctx, deviceID, hash, pinned, time.Now().Unix())
+}
+
+// WallpaperHistory is one page of a device's wallpapers, newest first
+type WallpaperHistory struct {
+	DeviceID    string                           `json:"device_id"`
+	CurrentHash string                           `json:"current_hash"`
+	Total       int64                            `json:"total"`
+	Offset      int64                            `json:"offset"`
+	Limit       int64                            `json:"limit"`
+	Wallpapers  []*repository.PublishedWallpaper `json:"wallpapers"`
+}
+
+func (s *PublisherService) GetWallpaperHistory(ctx context.Context, userID, deviceID string, offset, limit int64) (*WallpaperHistory, error) {
+	publisherDevice, err := s.getOwnedPublisherDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	publishedWallpapers, total, err := s.publishedWallpaperRepo.GetPublishedWallpaperHistory(ctx, deviceID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	currentHash := publisherDevice.CurrentHash
+	if currentHash == "" && offset == 0 && len(publishedWallpapers) > 0 {
+		currentHash = publishedWallpapers[0].Hash
+	}
+
+	return &WallpaperHistory{
+		DeviceID:    deviceID,
+		CurrentHash: currentHash,
+		Total:       total,
+		Offset:      offset,
+		Limit:       limit,
+		Wallpapers:  publishedWallpapers,
+	}, nil
+}
+
+// RollbackWallpaper makes a previously published wallpaper current again
+func (s *PublisherService) RollbackWallpaper(ctx context.Context, userID, deviceID, hash string) (*repository.PublishedWallpaper, error) {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+
+	publishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, deviceID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if publishedWallpaper == nil {
+		return nil, fmt.Errorf("%w: no published wallpaper %s on device %s", ErrNotFound, hash, deviceID)
+	}
+	if publishedWallpaper.ScheduleStatus == repository.ScheduleStatusPending {
+		return nil, fmt.Errorf("%w: wallpaper %s is scheduled to go live at %d", ErrConflict, hash, publishedWallpaper.PublishAt)
+	}
+
+	if err := s.setCurrentWallpaper(ctx, deviceID, hash, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	return publishedWallpaper, nil
+}
+
+// setCurrentWallpaper moves the device's current pointer, which is what
+// subscribers watch for changes, and tells their webhooks
+func (s *PublisherService) setCurrentWallpaper(ctx context.Context, deviceID, hash string, changedAt int64) error {
+	if err := s.publisherRepo.UpdateCurrentHash(ctx, deviceID, hash, changedAt); err != nil {
+		return err
+	}
+
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil || publisherDevice == nil {
+		log.Printf("Failed to queue %s webhooks for device %s: %v", EventWallpaperChanged, deviceID, err)
+		return nil
+	}
+	s.webhookService.NotifyStream(ctx, EventWallpaperChanged, publisherDevice, WallpaperChange{
 		DeviceID:  deviceID,
 		Hash:      hash,
-		URL:       filePath,
-		CreatedAt: time.Now().Unix(),
-		UpdatedAt: time.Now().Unix(),
-	}
-	s.publishedWallpaperRepo.CreatePublishedWallpaper(ctx, publishedWallpaper)
+		ChangedAt: changedAt,
+	})
 	return nil
 }
 
+// WallpaperChange is the webhook payload of EventWallpaperChanged
+type WallpaperChange struct {
+	DeviceID  string `json:"device_id"`
+	Hash      string `json:"hash"`
+	ChangedAt int64  `json:"changed_at"`
+}
+
 func (s *PublisherService) GetPublishedWallpapersByUserID(ctx context.Context, userID string) ([]*repository.PublishedWallpaper, error) {
 	return s.publishedWallpaperRepo.GetPublishedWallpapersByUserID(ctx, userID)
 }
@@ -125,5 +499,76 @@ func (s *PublisherService) GetPublishedWallpapersByDeviceID(ctx context.Context,
 }
 
 func (s *PublisherService) DeletePublishedWallpaperByHash(ctx context.Context, userID, hash string) error {
-	return s.publishedWallpaperRepo.DeletePublishedWallpaperByHash(ctx, hash)
+	publishedWallpaper, err := s.publishedWallpaperRepo.GetPublishedWallpaperByUserIDAndHash(ctx, userID, hash)
+	if err != nil {
+		return err
+	}
+	if publishedWallpaper == nil {
+		return fmt.Errorf("%w: no published wallpaper %s", ErrNotFound, hash)
+	}
+	if err := s.publishedWallpaperRepo.DeletePublishedWallpaperByID(ctx, publishedWallpaper.ID); err != nil {
+		return err
+	}
+	if err := s.repointCurrentWallpaper(ctx, publishedWallpaper.DeviceID, hash); err != nil {
+		return err
+	}
+	s.auditService.Record(ctx, userID, AuditWallpaperDeleted, hash, map[string]string{"device_id": publishedWallpaper.DeviceID})
+	s.webhookService.Notify(ctx, EventWallpaperDeleted, []string{userID}, map[string]string{"hash": hash})
+	return nil
+}
+
+// repointCurrentWallpaper moves the device's current pointer off a deleted
+// wallpaper, to the latest one left or to nothing when none are
+func (s *PublisherService) repointCurrentWallpaper(ctx context.Context, deviceID, deletedHash string) error {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if publisherDevice == nil || publisherDevice.CurrentHash != deletedHash {
+		return nil
+	}
+
+	latest, err := s.publishedWallpaperRepo.GetLatestPublishedWallpaperByDeviceID(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if latest == nil {
+		return s.publisherRepo.UpdateCurrentHash(ctx, deviceID, "", time.Now().Unix())
+	}
+	return s.setCurrentWallpaper(ctx, deviceID, latest.Hash, time.Now().Unix())
+}
+
+// ColorFilter matches wallpapers whose palette contains a color within
+// Tolerance (euclidean RGB distance) of Color
+type ColorFilter struct {
+	Color     color.RGBA
+	Tolerance float64
+}
+
+func (f *ColorFilter) Matches(publishedWallpaper *repository.PublishedWallpaper) bool {
+	for _, hex := range publishedWallpaper.Palette {
+		c, err := utils.ParseHexColor(hex)
+		if err != nil {
+			continue
+		}
+		if utils.ColorDistance(c, f.Color) <= f.Tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterPublishedWallpapersByColor returns the wallpapers matching filter, or
+// all of them when filter is nil
+func FilterPublishedWallpapersByColor(publishedWallpapers []*repository.PublishedWallpaper, filter *ColorFilter) []*repository.PublishedWallpaper {
+	if filter == nil {
+		return publishedWallpapers
+	}
+	filtered := make([]*repository.PublishedWallpaper, 0, len(publishedWallpapers))
+	for _, publishedWallpaper := range publishedWallpapers {
+		if filter.Matches(publishedWallpaper) {
+			filtered = append(filtered, publishedWallpaper)
+		}
+	}
+	return filtered
 }
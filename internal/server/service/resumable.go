@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// partialDir holds resumable uploads that haven't received all their bytes
+const partialDir = ".partial"
+
+// ResumableUploadService implements offset-based resumable uploads. Bytes are
+// appended to a partial file until the declared length is reached, at which
+// point the file is verified and stored like any other upload.
+type ResumableUploadService struct {
+	uploadDir         string
+	fileService       *FileService
+	uploadSessionRepo *repository.UploadSessionRepository
+
+	// locks serializes appends to the same upload. Entries only live while
+	// an append holds or waits for them, so finished and abandoned uploads
+	// don't accumulate.
+	locksMu sync.Mutex
+	locks   map[string]*uploadLock
+}
+
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func NewResumableUploadService(uploadDir string, fileService *FileService, uploadSessionRepo *repository.UploadSessionRepository) *ResumableUploadService {
+	return &ResumableUploadService{uploadDir: uploadDir, fileService: fileService, uploadSessionRepo: uploadSessionRepo, locks: map[string]*uploadLock{}}
+}
+
+// lock takes the append lock of an upload and returns the function that
+// releases it
+func (s *ResumableUploadService) lock(id string) func() {
+	s.locksMu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.locksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.locksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.locksMu.Unlock()
+	}
+}
+
+func (s *ResumableUploadService) partialPath(id string) string {
+	return filepath.Join(s.uploadDir, partialDir, id)
+}
+
+func (s *ResumableUploadService) CreateUpload(ctx context.Context, userID string, length int64, metadata map[string]string) (*repository.UploadSession, error) {
+	if length <= 0 || length > MaxUploadSize {
+		return nil, fmt.Errorf("%w: upload length must be between 1 and %d bytes", ErrInvalidInput, MaxUploadSize)
+	}
+
+	uploadSession := &repository.UploadSession{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: time.Now().Unix(),
+		UpdatedAt: time.Now().Unix(),
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.uploadDir, partialDir), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(s.partialPath(uploadSession.ID))
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if err := s.uploadSessionRepo.CreateUploadSession(ctx, uploadSession); err != nil {
+		os.Remove(s.partialPath(uploadSession.ID))
+		return nil, err
+	}
+	return uploadSession, nil
+}
+
+// GetUpload returns the upload if it belongs to userID and can still be
+// resumed. Completed uploads are forgotten once their file is stored.
+func (s *ResumableUploadService) GetUpload(ctx context.Context, userID, id string) (*repository.UploadSession, error) {
+	uploadSession, err := s.uploadSessionRepo.GetUploadSessionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if uploadSession == nil || uploadSession.UserID != userID {
+		return nil, fmt.Errorf("%w: no upload %s", ErrNotFound, id)
+	}
+
+	// The GC removes abandoned partial files, after which the upload has to
+	// start over
+	if uploadSession.Filename == "" {
+		if _, err := os.Stat(s.partialPath(id)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: upload %s expired", ErrNotFound, id)
+		}
+	}
+	return uploadSession, nil
+}
+
+// AppendUpload writes r at offset, which must match the upload's current
+// offset. Bytes beyond the declared length are rejected.
+func (s *ResumableUploadService) AppendUpload(ctx context.Context, userID, id string, offset int64, r io.Reader) (*repository.UploadSession, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	uploadSession, err := s.GetUpload(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if uploadSession.Filename != "" {
+		return nil, fmt.Errorf("%w: upload %s is already complete", ErrConflict, id)
+	}
+	if offset != uploadSession.Offset {
+		return nil, fmt.Errorf("%w: upload offset is %d, not %d", ErrConflict, uploadSession.Offset, offset)
+	}
+
+	f, err := os.OpenFile(s.partialPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Drop anything an interrupted request wrote past the recorded offset
+	if err := f.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	remaining := uploadSession.Length - offset
+	start := time.Now()
+	written, copyErr := io.Copy(f, io.LimitReader(r, remaining+1))
+	if written > remaining {
+		f.Truncate(offset)
+		err := fmt.Errorf("%w: upload exceeds declared length %d", ErrInvalidInput, uploadSession.Length)
+		observeUpload("resumable_chunk", start, 0, err)
+		return nil, err
+	}
+	observeUpload("resumable_chunk", start, written, copyErr)
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+
+	// Keep whatever arrived before a dropped connection so the client can
+	// resume from there
+	uploadSession.Offset = offset + written
+	uploadSession.UpdatedAt = time.Now().Unix()
+
+	if uploadSession.Offset == uploadSession.Length {
+		filename, err := s.complete(ctx, id)
+		if err != nil {
+			// A finished upload that fails verification can never succeed,
+			// so don't leave it around to be resumed
+			os.Remove(s.partialPath(id))
+			s.uploadSessionRepo.DeleteUploadSessionByID(ctx, id)
+			return nil, err
+		}
+		uploadSession.Filename = filename
+
+		// The stored file's name goes back in this response, so the session
+		// has nothing left to resume
+		if err := s.uploadSessionRepo.DeleteUploadSessionByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return uploadSession, nil
+	}
+
+	if err := s.uploadSessionRepo.UpdateUploadSessionProgress(ctx, id, uploadSession.Offset, uploadSession.Filename, uploadSession.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return uploadSession, copyErr
+	}
+	return uploadSession, nil
+}
+
+// complete verifies the finished partial file and moves it into storage
+func (s *ResumableUploadService) complete(ctx context.Context, id string) (string, error) {
+	f, err := os.Open(s.partialPath(id))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stored, err := s.fileService.StoreImage(ctx, f)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	os.Remove(s.partialPath(id))
+	return stored.Filename, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// RetentionService prunes published wallpapers that fall outside their
+// device's retention policy
+type RetentionService struct {
+	publisherRepo          *repository.PublisherDeviceRepository
+	publishedWallpaperRepo *repository.PublishedWallpaperRepository
+	playlistRepo           *repository.PlaylistRepository
+}
+
+func NewRetentionService(publisherRepo *repository.PublisherDeviceRepository, publishedWallpaperRepo *repository.PublishedWallpaperRepository, playlistRepo *repository.PlaylistRepository) *RetentionService {
+	return &RetentionService{publisherRepo: publisherRepo, publishedWallpaperRepo: publishedWallpaperRepo, playlistRepo: playlistRepo}
+}
+
+// RetentionReport summarizes one enforcement pass
+type RetentionReport struct {
+	Devices       int      `json:"devices"`
+	Pruned        int      `json:"pruned"`
+	ReleasedFiles int      `json:"released_files"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// Enforce applies every device's retention policy
+func (s *RetentionService) Enforce(ctx context.Context) (*RetentionReport, error) {
+	publisherDevices, err := s.publisherRepo.GetPublisherDevicesWithRetention(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RetentionReport{}
+	now := time.Now()
+	for _, publisherDevice := range publisherDevices {
+		report.Devices++
+		if err := s.enforceDevice(ctx, publisherDevice, now, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("device %s: %v", publisherDevice.DeviceID, err))
+		}
+	}
+	return report, nil
+}
+
+func (s *RetentionService) enforceDevice(ctx context.Context, publisherDevice *repository.PublisherDevice, now time.Time, report *RetentionReport) error {
+	policy := publisherDevice.Retention
+	if policy == nil || (policy.KeepLast <= 0 && policy.KeepDays <= 0) {
+		return nil
+	}
+
+	// Newest first, so the index is the wallpaper's rank for KeepLast
+	publishedWallpapers, _, err := s.publishedWallpaperRepo.GetPublishedWallpaperHistory(ctx, publisherDevice.DeviceID, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	currentHash := publisherDevice.CurrentHash
+	if currentHash == "" && len(publishedWallpapers) > 0 {
+		currentHash = publishedWallpapers[0].Hash
+	}
+
+	// Wallpapers an enabled playlist rotates through are still in use
+	inUse, err := s.playlistRepo.GetEnabledPlaylistHashes(ctx, publisherDevice.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	// So are the ones expiring wallpapers revert to
+	for _, publishedWallpaper := range publishedWallpapers {
+		if publishedWallpaper.ScheduleStatus == repository.ScheduleStatusLive && publishedWallpaper.RevertHash != "" {
+			inUse[publishedWallpaper.RevertHash] = true
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -policy.KeepDays).Unix()
+	for i, publishedWallpaper := range publishedWallpapers {
+		switch {
+		case publishedWallpaper.Hash == currentHash:
+			continue
+		case inUse[publishedWallpaper.Hash]:
+			continue
+		case publishedWallpaper.ScheduleStatus == repository.ScheduleStatusPending:
+			continue
+		case policy.KeepPinned && publishedWallpaper.Pinned:
+			continue
+		case policy.KeepLast > 0 && i < policy.KeepLast:
+			continue
+		case policy.KeepDays > 0 && publishedWallpaper.CreatedAt >= cutoff:
+			continue
+		}
+
+		if err := s.publishedWallpaperRepo.DeletePublishedWallpaperByID(ctx, publishedWallpaper.ID); err != nil {
+			return err
+		}
+		report.Pruned++
+
+		for _, file := range publishedWallpaper.Files() {
+			released, err := s.releaseFile(ctx, file)
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else if released {
+				report.ReleasedFiles++
+			}
+		}
+	}
+	return nil
+}
+
+// releaseFile deletes a stored file once no published wallpaper references it
+func (s *RetentionService) releaseFile(ctx context.Context, path string) (bool, error) {
+	references, err := s.publishedWallpaperRepo.CountPublishedWallpapersByURL(ctx, path)
+	if err != nil || references > 0 {
+		return false, err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
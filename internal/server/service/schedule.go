@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// maxScheduleAhead bounds how far in the future a wallpaper can be scheduled
+const maxScheduleAhead = 5 * 365 * 24 * time.Hour
+
+// normalizeSchedule validates a schedule. A PublishAt that has already passed
+// means publish now.
+func normalizeSchedule(schedule repository.PublishSchedule, now int64) (repository.PublishSchedule, error) {
+	if schedule.PublishAt < 0 || schedule.ExpiresAt < 0 {
+		return schedule, fmt.Errorf("%w: publish_at and expires_at must be unix timestamps", ErrInvalidInput)
+	}
+	if schedule.PublishAt <= now {
+		schedule.PublishAt = 0
+	}
+
+	limit := now + int64(maxScheduleAhead/time.Second)
+	if schedule.PublishAt > limit || schedule.ExpiresAt > limit {
+		return schedule, fmt.Errorf("%w: can't schedule more than %s ahead", ErrInvalidInput, maxScheduleAhead)
+	}
+	if schedule.ExpiresAt > 0 && schedule.ExpiresAt <= max(schedule.PublishAt, now) {
+		return schedule, fmt.Errorf("%w: expires_at must be after publish_at and in the future", ErrInvalidInput)
+	}
+	return schedule, nil
+}
+
+// currentHash returns the hash of the device's current wallpaper, or "" if it
+// has none yet
+func (s *PublisherService) currentHash(ctx context.Context, deviceID string) (string, error) {
+	publisherDevice, err := s.publisherRepo.GetPublisherDeviceByDeviceID(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if publisherDevice == nil {
+		return "", fmt.Errorf("%w: no publisher device %s", ErrNotFound, deviceID)
+	}
+
+	current, err := currentPublishedWallpaper(ctx, s.publishedWallpaperRepo, publisherDevice)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return current.Hash, nil
+}
+
+// ScheduleReport summarizes one scheduler pass
+type ScheduleReport struct {
+	Due       int      `json:"due"`
+	Published int      `json:"published"`
+	Expired   int      `json:"expired"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// RunSchedule publishes the scheduled wallpapers whose time has come and
+// reverts the expired ones. Everything it needs is stored with the
+// wallpapers, so a pass after a restart catches up on whatever came due while
+// the server was down.
+func (s *PublisherService) RunSchedule(ctx context.Context) (*ScheduleReport, error) {
+	now := time.Now().Unix()
+	publishedWallpapers, err := s.publishedWallpaperRepo.GetDueScheduledWallpapers(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScheduleReport{}
+	for _, publishedWallpaper := range publishedWallpapers {
+		report.Due++
+		switch publishedWallpaper.ScheduleStatus {
+		case repository.ScheduleStatusPending:
+			published, err := s.goLive(ctx, publishedWallpaper, now)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("wallpaper %s: %v", publishedWallpaper.ID, err))
+			} else if published {
+				report.Published++
+			}
+		case repository.ScheduleStatusLive:
+			if err := s.expire(ctx, publishedWallpaper, now); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("wallpaper %s: %v", publishedWallpaper.ID, err))
+			} else {
+				report.Expired++
+			}
+		}
+	}
+	return report, nil
+}
+
+// goLive makes a pending wallpaper current. One that already expired while
+// the server was down is never shown.
+func (s *PublisherService) goLive(ctx context.Context, publishedWallpaper *repository.PublishedWallpaper, now int64) (bool, error) {
+	if publishedWallpaper.ExpiresAt > 0 && publishedWallpaper.ExpiresAt <= now {
+		_, err := s.publishedWallpaperRepo.UpdateScheduleStatus(ctx, publishedWallpaper.ID, repository.ScheduleStatusPending, repository.ScheduleStatusExpired, "", now)
+		return false, err
+	}
+
+	revertHash, status := "", ""
+	if publishedWallpaper.ExpiresAt > 0 {
+		var err error
+		if revertHash, err = s.currentHash(ctx, publishedWallpaper.DeviceID); err != nil {
+			return false, err
+		}
+		status = repository.ScheduleStatusLive
+	}
+
+	// Claim the transition first so a second scheduler doesn't publish it too
+	claimed, err := s.publishedWallpaperRepo.UpdateScheduleStatus(ctx, publishedWallpaper.ID, repository.ScheduleStatusPending, status, revertHash, now)
+	if err != nil || !claimed {
+		return false, err
+	}
+	if err := s.setCurrentWallpaper(ctx, publishedWallpaper.DeviceID, publishedWallpaper.Hash, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// expire puts back the wallpaper an expiring one replaced. If something else
+// has been made current since, that stays.
+func (s *PublisherService) expire(ctx context.Context, publishedWallpaper *repository.PublishedWallpaper, now int64) error {
+	claimed, err := s.publishedWallpaperRepo.UpdateScheduleStatus(ctx, publishedWallpaper.ID, repository.ScheduleStatusLive, repository.ScheduleStatusExpired, publishedWallpaper.RevertHash, now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	currentHash, err := s.currentHash(ctx, publishedWallpaper.DeviceID)
+	if err != nil || currentHash != publishedWallpaper.Hash || publishedWallpaper.RevertHash == "" {
+		return err
+	}
+	previous, err := s.publishedWallpaperRepo.GetPublishedWallpaperByDeviceIDAndHash(ctx, publishedWallpaper.DeviceID, publishedWallpaper.RevertHash)
+	if err != nil || previous == nil {
+		// The previous wallpaper was deleted in the meantime
+		return err
+	}
+	return s.setCurrentWallpaper(ctx, publishedWallpaper.DeviceID, previous.Hash, now)
+}
@@ -3,52 +3,159 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.io/khosbilegt/wallstream/internal/server/repository"
 	"github.io/khosbilegt/wallstream/internal/server/utils"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UsersService struct {
-	repo *repository.UsersRepository
+	repo         *repository.UsersRepository
+	auditService *AuditService
+	// registration lets anyone create an account. Admins are made with
+	// CreateAdmin whether or not it's open.
+	registration bool
+	// reservedUsernames belong to system accounts and can't be registered
+	reservedUsernames []string
 }
 
-func NewUsersService(repo *repository.UsersRepository) *UsersService {
-	return &UsersService{repo: repo}
+func NewUsersService(repo *repository.UsersRepository, auditService *AuditService, registration bool, reservedUsernames []string) *UsersService {
+	return &UsersService{repo: repo, auditService: auditService, registration: registration, reservedUsernames: reservedUsernames}
 }
 
 func (s *UsersService) CreateUser(ctx context.Context, username string) (string, error) {
-	user, err := s.repo.GetUserByUsername(ctx, username)
+	if !s.registration {
+		return "", fmt.Errorf("%w: registration is closed", ErrForbidden)
+	}
+
+	user, apiKey, err := s.create(ctx, username, repository.RoleUser)
+	if err != nil {
+		return "", err
+	}
+
+	// Registration is unauthenticated, so the new user is the actor
+	info := RequestInfoFrom(ctx)
+	info.ActorID, info.ActorUsername, info.KeyID = user.ID, user.Username, APIKeyID(apiKey)
+	s.auditService.Record(WithRequestInfo(ctx, info), user.ID, AuditUserRegistered, user.Username, nil)
+
+	return apiKey, nil
+}
+
+// CreateAdmin creates an admin account and returns its API key. It's only
+// reachable from the server's command line, which is how the first admin of
+// a server is made; registration never grants a role.
+func (s *UsersService) CreateAdmin(ctx context.Context, username string) (string, error) {
+	user, apiKey, err := s.create(ctx, username, repository.RoleAdmin)
 	if err != nil {
 		return "", err
 	}
+	s.auditService.Record(ctx, user.ID, AuditUserRegistered, user.Username, map[string]string{"role": repository.RoleAdmin})
+	return apiKey, nil
+}
+
+// create adds an account with role, refusing names that are taken or reserved
+func (s *UsersService) create(ctx context.Context, username, role string) (*repository.User, string, error) {
+	if slices.Contains(s.reservedUsernames, username) {
+		return nil, "", fmt.Errorf("%w: username %s is reserved", ErrConflict, username)
+	}
+
+	user, err := s.repo.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, "", err
+	}
 
 	if user != nil {
-		return "", errors.New("user already exists")
+		return nil, "", errors.New("user already exists")
 	}
 
 	apiKey, err := utils.GenerateAPIKey()
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 
 	user = &repository.User{
 		ID:        uuid.New().String(),
 		Username:  username,
 		APIKey:    apiKey,
+		Role:      role,
 		CreatedAt: time.Now().Unix(),
 		UpdatedAt: time.Now().Unix(),
 	}
 
 	err = s.repo.CreateUser(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		// Registered by a concurrent request since the check above
+		return nil, "", errors.New("user already exists")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return user, apiKey, nil
+}
+
+// RotateAPIKey replaces the user's API key. The old key stops working
+// immediately.
+func (s *UsersService) RotateAPIKey(ctx context.Context, userID string) (string, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
 	if err != nil {
 		return "", err
 	}
 
+	apiKey, err := utils.GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.UpdateUserAPIKey(ctx, userID, apiKey); err != nil {
+		return "", err
+	}
+
+	s.auditService.Record(ctx, userID, AuditAPIKeyRotated, user.Username, map[string]string{
+		"old_key_id": APIKeyID(user.APIKey),
+		"new_key_id": APIKeyID(apiKey),
+	})
 	return apiKey, nil
 }
 
+// RequestDeletion queues an account for deletion by the account deletion
+// job. confirm must be the account's username. The account is locked at once.
+func (s *UsersService) RequestDeletion(ctx context.Context, userID, confirm string) (*repository.User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if confirm != user.Username {
+		return nil, fmt.Errorf("%w: confirm with the account's username to delete it", ErrInvalidInput)
+	}
+	if user.RoleOrDefault() == repository.RoleAdmin {
+		// Other admins can't be removed through the API, so the last one
+		// leaving would leave nobody to administer the server
+		admins, err := s.repo.CountActiveUsersByRole(ctx, repository.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, fmt.Errorf("%w: %s is the last admin; make someone else an admin first", ErrConflict, user.Username)
+		}
+	}
+
+	now := time.Now().Unix()
+	marked, err := s.repo.MarkForDeletion(ctx, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, fmt.Errorf("%w: account %s is already being deleted", ErrConflict, user.Username)
+	}
+	s.auditService.Record(ctx, userID, AuditDeletionRequested, user.Username, nil)
+
+	user.DeletionRequestedAt, user.UpdatedAt = now, now
+	return user, nil
+}
+
 func (s *UsersService) GetUserByID(ctx context.Context, id string) (*repository.User, error) {
 	return s.repo.GetUserByID(ctx, id)
 }
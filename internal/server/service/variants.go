@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	shared "github.io/khosbilegt/wallstream/internal/shared"
+)
+
+// maxVariants bounds how many variants one wallpaper can have, enough for a
+// time variant every hour
+const maxVariants = 24
+
+// VariantUpload describes one already uploaded image of a wallpaper variant
+type VariantUpload struct {
+	Kind     string `json:"kind"`
+	Start    string `json:"start,omitempty"`
+	Filename string `json:"filename"`
+}
+
+// buildVariants validates uploaded variants and hashes their files. Time
+// variants come back ordered by start.
+func buildVariants(fileService *FileService, uploads []VariantUpload) ([]repository.WallpaperVariant, error) {
+	if len(uploads) > maxVariants {
+		return nil, fmt.Errorf("%w: a wallpaper can have at most %d variants", ErrInvalidInput, maxVariants)
+	}
+
+	variants := make([]repository.WallpaperVariant, 0, len(uploads))
+	seen := map[string]bool{}
+	for _, upload := range uploads {
+		key := upload.Kind
+		switch upload.Kind {
+		case repository.VariantDay, repository.VariantNight, repository.VariantLight, repository.VariantDark:
+			if upload.Start != "" {
+				return nil, fmt.Errorf("%w: only time variants have a start", ErrInvalidInput)
+			}
+		case repository.VariantTime:
+			if _, err := time.Parse("15:04", upload.Start); err != nil {
+				return nil, fmt.Errorf("%w: time variant start %q is not HH:MM", ErrInvalidInput, upload.Start)
+			}
+			key += " " + upload.Start
+		default:
+			return nil, fmt.Errorf("%w: unknown variant kind %q", ErrInvalidInput, upload.Kind)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate %s variant", ErrInvalidInput, key)
+		}
+		seen[key] = true
+
+		filePath := fileService.Path(upload.Filename)
+		hash, err := shared.HashFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		variants = append(variants, repository.WallpaperVariant{
+			Kind:  upload.Kind,
+			Start: upload.Start,
+			Hash:  hash,
+			URL:   filePath,
+		})
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].Kind != variants[j].Kind {
+			return variants[i].Kind < variants[j].Kind
+		}
+		return variants[i].Start < variants[j].Start
+	})
+	return variants, nil
+}
+
+// variantsHash identifies a wallpaper by its main image and its variants, so
+// the same image with different variants counts as a different wallpaper
+func variantsHash(hash string, variants []repository.WallpaperVariant) string {
+	if len(variants) == 0 {
+		return hash
+	}
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\n", hash)
+	for _, variant := range variants {
+		fmt.Fprintf(hasher, "%s@%s:%s\n", variant.Kind, variant.Start, variant.Hash)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// VariantAssignment describes one variant in a monitor manifest. Index is what
+// to download it by.
+type VariantAssignment struct {
+	Index int    `json:"index"`
+	Kind  string `json:"kind"`
+	Start string `json:"start,omitempty"`
+	Hash  string `json:"hash"`
+}
+
+// GetCurrentVariantImage returns the file of one of the current wallpaper's
+// variants, by its position in the wallpaper's variant list
+func (s *PublisherService) GetCurrentVariantImage(ctx context.Context, userID, deviceID string, index int) (string, error) {
+	publishedWallpaper, err := s.GetCurrentWallpaper(ctx, userID, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if index < 0 || index >= len(publishedWallpaper.Variants) {
+		return "", fmt.Errorf("%w: no variant %d", ErrNotFound, index)
+	}
+	return s.fileService.Path(publishedWallpaper.Variants[index].URL), nil
+}
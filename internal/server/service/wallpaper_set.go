@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	shared "github.io/khosbilegt/wallstream/internal/shared"
+)
+
+// maxMonitors bounds the size of a wallpaper set
+const maxMonitors = 16
+
+// MonitorUpload describes one already uploaded image of a wallpaper set and
+// the monitor it belongs on
+type MonitorUpload struct {
+	Filename string `json:"filename"`
+	Index    int    `json:"index"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// PublishWallpaperSet publishes one image per monitor as a single wallpaper.
+// The lowest monitor index is treated as the primary monitor.
+func (s *PublisherService) PublishWallpaperSet(ctx context.Context, userID, deviceID string, uploads []MonitorUpload, metadata repository.WallpaperMetadata, schedule repository.PublishSchedule) (*repository.PublishedWallpaper, error) {
+	if _, err := s.getOwnedPublisherDevice(ctx, userID, deviceID); err != nil {
+		return nil, err
+	}
+	if len(uploads) == 0 || len(uploads) > maxMonitors {
+		return nil, fmt.Errorf("%w: a wallpaper set needs between 1 and %d monitors", ErrInvalidInput, maxMonitors)
+	}
+
+	monitors := make([]repository.MonitorImage, 0, len(uploads))
+	seen := map[int]bool{}
+	for _, upload := range uploads {
+		if seen[upload.Index] {
+			return nil, fmt.Errorf("%w: duplicate monitor index %d", ErrInvalidInput, upload.Index)
+		}
+		seen[upload.Index] = true
+		if upload.Index < 0 || upload.Width <= 0 || upload.Height <= 0 {
+			return nil, fmt.Errorf("%w: monitor %d needs a non-negative index and a resolution", ErrInvalidInput, upload.Index)
+		}
+
+		filePath := s.fileService.Path(upload.Filename)
+		hash, err := shared.HashFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		monitors = append(monitors, repository.MonitorImage{
+			Index:  upload.Index,
+			Width:  upload.Width,
+			Height: upload.Height,
+			X:      upload.X,
+			Y:      upload.Y,
+			Hash:   hash,
+			URL:    filePath,
+		})
+	}
+	sort.Slice(monitors, func(i, j int) bool { return monitors[i].Index < monitors[j].Index })
+
+	return s.publish(ctx, &repository.PublishedWallpaper{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Hash:     wallpaperSetHash(monitors),
+		URL:      monitors[0].URL,
+		Monitors: monitors,
+
+		WallpaperMetadata: metadata,
+		PublishSchedule:   schedule,
+	})
+}
+
+// wallpaperSetHash identifies a set by its images and where they go, so the
+// same images on a different layout count as a different wallpaper
+func wallpaperSetHash(monitors []repository.MonitorImage) string {
+	hasher := sha256.New()
+	for _, monitor := range monitors {
+		fmt.Fprintf(hasher, "%d:%dx%d+%d+%d:%s\n", monitor.Index, monitor.Width, monitor.Height, monitor.X, monitor.Y, monitor.Hash)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// MonitorAssignment tells a subscriber which image to show on one of its
+// monitors
+type MonitorAssignment struct {
+	// Index is the subscriber's monitor, SourceIndex the publisher's
+	Index       int    `json:"index"`
+	SourceIndex int    `json:"source_index"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Hash        string `json:"hash"`
+}
+
+// MonitorManifest describes how to lay a wallpaper out across a subscriber's
+// monitors
+type MonitorManifest struct {
+	DeviceID string `json:"device_id"`
+	Hash     string `json:"hash"`
+	// Mirrored is true when the subscriber has the publisher's monitor count
+	// and can reproduce the layout exactly
+	Mirrored bool                `json:"mirrored"`
+	Monitors []MonitorAssignment `json:"monitors"`
+	// Variants lists the alternatives to the main image a subscriber can
+	// choose from
+	Variants []VariantAssignment `json:"variants,omitempty"`
+}
+
+// BuildMonitorManifest assigns the wallpaper's images to monitorCount
+// monitors. With the same number of monitors the layout is mirrored. With
+// fewer, the primary image comes first followed by the largest remaining ones.
+// With more, images are reused in order. A monitorCount of zero or less
+// returns the publisher's layout as is.
+func BuildMonitorManifest(publishedWallpaper *repository.PublishedWallpaper, monitorCount int) *MonitorManifest {
+	monitors := publishedWallpaper.Monitors
+	if len(monitors) == 0 {
+		// Single-image wallpapers behave like a one-monitor set
+		monitors = []repository.MonitorImage{{Hash: publishedWallpaper.Hash, URL: publishedWallpaper.URL}}
+	}
+
+	manifest := &MonitorManifest{
+		DeviceID: publishedWallpaper.DeviceID,
+		Hash:     publishedWallpaper.Hash,
+		Mirrored: monitorCount <= 0 || monitorCount == len(monitors),
+	}
+	if manifest.Mirrored {
+		monitorCount = len(monitors)
+	}
+
+	ordered := monitors
+	if monitorCount < len(monitors) {
+		ordered = make([]repository.MonitorImage, len(monitors))
+		copy(ordered, monitors)
+		rest := ordered[1:]
+		sort.SliceStable(rest, func(i, j int) bool {
+			return rest[i].Width*rest[i].Height > rest[j].Width*rest[j].Height
+		})
+	}
+
+	for i := 0; i < monitorCount; i++ {
+		monitor := ordered[i%len(ordered)]
+		manifest.Monitors = append(manifest.Monitors, MonitorAssignment{
+			Index:       i,
+			SourceIndex: monitor.Index,
+			Width:       monitor.Width,
+			Height:      monitor.Height,
+			X:           monitor.X,
+			Y:           monitor.Y,
+			Hash:        monitor.Hash,
+		})
+	}
+	for i, variant := range publishedWallpaper.Variants {
+		manifest.Variants = append(manifest.Variants, VariantAssignment{
+			Index: i,
+			Kind:  variant.Kind,
+			Start: variant.Start,
+			Hash:  variant.Hash,
+		})
+	}
+	return manifest
+}
+
+// GetCurrentMonitorImage returns the file of one of the current wallpaper's
+// monitor images, by the publisher's monitor index
+func (s *PublisherService) GetCurrentMonitorImage(ctx context.Context, userID, deviceID string, index int) (string, error) {
+	publishedWallpaper, err := s.GetCurrentWallpaper(ctx, userID, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if len(publishedWallpaper.Monitors) == 0 && index == 0 {
+		return s.fileService.Path(publishedWallpaper.URL), nil
+	}
+	for _, monitor := range publishedWallpaper.Monitors {
+		if monitor.Index == index {
+			return s.fileService.Path(monitor.URL), nil
+		}
+	}
+	return "", fmt.Errorf("%w: no image for monitor %d", ErrNotFound, index)
+}
@@ -0,0 +1,511 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+	"github.io/khosbilegt/wallstream/internal/server/utils"
+)
+
+// Events a webhook can subscribe to
+const (
+	// A wallpaper was published to one of the user's devices. Scheduled
+	// wallpapers are announced when they're published, not when they go live.
+	EventWallpaperPublished = "wallpaper.published"
+	// The current wallpaper of one of the user's devices, or of a stream they
+	// subscribe to, changed
+	EventWallpaperChanged = "wallpaper.changed"
+	// A published wallpaper was deleted
+	EventWallpaperDeleted = "wallpaper.deleted"
+	// Someone subscribed to one of the user's public streams
+	EventSubscriptionRequested = "subscription.requested"
+)
+
+var webhookEvents = []string{EventWallpaperPublished, EventWallpaperChanged, EventWallpaperDeleted, EventSubscriptionRequested}
+
+const (
+	maxWebhooksPerUser  = 20
+	maxWebhookURLLength = 2048
+	// Failed deliveries are retried after 30s, 1m, 2m and so on, giving up
+	// after maxWebhookAttempts attempts about an hour later
+	maxWebhookAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	webhookTimeout     = 10 * time.Second
+	// webhookLease keeps other servers off a delivery while it's attempted
+	webhookLease     = time.Minute
+	webhookBatchSize = 50
+	// Finished deliveries are kept this long for the delivery log
+	webhookLogRetention = 30 * 24 * time.Hour
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the webhook's secret.
+const (
+	webhookEventHeader     = "X-Wallstream-Event"
+	webhookDeliveryHeader  = "X-Wallstream-Delivery"
+	webhookTimestampHeader = "X-Wallstream-Timestamp"
+	webhookSignatureHeader = "X-Wallstream-Signature"
+)
+
+// WebhookService manages webhooks and delivers events to them
+type WebhookService struct {
+	webhookRepo      *repository.WebhookRepository
+	deliveryRepo     *repository.WebhookDeliveryRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	client           *http.Client
+	listeners        []EventListener
+}
+
+// EventListener is handed every event webhooks are queued for, along with the
+// users it concerns. It's called on the request path, so it must not block.
+type EventListener func(ctx context.Context, event string, userIDs []string, data interface{})
+
+// NewWebhookService delivers to public addresses only, unless allowPrivate is
+// set for servers whose receivers are on the local network
+func NewWebhookService(webhookRepo *repository.WebhookRepository, deliveryRepo *repository.WebhookDeliveryRepository, subscriptionRepo *repository.SubscriptionRepository, allowPrivate bool) *WebhookService {
+	client := &http.Client{Timeout: webhookTimeout}
+	if !allowPrivate {
+		client = utils.NewPublicHTTPClient(webhookTimeout)
+	}
+	// A redirect is treated as a failed delivery rather than followed
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &WebhookService{
+		webhookRepo:      webhookRepo,
+		deliveryRepo:     deliveryRepo,
+		subscriptionRepo: subscriptionRepo,
+		client:           client,
+	}
+}
+
+// AddListener registers a listener for events, such as the MQTT bridge. It
+// must be called before the server starts.
+func (s *WebhookService) AddListener(listener EventListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// WebhookInput describes a webhook to create or replace. Enabled defaults to
+// true.
+type WebhookInput struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// WebhookPayload is the JSON body of every delivery. ID identifies the event
+// and stays the same across redeliveries.
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt int64       `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// CreateWebhook registers a webhook with a new secret. The returned webhook is
+// the only time the secret is shown.
+func (s *WebhookService) CreateWebhook(ctx context.Context, userID string, input *WebhookInput) (*repository.Webhook, error) {
+	webhooks, err := s.webhookRepo.GetWebhooksByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) >= maxWebhooksPerUser {
+		return nil, fmt.Errorf("%w: at most %d webhooks per user", ErrConflict, maxWebhooksPerUser)
+	}
+
+	secret, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	webhook := &repository.Webhook{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: now,
+	}
+	if err := applyWebhookInput(webhook, input, now); err != nil {
+		return nil, err
+	}
+	if err := s.webhookRepo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID string) ([]*repository.Webhook, error) {
+	webhooks, err := s.webhookRepo.GetWebhooksByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, userID, id string) (*repository.Webhook, error) {
+	webhook, err := s.getOwnedWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// UpdateWebhook replaces a webhook's URL, events and enabled flag. The secret
+// stays the same.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, userID, id string, input *WebhookInput) (*repository.Webhook, error) {
+	webhook, err := s.getOwnedWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyWebhookInput(webhook, input, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	if err := s.webhookRepo.ReplaceWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its delivery log
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID, id string) error {
+	if _, err := s.getOwnedWebhook(ctx, userID, id); err != nil {
+		return err
+	}
+	if err := s.webhookRepo.DeleteWebhookByID(ctx, id); err != nil {
+		return err
+	}
+	return s.deliveryRepo.DeleteDeliveriesByWebhookID(ctx, id)
+}
+
+// WebhookDeliveryLog is a page of a webhook's deliveries, newest first
+type WebhookDeliveryLog struct {
+	WebhookID  string                        `json:"webhook_id"`
+	Total      int64                         `json:"total"`
+	Offset     int64                         `json:"offset"`
+	Limit      int64                         `json:"limit"`
+	Deliveries []*repository.WebhookDelivery `json:"deliveries"`
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, userID, webhookID string, offset, limit int64) (*WebhookDeliveryLog, error) {
+	if _, err := s.getOwnedWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+	deliveries, total, err := s.deliveryRepo.GetDeliveriesByWebhookID(ctx, webhookID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookDeliveryLog{
+		WebhookID:  webhookID,
+		Total:      total,
+		Offset:     offset,
+		Limit:      limit,
+		Deliveries: deliveries,
+	}, nil
+}
+
+// Redeliver queues an earlier delivery's payload again as a new delivery
+func (s *WebhookService) Redeliver(ctx context.Context, userID, webhookID, deliveryID string) (*repository.WebhookDelivery, error) {
+	if _, err := s.getOwnedWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+	original, err := s.deliveryRepo.GetDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil || original.WebhookID != webhookID {
+		return nil, fmt.Errorf("%w: no delivery %s for webhook %s", ErrNotFound, deliveryID, webhookID)
+	}
+
+	delivery := redelivery(original, time.Now().Unix())
+	if err := s.deliveryRepo.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// redelivery is a new pending delivery of original's payload. The payload,
+// and so the event ID receivers dedupe on, stays the same.
+func redelivery(original *repository.WebhookDelivery, now int64) *repository.WebhookDelivery {
+	return &repository.WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     original.WebhookID,
+		UserID:        original.UserID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		RedeliveryOf:  original.ID,
+		Status:        repository.DeliveryStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// Notify queues event for the webhooks of userIDs that subscribe to it.
+// Delivery happens in the background, and failing to queue it is only logged
+// so it never fails the change that caused the event.
+func (s *WebhookService) Notify(ctx context.Context, event string, userIDs []string, data interface{}) {
+	for _, listener := range s.listeners {
+		listener(ctx, event, userIDs, data)
+	}
+	if err := s.notify(ctx, event, userIDs, data); err != nil {
+		log.Printf("Failed to queue %s webhooks: %v", event, err)
+	}
+}
+
+// NotifyStream queues an event about a device for its owner and, if the device
+// is a public stream, its subscribers
+func (s *WebhookService) NotifyStream(ctx context.Context, event string, publisherDevice *repository.PublisherDevice, data interface{}) {
+	userIDs := []string{publisherDevice.UserID}
+	if publisherDevice.Public {
+		subscriberIDs, err := s.subscriptionRepo.GetSubscriberIDs(ctx, publisherDevice.DeviceID)
+		if err != nil {
+			log.Printf("Failed to queue %s webhooks: %v", event, err)
+			return
+		}
+		for _, subscriberID := range subscriberIDs {
+			if !slices.Contains(userIDs, subscriberID) {
+				userIDs = append(userIDs, subscriberID)
+			}
+		}
+	}
+	s.Notify(ctx, event, userIDs, data)
+}
+
+func (s *WebhookService) notify(ctx context.Context, event string, userIDs []string, data interface{}) error {
+	webhooks, err := s.webhookRepo.GetEnabledWebhooksForEvent(ctx, userIDs, event)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	now := time.Now().Unix()
+	payload, err := json.Marshal(WebhookPayload{
+		ID:        uuid.New().String(),
+		Event:     event,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		delivery := &repository.WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     webhook.ID,
+			UserID:        webhook.UserID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        repository.DeliveryStatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := s.deliveryRepo.CreateDelivery(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhookReport summarizes one delivery pass
+type WebhookReport struct {
+	Due       int      `json:"due"`
+	Delivered int      `json:"delivered"`
+	Retrying  int      `json:"retrying"`
+	Failed    int      `json:"failed"`
+	Pruned    int64    `json:"pruned"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// DeliverDue attempts the deliveries that are due and prunes old ones from
+// the log
+func (s *WebhookService) DeliverDue(ctx context.Context) (*WebhookReport, error) {
+	now := time.Now()
+	deliveries, err := s.deliveryRepo.GetDueDeliveries(ctx, now.Unix(), webhookBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &WebhookReport{}
+	for _, delivery := range deliveries {
+		report.Due++
+		claimed, err := s.deliveryRepo.ClaimDelivery(ctx, delivery.ID, delivery.NextAttemptAt, now.Add(webhookLease).Unix())
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("delivery %s: %v", delivery.ID, err))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		s.attempt(ctx, delivery, now)
+		if err := s.deliveryRepo.ReplaceDelivery(ctx, delivery); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("delivery %s: %v", delivery.ID, err))
+			continue
+		}
+		switch delivery.Status {
+		case repository.DeliveryStatusSucceeded:
+			report.Delivered++
+		case repository.DeliveryStatusFailed:
+			report.Failed++
+		default:
+			report.Retrying++
+		}
+	}
+
+	pruned, err := s.deliveryRepo.DeleteDeliveriesBefore(ctx, now.Add(-webhookLogRetention).Unix())
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("pruning deliveries: %v", err))
+	}
+	report.Pruned = pruned
+	return report, nil
+}
+
+// attempt sends a delivery once and records the outcome on it, scheduling a
+// retry if it failed and attempts are left
+func (s *WebhookService) attempt(ctx context.Context, delivery *repository.WebhookDelivery, now time.Time) {
+	startWebhookAttempt(delivery, now)
+
+	webhook, err := s.webhookRepo.GetWebhookByID(ctx, delivery.WebhookID)
+	switch {
+	case err != nil:
+		delivery.Error = err.Error()
+	case webhook == nil || !webhook.Enabled:
+		// Nothing to retry against
+		delivery.Status = repository.DeliveryStatusFailed
+		delivery.Error = "webhook was deleted or disabled"
+		return
+	default:
+		s.deliver(ctx, webhook, delivery, now)
+		return
+	}
+	scheduleWebhookRetry(delivery, now)
+}
+
+// startWebhookAttempt counts an attempt and clears the previous one's outcome
+func startWebhookAttempt(delivery *repository.WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	delivery.LastAttemptAt = now.Unix()
+	delivery.UpdatedAt = now.Unix()
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+}
+
+// deliver sends a delivery to its webhook and records the response on it,
+// scheduling a retry if the receiver didn't accept it
+func (s *WebhookService) deliver(ctx context.Context, webhook *repository.Webhook, delivery *repository.WebhookDelivery, now time.Time) {
+	status, err := s.send(ctx, webhook, delivery, now)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = repository.DeliveryStatusSucceeded
+		return
+	}
+	delivery.Error = err.Error()
+	scheduleWebhookRetry(delivery, now)
+}
+
+// scheduleWebhookRetry backs off exponentially after a failed attempt, or
+// gives up once the attempts are used up
+func scheduleWebhookRetry(delivery *repository.WebhookDelivery, now time.Time) {
+	if delivery.Attempts >= maxWebhookAttempts {
+		delivery.Status = repository.DeliveryStatusFailed
+		return
+	}
+	backoff := webhookRetryBase << (delivery.Attempts - 1)
+	delivery.NextAttemptAt = now.Add(backoff).Unix()
+}
+
+// send POSTs the signed payload and returns the response status. Anything but
+// a 2xx response is an error.
+func (s *WebhookService) send(ctx context.Context, webhook *repository.Webhook, delivery *repository.WebhookDelivery, now time.Time) (int, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Wallstream-Webhook")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhookPayload(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) getOwnedWebhook(ctx context.Context, userID, id string) (*repository.Webhook, error) {
+	webhook, err := s.webhookRepo.GetWebhookByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil || webhook.UserID != userID {
+		return nil, fmt.Errorf("%w: no webhook %s", ErrNotFound, id)
+	}
+	return webhook, nil
+}
+
+// applyWebhookInput validates input and copies it onto webhook
+func applyWebhookInput(webhook *repository.Webhook, input *WebhookInput, now int64) error {
+	target, err := url.Parse(input.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: webhook url must be an http or https URL", ErrInvalidInput)
+	}
+	if len(input.URL) > maxWebhookURLLength {
+		return fmt.Errorf("%w: webhook url is longer than %d characters", ErrInvalidInput, maxWebhookURLLength)
+	}
+
+	if len(input.Events) == 0 {
+		return fmt.Errorf("%w: pick at least one of the events %s", ErrInvalidInput, strings.Join(webhookEvents, ", "))
+	}
+	events := []string{}
+	for _, event := range input.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return fmt.Errorf("%w: unknown event %q, expected one of %s", ErrInvalidInput, event, strings.Join(webhookEvents, ", "))
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	webhook.URL = input.URL
+	webhook.Events = events
+	webhook.Enabled = input.Enabled == nil || *input.Enabled
+	webhook.UpdatedAt = now
+	return nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.io/khosbilegt/wallstream/internal/server/repository"
+)
+
+// receivedWebhook is a request the test receiver got
+type receivedWebhook struct {
+	header http.Header
+	body   string
+}
+
+// webhookReceiver answers each request with the next of statuses, repeating
+// the last one, and records what it received
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{statuses: statuses}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.received = append(receiver.received, receivedWebhook{header: r.Header.Clone(), body: string(body)})
+		status := receiver.statuses[min(len(receiver.received), len(receiver.statuses))-1]
+		receiver.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func newTestDelivery(t *testing.T, webhook *repository.Webhook, now time.Time) *repository.WebhookDelivery {
+	payload, err := json.Marshal(WebhookPayload{ID: "event-1", Event: EventWallpaperPublished, CreatedAt: now.Unix(), Data: map[string]string{"hash": "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &repository.WebhookDelivery{
+		ID:            "delivery-1",
+		WebhookID:     webhook.ID,
+		UserID:        webhook.UserID,
+		Event:         EventWallpaperPublished,
+		Payload:       string(payload),
+		Status:        repository.DeliveryStatusPending,
+		NextAttemptAt: now.Unix(),
+		CreatedAt:     now.Unix(),
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	webhook := &repository.Webhook{ID: "hook-1", UserID: "user-1", URL: receiver.URL, Secret: "s3cret", Enabled: true}
+	now := time.Unix(1760000000, 0)
+	delivery := newTestDelivery(t, webhook, now)
+
+	s := NewWebhookService(nil, nil, nil, true)
+	startWebhookAttempt(delivery, now)
+	s.deliver(context.Background(), webhook, delivery, now)
+
+	if delivery.Status != repository.DeliveryStatusSucceeded || delivery.ResponseStatus != http.StatusNoContent {
+		t.Fatalf("delivery = %s with status %d, want succeeded with 204", delivery.Status, delivery.ResponseStatus)
+	}
+	if len(receiver.received) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(receiver.received))
+	}
+	got := receiver.received[0]
+	if got.body != delivery.Payload {
+		t.Errorf("body = %s, want %s", got.body, delivery.Payload)
+	}
+
+	timestamp := got.header.Get(webhookTimestampHeader)
+	if timestamp != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("%s = %q, want %d", webhookTimestampHeader, timestamp, now.Unix())
+	}
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "." + got.body))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.header.Get(webhookSignatureHeader) != want {
+		t.Errorf("%s = %q, want %q", webhookSignatureHeader, got.header.Get(webhookSignatureHeader), want)
+	}
+	if got.header.Get(webhookEventHeader) != EventWallpaperPublished || got.header.Get(webhookDeliveryHeader) != delivery.ID {
+		t.Errorf("event and delivery headers = %q, %q", got.header.Get(webhookEventHeader), got.header.Get(webhookDeliveryHeader))
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// wantDelays are the waits scheduled after each failed attempt
+		wantDelays []time.Duration
+		wantStatus string
+		wantTries  int
+	}{
+		{
+			name:       "recovers after server errors",
+			statuses:   []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			wantDelays: []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute},
+			wantStatus: repository.DeliveryStatusSucceeded,
+			wantTries:  4,
+		},
+		{
+			name:     "gives up after the last attempt",
+			statuses: []int{http.StatusInternalServerError},
+			wantDelays: []time.Duration{
+				30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute,
+				8 * time.Minute, 16 * time.Minute, 32 * time.Minute,
+			},
+			wantStatus: repository.DeliveryStatusFailed,
+			wantTries:  maxWebhookAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newWebhookReceiver(t, tt.statuses...)
+			webhook := &repository.Webhook{ID: "hook-1", UserID: "user-1", URL: receiver.URL, Secret: "s3cret", Enabled: true}
+			now := time.Unix(1760000000, 0)
+			delivery := newTestDelivery(t, webhook, now)
+			s := NewWebhookService(nil, nil, nil, true)
+
+			var delays []time.Duration
+			for delivery.Status == repository.DeliveryStatusPending {
+				if delivery.Attempts == maxWebhookAttempts {
+					t.Fatalf("still pending after %d attempts", delivery.Attempts)
+				}
+				startWebhookAttempt(delivery, now)
+				s.deliver(context.Background(), webhook, delivery, now)
+				if delivery.Status == repository.DeliveryStatusPending {
+					if delivery.ResponseStatus < 500 || delivery.Error == "" {
+						t.Fatalf("failed attempt recorded status %d, error %q", delivery.ResponseStatus, delivery.Error)
+					}
+					next := time.Unix(delivery.NextAttemptAt, 0)
+					delays = append(delays, next.Sub(now))
+					now = next
+				}
+			}
+
+			if delivery.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", delivery.Status, tt.wantStatus)
+			}
+			if delivery.Attempts != tt.wantTries || len(receiver.received) != tt.wantTries {
+				t.Errorf("attempts = %d, receiver got %d, want %d", delivery.Attempts, len(receiver.received), tt.wantTries)
+			}
+			if len(delays) != len(tt.wantDelays) {
+				t.Fatalf("delays = %v, want %v", delays, tt.wantDelays)
+			}
+			for i := range delays {
+				if delays[i] != tt.wantDelays[i] {
+					t.Errorf("delay %d = %s, want %s", i, delays[i], tt.wantDelays[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookRedelivery(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	webhook := &repository.Webhook{ID: "hook-1", UserID: "user-1", URL: receiver.URL, Secret: "s3cret", Enabled: true}
+	now := time.Unix(1760000000, 0)
+	s := NewWebhookService(nil, nil, nil, true)
+
+	// An original delivery that ran out of attempts
+	original := newTestDelivery(t, webhook, now)
+	original.Attempts = maxWebhookAttempts - 1
+	startWebhookAttempt(original, now)
+	s.deliver(context.Background(), webhook, original, now)
+	if original.Status != repository.DeliveryStatusFailed {
+		t.Fatalf("original status = %s, want failed", original.Status)
+	}
+
+	// The receiver is fixed and the delivery is replayed from the log
+	receiver.mu.Lock()
+	receiver.statuses = []int{http.StatusInternalServerError, http.StatusOK}
+	receiver.mu.Unlock()
+	later := now.Add(time.Hour)
+	replay := redelivery(original, later.Unix())
+	if replay.ID == original.ID || replay.RedeliveryOf != original.ID {
+		t.Fatalf("redelivery ID %s of %s, want a new ID of %s", replay.ID, replay.RedeliveryOf, original.ID)
+	}
+	if replay.Status != repository.DeliveryStatusPending || replay.Attempts != 0 || replay.NextAttemptAt != later.Unix() {
+		t.Fatalf("redelivery = %+v, want a pending delivery due now", replay)
+	}
+
+	startWebhookAttempt(replay, later)
+	s.deliver(context.Background(), webhook, replay, later)
+	if replay.Status != repository.DeliveryStatusSucceeded {
+		t.Fatalf("redelivery status = %s, want succeeded", replay.Status)
+	}
+
+	got := receiver.received[len(receiver.received)-1]
+	if got.body != original.Payload {
+		t.Errorf("redelivered body = %s, want the original payload %s", got.body, original.Payload)
+	}
+	if got.header.Get(webhookDeliveryHeader) != replay.ID {
+		t.Errorf("%s = %q, want %q", webhookDeliveryHeader, got.header.Get(webhookDeliveryHeader), replay.ID)
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	webhook := &repository.Webhook{ID: "hook-1", UserID: "user-1", URL: receiver.URL, Secret: "s3cret", Enabled: true}
+	now := time.Unix(1760000000, 0)
+
+	// The receiver is on loopback, which only servers allowing private
+	// addresses deliver to
+	for _, allowPrivate := range []bool{false, true} {
+		s := NewWebhookService(nil, nil, nil, allowPrivate)
+		delivery := newTestDelivery(t, webhook, now)
+		startWebhookAttempt(delivery, now)
+		s.deliver(context.Background(), webhook, delivery, now)
+
+		delivered := delivery.Status == repository.DeliveryStatusSucceeded
+		if delivered != allowPrivate {
+			t.Errorf("allowPrivate %v: delivery %s (%s), want delivered %v", allowPrivate, delivery.Status, delivery.Error, allowPrivate)
+		}
+	}
+	if len(receiver.received) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(receiver.received))
+	}
+}
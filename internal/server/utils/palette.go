@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPaletteSamples bounds how many pixels are fed into the median cut so
+// large wallpapers don't take seconds to analyze.
+const maxPaletteSamples = 16384
+
+// Palette is the result of analyzing an image: its dominant colors ordered by
+// how much of the image they cover, and its average luminance in [0, 1].
+type Palette struct {
+	Colors    []string
+	Luminance float64
+}
+
+// ExtractPalette decodes the image at path and computes up to k dominant
+// colors using median cut.
+func ExtractPalette(path string, k int) (*Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image %s: %w", path, err)
+	}
+
+	return PaletteFromImage(img, k), nil
+}
+
+// PaletteFromImage computes up to k dominant colors of img using median cut.
+func PaletteFromImage(img image.Image, k int) *Palette {
+	bounds := img.Bounds()
+	area := bounds.Dx() * bounds.Dy()
+	if area == 0 || k <= 0 {
+		return &Palette{}
+	}
+
+	step := int(math.Ceil(math.Sqrt(float64(area) / maxPaletteSamples)))
+	if step < 1 {
+		step = 1
+	}
+
+	var pixels []color.RGBA
+	var luminance float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			pixels = append(pixels, c)
+			luminance += Luminance(c)
+		}
+	}
+
+	// Uniform regions can be split into several boxes with the same average,
+	// so merge those before ranking by coverage
+	counts := map[string]int{}
+	var colors []string
+	for _, box := range medianCut(pixels, k) {
+		hex := FormatHexColor(averageColor(box))
+		if _, ok := counts[hex]; !ok {
+			colors = append(colors, hex)
+		}
+		counts[hex] += len(box)
+	}
+	sort.SliceStable(colors, func(i, j int) bool {
+		return counts[colors[i]] > counts[colors[j]]
+	})
+
+	return &Palette{
+		Colors:    colors,
+		Luminance: luminance / float64(len(pixels)),
+	}
+}
+
+// medianCut repeatedly splits the box with the widest channel range at its
+// median until there are k boxes or nothing left to split.
+func medianCut(pixels []color.RGBA, k int) [][]color.RGBA {
+	boxes := [][]color.RGBA{pixels}
+	for len(boxes) < k {
+		widest, channel, widestRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			ch, r := widestChannel(box)
+			if r > widestRange {
+				widest, channel, widestRange = i, ch, r
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		sort.Slice(box, func(i, j int) bool {
+			return channelValue(box[i], channel) < channelValue(box[j], channel)
+		})
+		mid := len(box) / 2
+		boxes[widest] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+	return boxes
+}
+
+func widestChannel(box []color.RGBA) (int, int) {
+	minC := [3]uint8{255, 255, 255}
+	maxC := [3]uint8{}
+	for _, c := range box {
+		for ch := 0; ch < 3; ch++ {
+			v := channelValue(c, ch)
+			if v < minC[ch] {
+				minC[ch] = v
+			}
+			if v > maxC[ch] {
+				maxC[ch] = v
+			}
+		}
+	}
+
+	channel, widest := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		if r := int(maxC[ch]) - int(minC[ch]); r > widest {
+			channel, widest = ch, r
+		}
+	}
+	return channel, widest
+}
+
+func channelValue(c color.RGBA, channel int) uint8 {
+	switch channel {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
+
+func averageColor(box []color.RGBA) color.RGBA {
+	var r, g, b int
+	for _, c := range box {
+		r += int(c.R)
+		g += int(c.G)
+		b += int(c.B)
+	}
+	n := len(box)
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}
+}
+
+// Luminance returns the relative luminance of c in [0, 1] using Rec. 709
+// coefficients on the gamma-encoded channels.
+func Luminance(c color.RGBA) float64 {
+	return (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+}
+
+// FormatHexColor formats c as #rrggbb.
+func FormatHexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ParseHexColor parses a #rrggbb (or rrggbb) color.
+func ParseHexColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// ColorDistance returns the euclidean distance between a and b in RGB space,
+// ranging from 0 to roughly 441.
+func ColorDistance(a, b color.RGBA) float64 {
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// stripes returns an image of vertical stripes of colors, as wide as the
+// matching widths
+func stripes(widths []int, colors []color.RGBA, height int) image.Image {
+	total := 0
+	for _, w := range widths {
+		total += w
+	}
+	img := image.NewRGBA(image.Rect(0, 0, total, height))
+	x := 0
+	for i, w := range widths {
+		for ; w > 0; w-- {
+			for y := 0; y < height; y++ {
+				img.SetRGBA(x, y, colors[i])
+			}
+			x++
+		}
+	}
+	return img
+}
+
+func TestPaletteFromImage(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.RGBA{A: 255}
+
+	tests := []struct {
+		name          string
+		img           image.Image
+		k             int
+		wantColors    []string
+		wantLuminance float64
+	}{
+		{
+			name:          "single color",
+			img:           stripes([]int{8}, []color.RGBA{red}, 8),
+			k:             4,
+			wantColors:    []string{"#ff0000"},
+			wantLuminance: 0.2126,
+		},
+		{
+			name:          "ordered by coverage",
+			img:           stripes([]int{2, 4, 2}, []color.RGBA{blue, red, green}, 4),
+			k:             3,
+			wantColors:    []string{"#ff0000", "#0000ff", "#00ff00"},
+			wantLuminance: (4*0.2126 + 2*0.0722 + 2*0.7152) / 8,
+		},
+		{
+			name:          "k bounds the palette",
+			img:           stripes([]int{4, 4}, []color.RGBA{white, black}, 4),
+			k:             1,
+			wantColors:    []string{"#7f7f7f"},
+			wantLuminance: 0.5,
+		},
+		{
+			name:       "empty image",
+			img:        image.NewRGBA(image.Rect(0, 0, 0, 0)),
+			k:          4,
+			wantColors: nil,
+		},
+		{
+			name:       "no colors asked for",
+			img:        stripes([]int{4}, []color.RGBA{red}, 4),
+			k:          0,
+			wantColors: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			palette := PaletteFromImage(tt.img, tt.k)
+			if !reflect.DeepEqual(palette.Colors, tt.wantColors) {
+				t.Errorf("Colors = %v, want %v", palette.Colors, tt.wantColors)
+			}
+			if diff := palette.Luminance - tt.wantLuminance; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Luminance = %v, want %v", palette.Luminance, tt.wantLuminance)
+			}
+		})
+	}
+}
+
+func TestPaletteFromLargeImageIsSampled(t *testing.T) {
+	// 64 times maxPaletteSamples, so every 8th pixel of every 8th row is
+	// sampled, which still sees both halves
+	img := stripes([]int{512, 512}, []color.RGBA{{R: 255, A: 255}, {B: 255, A: 255}}, 1024)
+	palette := PaletteFromImage(img, 2)
+	if len(palette.Colors) != 2 {
+		t.Fatalf("Colors = %v, want red and blue", palette.Colors)
+	}
+	for _, want := range []string{"#ff0000", "#0000ff"} {
+		if palette.Colors[0] != want && palette.Colors[1] != want {
+			t.Errorf("Colors = %v, missing %s", palette.Colors, want)
+		}
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{in: "#ff8000", want: color.RGBA{R: 255, G: 128, A: 255}},
+		{in: "FF8000", want: color.RGBA{R: 255, G: 128, A: 255}},
+		{in: " #0a0b0c ", want: color.RGBA{R: 10, G: 11, B: 12, A: 255}},
+		{in: "", wantErr: true},
+		{in: "#fff", wantErr: true},
+		{in: "#ff80000", wantErr: true},
+		{in: "#gg0000", wantErr: true},
+		{in: "+12345", wantErr: true},
+		{in: "-12345", wantErr: true},
+		{in: "#12_345", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHexColor(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHexColor(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseHexColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	// Formatting and parsing round-trip
+	c := color.RGBA{R: 1, G: 2, B: 254, A: 255}
+	if got, err := ParseHexColor(FormatHexColor(c)); err != nil || got != c {
+		t.Errorf("round trip of %v = %v, %v", c, got, err)
+	}
+}
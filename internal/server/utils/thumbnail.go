@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+)
+
+// thumbnailSamples is how many pixels per axis are averaged into each
+// thumbnail pixel, which is plenty for a preview and keeps large images fast.
+const thumbnailSamples = 4
+
+// GenerateThumbnail decodes the image at src and writes a JPEG to dst that
+// fits within maxWidth x maxHeight, keeping the aspect ratio. Images that
+// already fit are re-encoded at their own size.
+func GenerateThumbnail(src, dst string, maxWidth, maxHeight int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot open file %s: %w", src, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("cannot decode image %s: %w", src, err)
+	}
+
+	thumbnail := ScaleToFit(img, maxWidth, maxHeight)
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// Write then rename so concurrent requests never serve a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := jpeg.Encode(tmp, thumbnail, &jpeg.Options{Quality: 80}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// ScaleToFit shrinks img to fit within maxWidth x maxHeight by averaging the
+// source pixels each target pixel covers.
+func ScaleToFit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW == 0 || srcH == 0 || (srcW <= maxWidth && srcH <= maxHeight) {
+		return img
+	}
+
+	scale := min(float64(maxWidth)/float64(srcW), float64(maxHeight)/float64(srcH))
+	dstW := max(1, int(float64(srcW)*scale))
+	dstH := max(1, int(float64(srcH)*scale))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+			dst.SetRGBA(x, y, averageBox(img, x0, y0, x1, y1))
+		}
+	}
+	return dst
+}
+
+// averageBox averages a grid of samples from the box [x0, x1) x [y0, y1)
+func averageBox(img image.Image, x0, y0, x1, y1 int) color.RGBA {
+	stepX := max(1, (x1-x0)/thumbnailSamples)
+	stepY := max(1, (y1-y0)/thumbnailSamples)
+
+	var r, g, b, n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}
+}